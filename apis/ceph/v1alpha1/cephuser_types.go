@@ -30,20 +30,94 @@ type CephUserParameters struct {
 	// The uid of the user (human readable string)
 	UID *string `json:"uid"`
 
-	// The displayed name
-	DisplayedName *string `json:"displayedName"`
+	// The tenant the user belongs to. When omitted, the default tenant of the
+	// ProviderConfig is used, if any.
+	// +optional
+	Tenant *string `json:"tenant,omitempty"`
 
-	// The max number of objects allowed for this user
-	UserQuotaMaxBuckets *int `json:"userQuotaMaxBuckets"`
+	// The displayed name. Late-initialized from radosgw when omitted.
+	// +optional
+	DisplayedName *string `json:"displayedName,omitempty"`
 
-	// The maximum storage size (total) in MB
-	UserQuotaMaxSizeKB *int `json:"userQuotaMaxSizeKB"`
+	// The max number of buckets allowed for this user. Late-initialized from
+	// radosgw when omitted.
+	// +optional
+	UserQuotaMaxBuckets *int `json:"userQuotaMaxBuckets,omitempty"`
 
-	// The number of objects for this user
-	UserQuotaMaxObjects *int64 `json:"userQuotaMaxObjects"`
+	// The maximum storage size (total) in KB. Late-initialized from radosgw
+	// when omitted.
+	// +optional
+	UserQuotaMaxSizeKB *int `json:"userQuotaMaxSizeKB,omitempty"`
+
+	// The number of objects for this user. Late-initialized from radosgw when
+	// omitted.
+	// +optional
+	UserQuotaMaxObjects *int64 `json:"userQuotaMaxObjects,omitempty"`
+
+	// The email address of the user. Late-initialized from radosgw when
+	// omitted.
+	// +optional
+	Email *string `json:"email,omitempty"`
+
+	// The operations the user is allowed to perform, as a comma separated
+	// list of 'read', 'write' and 'delete', or '*' for all of them.
+	// Late-initialized from radosgw when omitted.
+	// +optional
+	OpMask *string `json:"opMask,omitempty"`
+
+	// Whether the user is a system user. Late-initialized from radosgw when
+	// omitted.
+	// +optional
+	System *bool `json:"system,omitempty"`
+
+	// The placement target buckets of the user are created in by default.
+	// Late-initialized from radosgw when omitted.
+	// +optional
+	DefaultPlacement *string `json:"defaultPlacement,omitempty"`
+
+	// The storage class objects of the user are written to by default.
+	// Late-initialized from radosgw when omitted.
+	// +optional
+	DefaultStorageClass *string `json:"defaultStorageClass,omitempty"`
+
+	// Go templates rendering the credentials written to the credentials
+	// stores and the connection secret, keyed by the key they are written to.
+	// They may use .AccessKey, .SecretKey, .Endpoint, .Region, .UID, .Tenant,
+	// .Name, .Labels and .Annotations. Defaults to writing the keys as
+	// 'access_key' and 'secret_key'.
+	// +optional
+	CredentialsTemplate map[string]string `json:"credentialsTemplate,omitempty"`
 
 	// Config for storing the created user its credentials in vault
-	VaultCredentialsStore *VaultConfig `json:"vaultCredentialsStore"`
+	// +optional
+	VaultCredentialsStore *VaultConfig `json:"vaultCredentialsStore,omitempty"`
+
+	// Config for storing the created user its credentials in a Kubernetes
+	// Secret.
+	// +optional
+	SecretCredentialsStore *SecretStoreConfig `json:"secretCredentialsStore,omitempty"`
+
+	// Config for storing the created user its credentials in an encrypted
+	// file on the filesystem of the provider.
+	// +optional
+	FileCredentialsStore *FileStoreConfig `json:"fileCredentialsStore,omitempty"`
+}
+
+type SecretStoreConfig struct {
+	// The namespace of the Secret.
+	Namespace string `json:"namespace"`
+
+	// The name of the Secret.
+	Name string `json:"name"`
+}
+
+type FileStoreConfig struct {
+	// The path of the file, relative to the credentials directory of the
+	// provider.
+	Path string `json:"path"`
+
+	// The key of a Secret holding the passphrase the file is encrypted with.
+	EncryptionKeySecretRef xpv1.SecretKeySelector `json:"encryptionKeySecretRef"`
 }
 
 type VaultConfig struct {
@@ -56,19 +130,208 @@ type VaultConfig struct {
 	// The vault human readable name
 	Name string `json:"Name"`
 
-	// The name of the Kubernetes service account authorized to access Vault
-	ServiceAccountName string `json:"serviceAccountName"`
+	// The name of the Kubernetes service account authorized to access Vault,
+	// which is the role logged in as. Required when the auth method is
+	// Kubernetes, the default.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
 
-	// The mount path in Vault where the secrets engine is
-	MountPath string `json:"mountPath"`
+	// The mount path in Vault where the KV secrets engine is. Defaults to
+	// 'secret'.
+	// +kubebuilder:default=secret
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
 
 	// The secret path in Vault where the credentials are stored
 	SecretPath string `json:"secretPath"`
+
+	// A Go template rendering the path credentials are stored at. It may use
+	// .SecretPath, .ProviderConfig, .Cluster, .Tenant, .UID, .Name and
+	// .Labels. Cluster is the 'radosgw.crossplane.io/cluster' label of the
+	// ProviderConfig, or its name without a 'ceph-' prefix. Defaults to
+	// '{{ .SecretPath }}/{{ .Cluster }}/users/{{ with .Tenant }}{{ . }}/{{ end }}{{ .UID }}'.
+	// +optional
+	SecretPathTemplate string `json:"secretPathTemplate,omitempty"`
+
+	// How to authenticate to Vault. Defaults to Kubernetes auth, logging in
+	// with ServiceAccountName as the role.
+	// +optional
+	Auth *VaultAuth `json:"auth,omitempty"`
+
+	// What happens to the credentials in a KV v2 secrets engine when the
+	// CephUser is deleted. Delete soft deletes the latest version, leaving
+	// earlier versions recoverable. Destroy permanently destroys all versions
+	// and removes the metadata of the secret. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Delete;Destroy
+	// +optional
+	KVDeletionPolicy KVDeletionPolicy `json:"kvDeletionPolicy,omitempty"`
+
+	// Write credentials to a KV v2 secrets engine with check-and-set, failing
+	// rather than overwriting a version that was written concurrently.
+	// +optional
+	CheckAndSet bool `json:"checkAndSet,omitempty"`
+
+	// The Vault Enterprise namespace the auth method and secrets engine live
+	// in.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// How to connect to Vault over TLS. Defaults to verifying Vault against
+	// the system roots.
+	// +optional
+	TLS *VaultTLSConfig `json:"tls,omitempty"`
+}
+
+// KVDeletionPolicy determines what happens to credentials in a KV v2 secrets
+// engine when their CephUser is deleted.
+type KVDeletionPolicy string
+
+// Supported KV deletion policies.
+const (
+	KVDeletionPolicyDelete  KVDeletionPolicy = "Delete"
+	KVDeletionPolicyDestroy KVDeletionPolicy = "Destroy"
+)
+
+// VaultTLSConfig configures how to connect to Vault over TLS.
+type VaultTLSConfig struct {
+	// PEM encoded CA certificates to verify Vault with instead of the system
+	// roots.
+	// +optional
+	CABundle string `json:"caBundle,omitempty"`
+
+	// The key of a Secret holding PEM encoded CA certificates to verify Vault
+	// with. Combined with CABundle when both are set.
+	// +optional
+	CABundleSecretRef *xpv1.SecretKeySelector `json:"caBundleSecretRef,omitempty"`
+
+	// A Secret of type kubernetes.io/tls holding the client certificate and
+	// key to present to Vault.
+	// +optional
+	ClientCertSecretRef *xpv1.SecretReference `json:"clientCertSecretRef,omitempty"`
+
+	// The name to verify the certificate of Vault against, when it differs
+	// from the host of the address.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// VaultAuthMethod is a method of authenticating to Vault.
+type VaultAuthMethod string
+
+// Supported Vault auth methods.
+const (
+	VaultAuthKubernetes VaultAuthMethod = "Kubernetes"
+	VaultAuthAppRole    VaultAuthMethod = "AppRole"
+	VaultAuthJWT        VaultAuthMethod = "JWT"
+	VaultAuthTokenFile  VaultAuthMethod = "TokenFile"
+)
+
+// VaultAuth configures how to authenticate to Vault.
+type VaultAuth struct {
+	// The auth method to use.
+	// +kubebuilder:validation:Enum=Kubernetes;AppRole;JWT;TokenFile
+	// +kubebuilder:default=Kubernetes
+	Method VaultAuthMethod `json:"method"`
+
+	// The path the auth method is mounted at. Defaults to 'kubernetes',
+	// 'approle' or 'jwt' depending on the method.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// Configures AppRole auth. Required when the method is AppRole.
+	// +optional
+	AppRole *VaultAppRoleAuth `json:"appRole,omitempty"`
+
+	// Configures JWT auth. Required when the method is JWT.
+	// +optional
+	JWT *VaultJWTAuth `json:"jwt,omitempty"`
+
+	// Configures reading a token from a file. Required when the method is
+	// TokenFile.
+	// +optional
+	TokenFile *VaultTokenFileAuth `json:"tokenFile,omitempty"`
+}
+
+// VaultAppRoleAuth configures logging in to Vault with an AppRole.
+type VaultAppRoleAuth struct {
+	// The key of a Secret holding the role ID.
+	RoleIDSecretRef xpv1.SecretKeySelector `json:"roleIDSecretRef"`
+
+	// The key of a Secret holding the secret ID.
+	SecretIDSecretRef xpv1.SecretKeySelector `json:"secretIDSecretRef"`
+}
+
+// VaultJWTAuth configures logging in to Vault with a service account token.
+type VaultJWTAuth struct {
+	// The Vault role to log in as.
+	Role string `json:"role"`
+
+	// The path of a projected service account token. Defaults to the token of
+	// the service account of the provider.
+	// +optional
+	TokenPath string `json:"tokenPath,omitempty"`
+
+	// Request a token with this audience for the service account of the
+	// provider, rather than reading one from TokenPath. The provider must be
+	// allowed to create tokens for its own service account.
+	// +optional
+	Audience string `json:"audience,omitempty"`
+}
+
+// VaultTokenFileAuth configures reading a Vault token from a file.
+type VaultTokenFileAuth struct {
+	// The path of a file holding a Vault token, e.g. one written by a Vault
+	// Agent sink.
+	Path string `json:"path"`
 }
 
 // CephUserObservation are the observable fields of a CephUser.
 type CephUserObservation struct {
-	ObservableField string `json:"observableField,omitempty"`
+	// The fully qualified user id as known to radosgw, i.e. 'tenant$uid' for
+	// users that belong to a tenant.
+	UID string `json:"uid,omitempty"`
+
+	// The tenant the user belongs to.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Credentials describes the credentials that were last written for the
+	// user, so that which key is current can be checked without reading them.
+	// +optional
+	Credentials *CredentialsObservation `json:"credentials,omitempty"`
+}
+
+// CredentialsObservation describes the credentials last written for a
+// CephUser.
+type CredentialsObservation struct {
+	// The access key ID of the credentials.
+	AccessKeyID string `json:"accessKeyID,omitempty"`
+
+	// The time the credentials were last written.
+	// +optional
+	LastWrittenTime *metav1.Time `json:"lastWrittenTime,omitempty"`
+
+	// Vault describes where the credentials were written to Vault, if they
+	// were.
+	// +optional
+	Vault *VaultCredentialsObservation `json:"vault,omitempty"`
+}
+
+// VaultCredentialsObservation describes where credentials were written to
+// Vault.
+type VaultCredentialsObservation struct {
+	// The mount path of the KV secrets engine.
+	MountPath string `json:"mountPath"`
+
+	// The path of the secret within the secrets engine.
+	Path string `json:"path"`
+
+	// The version of the KV secrets engine.
+	KVVersion string `json:"kvVersion"`
+
+	// The version of the secret that was written. Only KV v2 versions
+	// secrets.
+	// +optional
+	Version *int `json:"version,omitempty"`
 }
 
 // A CephUserSpec defines the desired state of a CephUser.
@@ -86,8 +349,10 @@ type CephUserStatus struct {
 // +kubebuilder:object:root=true
 
 // A CephUser is an example API type.
+// +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.conditions[?(@.type=='Synced')].status"
 // +kubebuilder:printcolumn:name="EXTERNAL-NAME",type="string",JSONPath=".metadata.annotations.crossplane\\.io/external-name"
+// +kubebuilder:printcolumn:name="TENANT",type="string",JSONPath=".status.atProvider.tenant",priority=1
 // +kubebuilder:printcolumn:name="CLUSTERNAME",type="string",JSONPath=".spec.providerConfigRef.name"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:subresource:status
@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"github.com/crossplane/crossplane-runtime/apis/common/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -86,6 +87,11 @@ func (in *CephUserList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CephUserObservation) DeepCopyInto(out *CephUserObservation) {
 	*out = *in
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(CredentialsObservation)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CephUserObservation.
@@ -106,6 +112,11 @@ func (in *CephUserParameters) DeepCopyInto(out *CephUserParameters) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Tenant != nil {
+		in, out := &in.Tenant, &out.Tenant
+		*out = new(string)
+		**out = **in
+	}
 	if in.DisplayedName != nil {
 		in, out := &in.DisplayedName, &out.DisplayedName
 		*out = new(string)
@@ -126,9 +137,51 @@ func (in *CephUserParameters) DeepCopyInto(out *CephUserParameters) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.Email != nil {
+		in, out := &in.Email, &out.Email
+		*out = new(string)
+		**out = **in
+	}
+	if in.OpMask != nil {
+		in, out := &in.OpMask, &out.OpMask
+		*out = new(string)
+		**out = **in
+	}
+	if in.System != nil {
+		in, out := &in.System, &out.System
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DefaultPlacement != nil {
+		in, out := &in.DefaultPlacement, &out.DefaultPlacement
+		*out = new(string)
+		**out = **in
+	}
+	if in.DefaultStorageClass != nil {
+		in, out := &in.DefaultStorageClass, &out.DefaultStorageClass
+		*out = new(string)
+		**out = **in
+	}
+	if in.CredentialsTemplate != nil {
+		in, out := &in.CredentialsTemplate, &out.CredentialsTemplate
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.VaultCredentialsStore != nil {
 		in, out := &in.VaultCredentialsStore, &out.VaultCredentialsStore
 		*out = new(VaultConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretCredentialsStore != nil {
+		in, out := &in.SecretCredentialsStore, &out.SecretCredentialsStore
+		*out = new(SecretStoreConfig)
+		**out = **in
+	}
+	if in.FileCredentialsStore != nil {
+		in, out := &in.FileCredentialsStore, &out.FileCredentialsStore
+		*out = new(FileStoreConfig)
 		**out = **in
 	}
 }
@@ -164,7 +217,7 @@ func (in *CephUserSpec) DeepCopy() *CephUserSpec {
 func (in *CephUserStatus) DeepCopyInto(out *CephUserStatus) {
 	*out = *in
 	in.ResourceStatus.DeepCopyInto(&out.ResourceStatus)
-	out.AtProvider = in.AtProvider
+	in.AtProvider.DeepCopyInto(&out.AtProvider)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CephUserStatus.
@@ -177,9 +230,121 @@ func (in *CephUserStatus) DeepCopy() *CephUserStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsObservation) DeepCopyInto(out *CredentialsObservation) {
+	*out = *in
+	if in.LastWrittenTime != nil {
+		in, out := &in.LastWrittenTime, &out.LastWrittenTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultCredentialsObservation)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsObservation.
+func (in *CredentialsObservation) DeepCopy() *CredentialsObservation {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsObservation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FileStoreConfig) DeepCopyInto(out *FileStoreConfig) {
+	*out = *in
+	out.EncryptionKeySecretRef = in.EncryptionKeySecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FileStoreConfig.
+func (in *FileStoreConfig) DeepCopy() *FileStoreConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(FileStoreConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretStoreConfig) DeepCopyInto(out *SecretStoreConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretStoreConfig.
+func (in *SecretStoreConfig) DeepCopy() *SecretStoreConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretStoreConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultAppRoleAuth) DeepCopyInto(out *VaultAppRoleAuth) {
+	*out = *in
+	out.RoleIDSecretRef = in.RoleIDSecretRef
+	out.SecretIDSecretRef = in.SecretIDSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultAppRoleAuth.
+func (in *VaultAppRoleAuth) DeepCopy() *VaultAppRoleAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultAppRoleAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultAuth) DeepCopyInto(out *VaultAuth) {
+	*out = *in
+	if in.AppRole != nil {
+		in, out := &in.AppRole, &out.AppRole
+		*out = new(VaultAppRoleAuth)
+		**out = **in
+	}
+	if in.JWT != nil {
+		in, out := &in.JWT, &out.JWT
+		*out = new(VaultJWTAuth)
+		**out = **in
+	}
+	if in.TokenFile != nil {
+		in, out := &in.TokenFile, &out.TokenFile
+		*out = new(VaultTokenFileAuth)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultAuth.
+func (in *VaultAuth) DeepCopy() *VaultAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VaultConfig) DeepCopyInto(out *VaultConfig) {
 	*out = *in
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(VaultAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(VaultTLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultConfig.
@@ -191,3 +356,78 @@ func (in *VaultConfig) DeepCopy() *VaultConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultCredentialsObservation) DeepCopyInto(out *VaultCredentialsObservation) {
+	*out = *in
+	if in.Version != nil {
+		in, out := &in.Version, &out.Version
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultCredentialsObservation.
+func (in *VaultCredentialsObservation) DeepCopy() *VaultCredentialsObservation {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultCredentialsObservation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultJWTAuth) DeepCopyInto(out *VaultJWTAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultJWTAuth.
+func (in *VaultJWTAuth) DeepCopy() *VaultJWTAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultJWTAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultTLSConfig) DeepCopyInto(out *VaultTLSConfig) {
+	*out = *in
+	if in.CABundleSecretRef != nil {
+		in, out := &in.CABundleSecretRef, &out.CABundleSecretRef
+		*out = new(v1.SecretKeySelector)
+		**out = **in
+	}
+	if in.ClientCertSecretRef != nil {
+		in, out := &in.ClientCertSecretRef, &out.ClientCertSecretRef
+		*out = new(v1.SecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultTLSConfig.
+func (in *VaultTLSConfig) DeepCopy() *VaultTLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultTLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultTokenFileAuth) DeepCopyInto(out *VaultTokenFileAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultTokenFileAuth.
+func (in *VaultTokenFileAuth) DeepCopy() *VaultTokenFileAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultTokenFileAuth)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,408 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+)
+
+// CephUserParameters are the configurable fields of a CephUser.
+type CephUserParameters struct {
+	// The uid of the user (human readable string).
+	// +kubebuilder:validation:MinLength=1
+	UID string `json:"uid"`
+
+	// The tenant the user belongs to. When omitted, the default tenant of the
+	// ProviderConfig is used, if any.
+	// +optional
+	Tenant string `json:"tenant,omitempty"`
+
+	// The displayed name. Late-initialized from radosgw when omitted.
+	// +optional
+	DisplayName string `json:"displayName,omitempty"`
+
+	// The email address of the user. Late-initialized from radosgw when
+	// omitted.
+	// +optional
+	Email string `json:"email,omitempty"`
+
+	// The operations the user is allowed to perform, as a comma separated
+	// list of 'read', 'write' and 'delete', or '*' for all of them.
+	// Late-initialized from radosgw when omitted.
+	// +optional
+	OpMask string `json:"opMask,omitempty"`
+
+	// Whether the user is a system user. Late-initialized from radosgw when
+	// omitted.
+	// +optional
+	System *bool `json:"system,omitempty"`
+
+	// The placement target buckets of the user are created in by default.
+	// Late-initialized from radosgw when omitted.
+	// +optional
+	DefaultPlacement string `json:"defaultPlacement,omitempty"`
+
+	// The storage class objects of the user are written to by default.
+	// Late-initialized from radosgw when omitted.
+	// +optional
+	DefaultStorageClass string `json:"defaultStorageClass,omitempty"`
+
+	// The quota of the user. Omitted limits are late-initialized from radosgw.
+	// +optional
+	Quota *UserQuota `json:"quota,omitempty"`
+
+	// Where to store the credentials of the user. At least one store is
+	// required.
+	Credentials CredentialsConfig `json:"credentials"`
+}
+
+// UserQuota limits the resources a user may consume.
+type UserQuota struct {
+	// The max number of buckets allowed for this user. Late-initialized from
+	// radosgw when omitted.
+	// +optional
+	MaxBuckets *int `json:"maxBuckets,omitempty"`
+
+	// The maximum total size of the objects of this user, e.g. '200Gi'. Must
+	// be a whole number of KiB. Use '-1' for unlimited. Late-initialized from
+	// radosgw when omitted.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+
+	// The maximum number of objects of this user, e.g. '1M'. Must be a whole
+	// number. Use '-1' for unlimited. Late-initialized from radosgw when
+	// omitted.
+	// +optional
+	MaxObjects *resource.Quantity `json:"maxObjects,omitempty"`
+}
+
+// CredentialsConfig configures where the credentials of a user are stored.
+type CredentialsConfig struct {
+	// Store the credentials in Vault.
+	// +optional
+	Vault *VaultConfig `json:"vault,omitempty"`
+
+	// Store the credentials in a Kubernetes Secret.
+	// +optional
+	Secret *SecretStoreConfig `json:"secret,omitempty"`
+
+	// Store the credentials in an encrypted file on the filesystem of the
+	// provider.
+	// +optional
+	File *FileStoreConfig `json:"file,omitempty"`
+	// Go templates rendering the credentials written to the credentials
+	// stores and the connection secret, keyed by the key they are written to.
+	// They may use .AccessKey, .SecretKey, .Endpoint, .Region, .UID, .Tenant,
+	// .Name, .Labels and .Annotations. Defaults to writing the keys as
+	// 'access_key' and 'secret_key'.
+	// +optional
+	Template map[string]string `json:"template,omitempty"`
+}
+
+// SecretStoreConfig configures the Kubernetes Secret credentials are written
+// to.
+type SecretStoreConfig struct {
+	// The namespace of the Secret.
+	Namespace string `json:"namespace"`
+
+	// The name of the Secret.
+	Name string `json:"name"`
+}
+
+// FileStoreConfig configures the encrypted file credentials are written to.
+type FileStoreConfig struct {
+	// The path of the file, relative to the credentials directory of the
+	// provider.
+	Path string `json:"path"`
+
+	// The key of a Secret holding the passphrase the file is encrypted with.
+	EncryptionKeySecretRef xpv1.SecretKeySelector `json:"encryptionKeySecretRef"`
+}
+
+// VaultConfig configures the Vault KV store credentials are written to.
+type VaultConfig struct {
+	// The version of the Vault KV store to use.
+	// +kubebuilder:validation:Enum="1";"2"
+	KVVersion string `json:"kvVersion"`
+
+	// The address of the Vault server (e.g., "https://vault.example.com:8200")
+	Address string `json:"address"`
+
+	// The vault human readable name
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// The name of the Kubernetes service account authorized to access Vault,
+	// which is the role logged in as. Required when the auth method is
+	// Kubernetes, the default.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// The mount path in Vault where the KV secrets engine is. Defaults to
+	// 'secret'.
+	// +kubebuilder:default=secret
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// The secret path in Vault where the credentials are stored
+	SecretPath string `json:"secretPath"`
+
+	// A Go template rendering the path credentials are stored at. It may use
+	// .SecretPath, .ProviderConfig, .Cluster, .Tenant, .UID, .Name and
+	// .Labels. Cluster is the 'radosgw.crossplane.io/cluster' label of the
+	// ProviderConfig, or its name without a 'ceph-' prefix. Defaults to
+	// '{{ .SecretPath }}/{{ .Cluster }}/users/{{ with .Tenant }}{{ . }}/{{ end }}{{ .UID }}'.
+	// +optional
+	SecretPathTemplate string `json:"secretPathTemplate,omitempty"`
+
+	// How to authenticate to Vault. Defaults to Kubernetes auth, logging in
+	// with ServiceAccountName as the role.
+	// +optional
+	Auth *VaultAuth `json:"auth,omitempty"`
+
+	// What happens to the credentials in a KV v2 secrets engine when the
+	// CephUser is deleted. Delete soft deletes the latest version, leaving
+	// earlier versions recoverable. Destroy permanently destroys all versions
+	// and removes the metadata of the secret. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Delete;Destroy
+	// +optional
+	KVDeletionPolicy KVDeletionPolicy `json:"kvDeletionPolicy,omitempty"`
+
+	// Write credentials to a KV v2 secrets engine with check-and-set, failing
+	// rather than overwriting a version that was written concurrently.
+	// +optional
+	CheckAndSet bool `json:"checkAndSet,omitempty"`
+
+	// The Vault Enterprise namespace the auth method and secrets engine live
+	// in.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// How to connect to Vault over TLS. Defaults to verifying Vault against
+	// the system roots.
+	// +optional
+	TLS *VaultTLSConfig `json:"tls,omitempty"`
+}
+
+// KVDeletionPolicy determines what happens to credentials in a KV v2 secrets
+// engine when their CephUser is deleted.
+type KVDeletionPolicy string
+
+// Supported KV deletion policies.
+const (
+	KVDeletionPolicyDelete  KVDeletionPolicy = "Delete"
+	KVDeletionPolicyDestroy KVDeletionPolicy = "Destroy"
+)
+
+// VaultTLSConfig configures how to connect to Vault over TLS.
+type VaultTLSConfig struct {
+	// PEM encoded CA certificates to verify Vault with instead of the system
+	// roots.
+	// +optional
+	CABundle string `json:"caBundle,omitempty"`
+
+	// The key of a Secret holding PEM encoded CA certificates to verify Vault
+	// with. Combined with CABundle when both are set.
+	// +optional
+	CABundleSecretRef *xpv1.SecretKeySelector `json:"caBundleSecretRef,omitempty"`
+
+	// A Secret of type kubernetes.io/tls holding the client certificate and
+	// key to present to Vault.
+	// +optional
+	ClientCertSecretRef *xpv1.SecretReference `json:"clientCertSecretRef,omitempty"`
+
+	// The name to verify the certificate of Vault against, when it differs
+	// from the host of the address.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// VaultAuthMethod is a method of authenticating to Vault.
+type VaultAuthMethod string
+
+// Supported Vault auth methods.
+const (
+	VaultAuthKubernetes VaultAuthMethod = "Kubernetes"
+	VaultAuthAppRole    VaultAuthMethod = "AppRole"
+	VaultAuthJWT        VaultAuthMethod = "JWT"
+	VaultAuthTokenFile  VaultAuthMethod = "TokenFile"
+)
+
+// VaultAuth configures how to authenticate to Vault.
+type VaultAuth struct {
+	// The auth method to use.
+	// +kubebuilder:validation:Enum=Kubernetes;AppRole;JWT;TokenFile
+	// +kubebuilder:default=Kubernetes
+	Method VaultAuthMethod `json:"method"`
+
+	// The path the auth method is mounted at. Defaults to 'kubernetes',
+	// 'approle' or 'jwt' depending on the method.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// Configures AppRole auth. Required when the method is AppRole.
+	// +optional
+	AppRole *VaultAppRoleAuth `json:"appRole,omitempty"`
+
+	// Configures JWT auth. Required when the method is JWT.
+	// +optional
+	JWT *VaultJWTAuth `json:"jwt,omitempty"`
+
+	// Configures reading a token from a file. Required when the method is
+	// TokenFile.
+	// +optional
+	TokenFile *VaultTokenFileAuth `json:"tokenFile,omitempty"`
+}
+
+// VaultAppRoleAuth configures logging in to Vault with an AppRole.
+type VaultAppRoleAuth struct {
+	// The key of a Secret holding the role ID.
+	RoleIDSecretRef xpv1.SecretKeySelector `json:"roleIDSecretRef"`
+
+	// The key of a Secret holding the secret ID.
+	SecretIDSecretRef xpv1.SecretKeySelector `json:"secretIDSecretRef"`
+}
+
+// VaultJWTAuth configures logging in to Vault with a service account token.
+type VaultJWTAuth struct {
+	// The Vault role to log in as.
+	Role string `json:"role"`
+
+	// The path of a projected service account token. Defaults to the token of
+	// the service account of the provider.
+	// +optional
+	TokenPath string `json:"tokenPath,omitempty"`
+
+	// Request a token with this audience for the service account of the
+	// provider, rather than reading one from TokenPath. The provider must be
+	// allowed to create tokens for its own service account.
+	// +optional
+	Audience string `json:"audience,omitempty"`
+}
+
+// VaultTokenFileAuth configures reading a Vault token from a file.
+type VaultTokenFileAuth struct {
+	// The path of a file holding a Vault token, e.g. one written by a Vault
+	// Agent sink.
+	Path string `json:"path"`
+}
+
+// CephUserObservation are the observable fields of a CephUser.
+type CephUserObservation struct {
+	// The fully qualified user id as known to radosgw, i.e. 'tenant$uid' for
+	// users that belong to a tenant.
+	UID string `json:"uid,omitempty"`
+
+	// The tenant the user belongs to.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Credentials describes the credentials that were last written for the
+	// user, so that which key is current can be checked without reading them.
+	// +optional
+	Credentials *CredentialsObservation `json:"credentials,omitempty"`
+}
+
+// CredentialsObservation describes the credentials last written for a
+// CephUser.
+type CredentialsObservation struct {
+	// The access key ID of the credentials.
+	AccessKeyID string `json:"accessKeyID,omitempty"`
+
+	// The time the credentials were last written.
+	// +optional
+	LastWrittenTime *metav1.Time `json:"lastWrittenTime,omitempty"`
+
+	// Vault describes where the credentials were written to Vault, if they
+	// were.
+	// +optional
+	Vault *VaultCredentialsObservation `json:"vault,omitempty"`
+}
+
+// VaultCredentialsObservation describes where credentials were written to
+// Vault.
+type VaultCredentialsObservation struct {
+	// The mount path of the KV secrets engine.
+	MountPath string `json:"mountPath"`
+
+	// The path of the secret within the secrets engine.
+	Path string `json:"path"`
+
+	// The version of the KV secrets engine.
+	KVVersion string `json:"kvVersion"`
+
+	// The version of the secret that was written. Only KV v2 versions
+	// secrets.
+	// +optional
+	Version *int `json:"version,omitempty"`
+}
+
+// A CephUserSpec defines the desired state of a CephUser.
+type CephUserSpec struct {
+	xpv1.ResourceSpec `json:",inline"`
+	ForProvider       CephUserParameters `json:"forProvider"`
+}
+
+// A CephUserStatus represents the observed state of a CephUser.
+type CephUserStatus struct {
+	xpv1.ResourceStatus `json:",inline"`
+	AtProvider          CephUserObservation `json:"atProvider,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// A CephUser is a radosgw user.
+// +kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.conditions[?(@.type=='Synced')].status"
+// +kubebuilder:printcolumn:name="EXTERNAL-NAME",type="string",JSONPath=".metadata.annotations.crossplane\\.io/external-name"
+// +kubebuilder:printcolumn:name="TENANT",type="string",JSONPath=".status.atProvider.tenant",priority=1
+// +kubebuilder:printcolumn:name="CLUSTERNAME",type="string",JSONPath=".spec.providerConfigRef.name"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,categories={crossplane,managed,radosgw}
+type CephUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CephUserSpec   `json:"spec"`
+	Status CephUserStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CephUserList contains a list of CephUser
+type CephUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CephUser `json:"items"`
+}
+
+// CephUser type metadata.
+var (
+	CephUserKind             = reflect.TypeOf(CephUser{}).Name()
+	CephUserGroupKind        = schema.GroupKind{Group: Group, Kind: CephUserKind}.String()
+	CephUserKindAPIVersion   = CephUserKind + "." + SchemeGroupVersion.String()
+	CephUserGroupVersionKind = SchemeGroupVersion.WithKind(CephUserKind)
+)
+
+func init() {
+	SchemeBuilder.Register(&CephUser{}, &CephUserList{})
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+const (
+	// unlimited is what radosgw, and v1alpha1, use for quotas without limit.
+	unlimited = -1
+	kiB       = 1024
+)
+
+// ConvertTo converts this CephUser to the hub version.
+func (src *CephUser) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.CephUser)
+
+	p := src.Spec.ForProvider
+	q := UserQuota{}
+	if p.Quota != nil {
+		q = *p.Quota
+	}
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.ResourceSpec = src.Spec.ResourceSpec
+	dst.Spec.ForProvider = v1alpha1.CephUserParameters{
+		UID:                 &p.UID,
+		Tenant:              stringPtr(p.Tenant),
+		DisplayedName:       stringPtr(p.DisplayName),
+		UserQuotaMaxBuckets: q.MaxBuckets,
+		UserQuotaMaxSizeKB:  quantityToKB(q.MaxSize),
+		UserQuotaMaxObjects: quantityToCount(q.MaxObjects),
+		Email:               stringPtr(p.Email),
+		OpMask:              stringPtr(p.OpMask),
+		System:              p.System,
+		DefaultPlacement:    stringPtr(p.DefaultPlacement),
+		DefaultStorageClass: stringPtr(p.DefaultStorageClass),
+	}
+	if v := p.Credentials.Vault; v != nil {
+		dst.Spec.ForProvider.VaultCredentialsStore = &v1alpha1.VaultConfig{
+			KVVersion:          v.KVVersion,
+			Address:            v.Address,
+			Name:               v.Name,
+			ServiceAccountName: v.ServiceAccountName,
+			MountPath:          v.MountPath,
+			SecretPath:         v.SecretPath,
+			SecretPathTemplate: v.SecretPathTemplate,
+			Auth:               vaultAuthToHub(v.Auth),
+			Namespace:          v.Namespace,
+			TLS:                (*v1alpha1.VaultTLSConfig)(v.TLS),
+			KVDeletionPolicy:   v1alpha1.KVDeletionPolicy(v.KVDeletionPolicy),
+			CheckAndSet:        v.CheckAndSet,
+		}
+	}
+	dst.Spec.ForProvider.CredentialsTemplate = p.Credentials.Template
+	if sc := p.Credentials.Secret; sc != nil {
+		dst.Spec.ForProvider.SecretCredentialsStore = &v1alpha1.SecretStoreConfig{
+			Namespace: sc.Namespace,
+			Name:      sc.Name,
+		}
+	}
+	if fc := p.Credentials.File; fc != nil {
+		dst.Spec.ForProvider.FileCredentialsStore = &v1alpha1.FileStoreConfig{
+			Path:                   fc.Path,
+			EncryptionKeySecretRef: fc.EncryptionKeySecretRef,
+		}
+	}
+	dst.Status.ResourceStatus = src.Status.ResourceStatus
+	dst.Status.AtProvider = v1alpha1.CephUserObservation{
+		UID:         src.Status.AtProvider.UID,
+		Tenant:      src.Status.AtProvider.Tenant,
+		Credentials: credentialsObservationToHub(src.Status.AtProvider.Credentials),
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version to this CephUser.
+func (dst *CephUser) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.CephUser)
+
+	p := src.Spec.ForProvider
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.ResourceSpec = src.Spec.ResourceSpec
+	dst.Spec.ForProvider = CephUserParameters{
+		UID:                 stringValue(p.UID),
+		Tenant:              stringValue(p.Tenant),
+		DisplayName:         stringValue(p.DisplayedName),
+		Email:               stringValue(p.Email),
+		OpMask:              stringValue(p.OpMask),
+		System:              p.System,
+		DefaultPlacement:    stringValue(p.DefaultPlacement),
+		DefaultStorageClass: stringValue(p.DefaultStorageClass),
+	}
+	q := UserQuota{
+		MaxBuckets: p.UserQuotaMaxBuckets,
+		MaxSize:    kbToQuantity(p.UserQuotaMaxSizeKB),
+		MaxObjects: countToQuantity(p.UserQuotaMaxObjects),
+	}
+	if q != (UserQuota{}) {
+		dst.Spec.ForProvider.Quota = &q
+	}
+	if v := p.VaultCredentialsStore; v != nil {
+		dst.Spec.ForProvider.Credentials.Vault = &VaultConfig{
+			KVVersion:          v.KVVersion,
+			Address:            v.Address,
+			Name:               v.Name,
+			ServiceAccountName: v.ServiceAccountName,
+			MountPath:          v.MountPath,
+			SecretPath:         v.SecretPath,
+			SecretPathTemplate: v.SecretPathTemplate,
+			Auth:               vaultAuthFromHub(v.Auth),
+			Namespace:          v.Namespace,
+			TLS:                (*VaultTLSConfig)(v.TLS),
+			KVDeletionPolicy:   KVDeletionPolicy(v.KVDeletionPolicy),
+			CheckAndSet:        v.CheckAndSet,
+		}
+	}
+	dst.Spec.ForProvider.Credentials.Template = p.CredentialsTemplate
+	if sc := p.SecretCredentialsStore; sc != nil {
+		dst.Spec.ForProvider.Credentials.Secret = &SecretStoreConfig{
+			Namespace: sc.Namespace,
+			Name:      sc.Name,
+		}
+	}
+	if fc := p.FileCredentialsStore; fc != nil {
+		dst.Spec.ForProvider.Credentials.File = &FileStoreConfig{
+			Path:                   fc.Path,
+			EncryptionKeySecretRef: fc.EncryptionKeySecretRef,
+		}
+	}
+	dst.Status.ResourceStatus = src.Status.ResourceStatus
+	dst.Status.AtProvider = CephUserObservation{
+		UID:         src.Status.AtProvider.UID,
+		Tenant:      src.Status.AtProvider.Tenant,
+		Credentials: credentialsObservationFromHub(src.Status.AtProvider.Credentials),
+	}
+	return nil
+}
+
+func vaultAuthToHub(a *VaultAuth) *v1alpha1.VaultAuth {
+	if a == nil {
+		return nil
+	}
+	out := &v1alpha1.VaultAuth{
+		Method:    v1alpha1.VaultAuthMethod(a.Method),
+		MountPath: a.MountPath,
+	}
+	if a.AppRole != nil {
+		out.AppRole = &v1alpha1.VaultAppRoleAuth{
+			RoleIDSecretRef:   a.AppRole.RoleIDSecretRef,
+			SecretIDSecretRef: a.AppRole.SecretIDSecretRef,
+		}
+	}
+	if a.JWT != nil {
+		out.JWT = &v1alpha1.VaultJWTAuth{
+			Role:      a.JWT.Role,
+			TokenPath: a.JWT.TokenPath,
+			Audience:  a.JWT.Audience,
+		}
+	}
+	if a.TokenFile != nil {
+		out.TokenFile = &v1alpha1.VaultTokenFileAuth{Path: a.TokenFile.Path}
+	}
+	return out
+}
+
+func vaultAuthFromHub(a *v1alpha1.VaultAuth) *VaultAuth {
+	if a == nil {
+		return nil
+	}
+	out := &VaultAuth{
+		Method:    VaultAuthMethod(a.Method),
+		MountPath: a.MountPath,
+	}
+	if a.AppRole != nil {
+		out.AppRole = &VaultAppRoleAuth{
+			RoleIDSecretRef:   a.AppRole.RoleIDSecretRef,
+			SecretIDSecretRef: a.AppRole.SecretIDSecretRef,
+		}
+	}
+	if a.JWT != nil {
+		out.JWT = &VaultJWTAuth{
+			Role:      a.JWT.Role,
+			TokenPath: a.JWT.TokenPath,
+			Audience:  a.JWT.Audience,
+		}
+	}
+	if a.TokenFile != nil {
+		out.TokenFile = &VaultTokenFileAuth{Path: a.TokenFile.Path}
+	}
+	return out
+}
+
+func credentialsObservationToHub(o *CredentialsObservation) *v1alpha1.CredentialsObservation {
+	if o == nil {
+		return nil
+	}
+	return &v1alpha1.CredentialsObservation{
+		AccessKeyID:     o.AccessKeyID,
+		LastWrittenTime: o.LastWrittenTime,
+		Vault:           (*v1alpha1.VaultCredentialsObservation)(o.Vault),
+	}
+}
+
+func credentialsObservationFromHub(o *v1alpha1.CredentialsObservation) *CredentialsObservation {
+	if o == nil {
+		return nil
+	}
+	return &CredentialsObservation{
+		AccessKeyID:     o.AccessKeyID,
+		LastWrittenTime: o.LastWrittenTime,
+		Vault:           (*VaultCredentialsObservation)(o.Vault),
+	}
+}
+
+// quantityToKB returns the supplied size in KiB, rounded up. Unset sizes stay
+// unset, so that they are late-initialized from radosgw. Negative sizes are
+// passed through unchanged, for the validating webhook to reject all but -1
+// (unlimited); conversion cannot fail with a useful error. Sizes that are not
+// a whole number of KiB, which would not convert back unchanged, are rejected
+// by the validating webhook of this version before they are converted.
+func quantityToKB(q *resource.Quantity) *int {
+	n := quantityToCount(q)
+	if n == nil || *n < 0 {
+		return intPtr(n)
+	}
+	kb := int((*n + kiB - 1) / kiB)
+	return &kb
+}
+
+// quantityToCount returns the supplied quantity as an integer, rounded up.
+// Unset quantities stay unset.
+func quantityToCount(q *resource.Quantity) *int64 {
+	if q == nil {
+		return nil
+	}
+	n := q.Value()
+	return &n
+}
+
+// kbToQuantity returns the supplied number of KiB as a size. -1 (unlimited)
+// stays -1, so that it survives a round trip through the hub.
+func kbToQuantity(kb *int) *resource.Quantity {
+	switch {
+	case kb == nil:
+		return nil
+	case *kb < 0:
+		return resource.NewQuantity(int64(*kb), resource.DecimalSI)
+	}
+	return resource.NewQuantity(int64(*kb)*kiB, resource.BinarySI)
+}
+
+func countToQuantity(n *int64) *resource.Quantity {
+	if n == nil {
+		return nil
+	}
+	return resource.NewQuantity(*n, resource.DecimalSI)
+}
+
+func intPtr(n *int64) *int {
+	if n == nil {
+		return nil
+	}
+	i := int(*n)
+	return &i
+}
+
+// stringPtr returns nil for empty strings, which v1alpha1 uses for unset
+// fields.
+func stringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
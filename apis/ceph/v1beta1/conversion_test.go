@@ -0,0 +1,294 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+func TestConvertTo(t *testing.T) {
+	uid := "user"
+	tenant := "team"
+	unlimitedKB := -1
+	unlimitedObjects := int64(-1)
+	maxBuckets := 5
+	sizeKB := 200 * 1024 * 1024
+	roundedKB := 2
+	objects := int64(1000000)
+	negativeSize := -1024 * 1024 * 1024
+	negativeObjects := int64(-5)
+
+	cases := map[string]struct {
+		reason string
+		params CephUserParameters
+		want   v1alpha1.CephUserParameters
+	}{
+		"NoQuota": {
+			reason: "An omitted quota should stay unset, so that it is late-initialized.",
+			params: CephUserParameters{UID: uid},
+			want:   v1alpha1.CephUserParameters{UID: &uid},
+		},
+		"Unlimited": {
+			reason: "Quotas of -1 should convert to unlimited.",
+			params: CephUserParameters{
+				UID: uid,
+				Quota: &UserQuota{
+					MaxSize:    resource.NewQuantity(-1, resource.DecimalSI),
+					MaxObjects: resource.NewQuantity(-1, resource.DecimalSI),
+				},
+			},
+			want: v1alpha1.CephUserParameters{
+				UID:                 &uid,
+				UserQuotaMaxSizeKB:  &unlimitedKB,
+				UserQuotaMaxObjects: &unlimitedObjects,
+			},
+		},
+		"Quantities": {
+			reason: "Quantities should convert to KB and object counts.",
+			params: CephUserParameters{
+				UID:    uid,
+				Tenant: tenant,
+				Quota: &UserQuota{
+					MaxBuckets: &maxBuckets,
+					MaxSize:    quantity("200Gi"),
+					MaxObjects: quantity("1M"),
+				},
+			},
+			want: v1alpha1.CephUserParameters{
+				UID:                 &uid,
+				Tenant:              &tenant,
+				UserQuotaMaxBuckets: &maxBuckets,
+				UserQuotaMaxSizeKB:  &sizeKB,
+				UserQuotaMaxObjects: &objects,
+			},
+		},
+		"RoundUp": {
+			reason: "Sizes that are not a multiple of a KiB should be rounded up.",
+			params: CephUserParameters{
+				UID:   uid,
+				Quota: &UserQuota{MaxSize: quantity("1025"), MaxObjects: quantity("1M")},
+			},
+			want: v1alpha1.CephUserParameters{
+				UID:                 &uid,
+				UserQuotaMaxSizeKB:  &roundedKB,
+				UserQuotaMaxObjects: &objects,
+			},
+		},
+		"VaultAuth": {
+			reason: "The Vault auth config should be carried over.",
+			params: CephUserParameters{
+				UID: uid,
+				Credentials: CredentialsConfig{Vault: &VaultConfig{
+					KVVersion: "2",
+					Auth: &VaultAuth{
+						Method: VaultAuthJWT,
+						JWT:    &VaultJWTAuth{Role: "ceph", Audience: "vault"},
+					},
+				}},
+			},
+			want: v1alpha1.CephUserParameters{
+				UID: &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{
+					KVVersion: "2",
+					Auth: &v1alpha1.VaultAuth{
+						Method: v1alpha1.VaultAuthJWT,
+						JWT:    &v1alpha1.VaultJWTAuth{Role: "ceph", Audience: "vault"},
+					},
+				},
+			},
+		},
+		"NegativeSize": {
+			reason: "Negative sizes should be passed through, for the validating webhook to reject.",
+			params: CephUserParameters{
+				UID:   uid,
+				Quota: &UserQuota{MaxSize: quantity("-1Gi")},
+			},
+			want: v1alpha1.CephUserParameters{
+				UID:                &uid,
+				UserQuotaMaxSizeKB: &negativeSize,
+			},
+		},
+		"NegativeObjects": {
+			reason: "Negative object counts should be passed through, for the validating webhook to reject.",
+			params: CephUserParameters{
+				UID:   uid,
+				Quota: &UserQuota{MaxObjects: quantity("-5")},
+			},
+			want: v1alpha1.CephUserParameters{
+				UID:                 &uid,
+				UserQuotaMaxObjects: &negativeObjects,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			src := &CephUser{Spec: CephUserSpec{ForProvider: tc.params}}
+			dst := &v1alpha1.CephUser{}
+			if err := src.ConvertTo(dst); err != nil {
+				t.Fatalf("\n%s\nConvertTo(...): unexpected error: %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, dst.Spec.ForProvider); diff != "" {
+				t.Errorf("\n%s\nConvertTo(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConvertFrom(t *testing.T) {
+	uid := "user"
+	unlimitedKB := -1
+	unlimitedObjects := int64(-1)
+	sizeKB := 200 * 1024 * 1024
+	objects := int64(1000000)
+
+	cases := map[string]struct {
+		reason string
+		params v1alpha1.CephUserParameters
+		want   CephUserParameters
+	}{
+		"Unset": {
+			reason: "Unset quotas should result in no quota block.",
+			params: v1alpha1.CephUserParameters{UID: &uid},
+			want:   CephUserParameters{UID: uid},
+		},
+		"Unlimited": {
+			reason: "Unlimited quotas should convert to -1, so that they survive a round trip.",
+			params: v1alpha1.CephUserParameters{
+				UID:                 &uid,
+				UserQuotaMaxSizeKB:  &unlimitedKB,
+				UserQuotaMaxObjects: &unlimitedObjects,
+			},
+			want: CephUserParameters{
+				UID: uid,
+				Quota: &UserQuota{
+					MaxSize:    quantity("-1"),
+					MaxObjects: quantity("-1"),
+				},
+			},
+		},
+		"Quantities": {
+			reason: "KB and object counts should convert to quantities.",
+			params: v1alpha1.CephUserParameters{
+				UID:                 &uid,
+				UserQuotaMaxSizeKB:  &sizeKB,
+				UserQuotaMaxObjects: &objects,
+			},
+			want: CephUserParameters{
+				UID: uid,
+				Quota: &UserQuota{
+					MaxSize:    quantity("200Gi"),
+					MaxObjects: quantity("1M"),
+				},
+			},
+		},
+		"Credentials": {
+			reason: "The Vault config should move into the credentials block.",
+			params: v1alpha1.CephUserParameters{
+				UID:                   &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret"},
+			},
+			want: CephUserParameters{
+				UID:         uid,
+				Credentials: CredentialsConfig{Vault: &VaultConfig{KVVersion: "2", MountPath: "secret"}},
+			},
+		},
+		"VaultAuth": {
+			reason: "The Vault auth config should be carried over.",
+			params: v1alpha1.CephUserParameters{
+				UID: &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{
+					KVVersion: "1",
+					Auth: &v1alpha1.VaultAuth{
+						Method:    v1alpha1.VaultAuthTokenFile,
+						TokenFile: &v1alpha1.VaultTokenFileAuth{Path: "/vault/token"},
+					},
+				},
+			},
+			want: CephUserParameters{
+				UID: uid,
+				Credentials: CredentialsConfig{Vault: &VaultConfig{
+					KVVersion: "1",
+					Auth: &VaultAuth{
+						Method:    VaultAuthTokenFile,
+						TokenFile: &VaultTokenFileAuth{Path: "/vault/token"},
+					},
+				}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			src := &v1alpha1.CephUser{Spec: v1alpha1.CephUserSpec{ForProvider: tc.params}}
+			dst := &CephUser{}
+			if err := dst.ConvertFrom(src); err != nil {
+				t.Fatalf("\n%s\nConvertFrom(...): unexpected error: %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, dst.Spec.ForProvider, cmp.Comparer(quantityEqual)); diff != "" {
+				t.Errorf("\n%s\nConvertFrom(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func quantity(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+func quantityEqual(a, b resource.Quantity) bool {
+	return a.Cmp(b) == 0 && a.String() == b.String()
+}
+
+func TestConvertStatus(t *testing.T) {
+	version := 3
+	written := metav1.Now()
+	obs := CephUserObservation{
+		UID:    "team$user",
+		Tenant: "team",
+		Credentials: &CredentialsObservation{
+			AccessKeyID:     "AK",
+			LastWrittenTime: &written,
+			Vault: &VaultCredentialsObservation{
+				MountPath: "secret",
+				Path:      "crossplane/cl01/users/team/user",
+				KVVersion: "2",
+				Version:   &version,
+			},
+		},
+	}
+
+	src := &CephUser{Status: CephUserStatus{AtProvider: obs}}
+	hub := &v1alpha1.CephUser{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	dst := &CephUser{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(obs, dst.Status.AtProvider); diff != "" {
+		t.Errorf("\nThe observed credentials should survive a round trip through the hub.\n-want, +got:\n%s\n", diff)
+	}
+}
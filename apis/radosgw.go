@@ -21,6 +21,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 
 	cephv1alpha1 "github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	cephv1beta1 "github.com/daanvinken/provider-radosgw/apis/ceph/v1beta1"
 	radosgwv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
 )
 
@@ -29,6 +30,7 @@ func init() {
 	AddToSchemes = append(AddToSchemes,
 		radosgwv1alpha1.SchemeBuilder.AddToScheme,
 		cephv1alpha1.SchemeBuilder.AddToScheme,
+		cephv1beta1.SchemeBuilder.AddToScheme,
 	)
 }
 
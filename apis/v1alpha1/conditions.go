@@ -0,0 +1,174 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+)
+
+// Condition types of a ProviderConfig.
+const (
+	// TypeCircuitClosed indicates whether the provider sends requests to the
+	// radosgw of a ProviderConfig. Requests are suspended for a while when
+	// radosgw keeps failing them or asks to slow down.
+	TypeCircuitClosed xpv1.ConditionType = "CircuitClosed"
+
+	// TypeReachable indicates whether the radosgw of a ProviderConfig
+	// answered its latest health check.
+	TypeReachable xpv1.ConditionType = "Reachable"
+
+	// TypeAuthenticated indicates whether the radosgw of a ProviderConfig
+	// accepted its admin credentials in its latest health check.
+	TypeAuthenticated xpv1.ConditionType = "Authenticated"
+)
+
+// Reasons a ProviderConfig is or is not in a condition.
+const (
+	ReasonCircuitClosed xpv1.ConditionReason = "Closed"
+	ReasonCircuitOpen   xpv1.ConditionReason = "Open"
+
+	ReasonAnswered    xpv1.ConditionReason = "Answered"
+	ReasonUnreachable xpv1.ConditionReason = "Unreachable"
+
+	ReasonAccepted           xpv1.ConditionReason = "Accepted"
+	ReasonMissingCapability  xpv1.ConditionReason = "MissingCapability"
+	ReasonRejected           xpv1.ConditionReason = "Rejected"
+	ReasonMissingCredentials xpv1.ConditionReason = "MissingCredentials"
+)
+
+// CircuitClosed returns a condition that indicates requests are sent to the
+// radosgw of a ProviderConfig.
+func CircuitClosed() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeCircuitClosed,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonCircuitClosed,
+	}
+}
+
+// CircuitOpen returns a condition that indicates requests to the radosgw of a
+// ProviderConfig are suspended, for the supplied reason.
+func CircuitOpen(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeCircuitClosed,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonCircuitOpen,
+		Message:            msg,
+	}
+}
+
+// Reachable returns a condition that indicates the radosgw of a ProviderConfig
+// answered its health check.
+func Reachable() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeReachable,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAnswered,
+	}
+}
+
+// Unreachable returns a condition that indicates the radosgw of a
+// ProviderConfig did not answer its health check, for the supplied reason.
+func Unreachable(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeReachable,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonUnreachable,
+		Message:            msg,
+	}
+}
+
+// ReachabilityUnknown returns a condition that indicates whether the radosgw
+// of a ProviderConfig answers is unknown, because its health check could not
+// be made without admin credentials, for the supplied reason.
+func ReachabilityUnknown(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeReachable,
+		Status:             corev1.ConditionUnknown,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonMissingCredentials,
+		Message:            msg,
+	}
+}
+
+// Authenticated returns a condition that indicates the radosgw of a
+// ProviderConfig accepted its admin credentials.
+func Authenticated() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAuthenticated,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAccepted,
+	}
+}
+
+// MissingCapability returns a condition that indicates the radosgw of a
+// ProviderConfig accepted its admin credentials, but denied them a capability
+// the health check requires, for the supplied reason.
+func MissingCapability(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAuthenticated,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonMissingCapability,
+		Message:            msg,
+	}
+}
+
+// AuthenticationUnknown returns a condition that indicates whether the radosgw
+// of a ProviderConfig accepts its admin credentials is unknown, because it did
+// not answer its health check for the supplied reason.
+func AuthenticationUnknown(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAuthenticated,
+		Status:             corev1.ConditionUnknown,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonUnreachable,
+		Message:            msg,
+	}
+}
+
+// Unauthenticated returns a condition that indicates the radosgw of a
+// ProviderConfig rejected its admin credentials, for the supplied reason.
+func Unauthenticated(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAuthenticated,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRejected,
+		Message:            msg,
+	}
+}
+
+// MissingCredentials returns a condition that indicates the admin credentials
+// of a ProviderConfig could not be read, for the supplied reason.
+func MissingCredentials(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeAuthenticated,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonMissingCredentials,
+		Message:            msg,
+	}
+}
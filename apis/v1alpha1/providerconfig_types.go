@@ -26,11 +26,47 @@ import (
 )
 
 // A ProviderConfigSpec defines the desired state of a ProviderConfig.
+// +kubebuilder:validation:XValidation:rule="has(self.hostname) || has(self.endpoints)",message="either hostname or endpoints must be specified"
 type ProviderConfigSpec struct {
-	// The URL for your radosgw endpoint.
-	HostName string `json:"hostname"`
+	// The URL for your radosgw endpoint. Either it or Endpoints must be
+	// specified.
+	// +optional
+	HostName string `json:"hostname,omitempty"`
+	// The URLs of the radosgw gateways of the cluster, in addition to
+	// HostName. Requests are sent to the first gateway that is up, HostName
+	// first, and fail over to the next one when it cannot be reached.
+	// +kubebuilder:validation:MinItems=1
+	// +optional
+	Endpoints []string `json:"endpoints,omitempty"`
 	// Map of tags associated with the provider config.
 	Tags map[string]string `json:"tags,omitempty"`
+	// The tenant CephUsers are created in when they do not specify one.
+	// +optional
+	DefaultTenant *string `json:"defaultTenant,omitempty"`
+	// Use the namespace of the claim a CephUser was created for as its tenant
+	// when it does not specify one. Takes precedence over DefaultTenant.
+	// +optional
+	TenantFromClaimNamespace bool `json:"tenantFromClaimNamespace,omitempty"`
+	// The S3 region of the cluster, i.e. the name of its zonegroup, as made
+	// available to credentials templates. Defaults to 'default'.
+	// +optional
+	Region *string `json:"region,omitempty"`
+	// Limits the requests made to the Admin Ops API of the cluster.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+}
+
+// A RateLimit limits the requests made to the Admin Ops API of a cluster.
+type RateLimit struct {
+	// The number of requests per second. Defaults to 50.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RequestsPerSecond *int `json:"requestsPerSecond,omitempty"`
+	// The number of requests that may be made at once in excess of the
+	// rate. Defaults to twice the number of requests per second.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Burst *int `json:"burst,omitempty"`
 }
 
 // ProviderCredentials required to authenticate.
@@ -45,13 +81,24 @@ type ProviderCredentials struct {
 // A ProviderConfigStatus reflects the observed state of a ProviderConfig.
 type ProviderConfigStatus struct {
 	xpv1.ProviderConfigStatus `json:",inline"`
+
+	// The id of the Ceph cluster radosgw stores its data in, as it last
+	// reported it.
+	// +optional
+	FSID string `json:"fsid,omitempty"`
+	// When radosgw last answered a health check with the admin credentials.
+	// +optional
+	LastSuccessfulCheck *metav1.Time `json:"lastSuccessfulCheck,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 
 // A ProviderConfig configures a radosgw provider.
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="REACHABLE",type="string",JSONPath=".status.conditions[?(@.type=='Reachable')].status"
+// +kubebuilder:printcolumn:name="AUTHENTICATED",type="string",JSONPath=".status.conditions[?(@.type=='Authenticated')].status"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:printcolumn:name="FSID",type="string",JSONPath=".status.fsid",priority=1
 // +kubebuilder:printcolumn:name="SECRET-NAME",type="string",JSONPath=".spec.credentials.secretRef.name",priority=1
 // +kubebuilder:resource:scope=Cluster
 type ProviderConfig struct {
@@ -61,6 +61,9 @@ CROSSPLANE_NAMESPACE="crossplane-system"
 if [ "$skipcleanup" != true ]; then
   function cleanup {
     echo_step "Cleaning up..."
+    if [ -n "${FAKE_RADOSGW_PID}" ]; then
+      kill "${FAKE_RADOSGW_PID}" || true
+    fi
     export KUBECONFIG=
     "${KIND}" delete cluster --name="${K8S_CLUSTER}"
   }
@@ -146,12 +149,91 @@ echo
 # container is exposed to the crossplane pod
 "${HELM3}" install crossplane --namespace crossplane-system crossplane-stable/crossplane --version ${chart_version} --wait --set packageCache.pvc=package-cache
 
+# start an in-memory radosgw on the host, reachable from the kind cluster
+# through the gateway of its docker network
+FAKE_RADOSGW_PORT="${FAKE_RADOSGW_PORT:-8480}"
+FAKE_RADOSGW_ACCESS_KEY="${FAKE_RADOSGW_ACCESS_KEY:-FAKERADOSGWADMIN}"
+FAKE_RADOSGW_SECRET_KEY="${FAKE_RADOSGW_SECRET_KEY:-fake-radosgw-secret}"
+echo_step "starting fake radosgw on port ${FAKE_RADOSGW_PORT}"
+"${GO:-go}" build -o "${projectdir}/.work/fake-radosgw" "${projectdir}/cmd/fake-radosgw"
+"${projectdir}/.work/fake-radosgw" --address ":${FAKE_RADOSGW_PORT}" \
+  --access-key "${FAKE_RADOSGW_ACCESS_KEY}" --secret-key "${FAKE_RADOSGW_SECRET_KEY}" &
+FAKE_RADOSGW_PID=$!
+
+KIND_GATEWAY="$(docker network inspect kind -f '{{range .IPAM.Config}}{{if .Gateway}}{{.Gateway}} {{end}}{{end}}' | awk '{print $1}')"
+FAKE_RADOSGW_ENDPOINT="http://${KIND_GATEWAY}:${FAKE_RADOSGW_PORT}"
+export FAKE_RADOSGW_ENDPOINT FAKE_RADOSGW_ACCESS_KEY FAKE_RADOSGW_SECRET_KEY
+
+# unsigned requests are denied, which is enough to know it is serving
+echo_step "waiting for fake radosgw to be reachable from the cluster at ${FAKE_RADOSGW_ENDPOINT}"
+timeout=30
+current=0
+step=1
+until [[ "$(docker exec "${K8S_CLUSTER}-control-plane" curl -s -o /dev/null -w '%{http_code}' "${FAKE_RADOSGW_ENDPOINT}/admin/user")" == "403" ]]; do
+  current=$((current+step))
+  if [[ $current -ge $timeout ]]; then
+    echo_error "timeout of ${timeout}s has been reached"
+  fi
+  sleep $step
+done
+
+# start a vault dev server in the cluster holding the admin credentials of the
+# fake radosgw, which is where the provider reads them from
+VAULT_NAMESPACE="vault-system"
+echo_step "starting vault dev server in \"${VAULT_NAMESPACE}\" namespace"
+"${KUBECTL}" create ns "${VAULT_NAMESPACE}"
+"${KUBECTL}" -n "${VAULT_NAMESPACE}" run vault --image=hashicorp/vault --port=8200 \
+  --env=VAULT_DEV_ROOT_TOKEN_ID=root --env=VAULT_DEV_LISTEN_ADDRESS=0.0.0.0:8200 --env=SKIP_SETCAP=true
+"${KUBECTL}" -n "${VAULT_NAMESPACE}" expose pod vault --port=8200
+"${KUBECTL}" -n "${VAULT_NAMESPACE}" wait pod/vault --for=condition=ready --timeout=120s
+
+vault_cli(){
+  "${KUBECTL}" -n "${VAULT_NAMESPACE}" exec vault -- env VAULT_ADDR=http://127.0.0.1:8200 VAULT_TOKEN=root vault "$@"
+}
+timeout=30
+current=0
+step=1
+until vault_cli status > /dev/null; do
+  current=$((current+step))
+  if [[ $current -ge $timeout ]]; then
+    echo_error "timeout of ${timeout}s has been reached"
+  fi
+  sleep $step
+done
+vault_cli secrets enable -path=k8s-cl03 -version=1 kv
+vault_cli kv put k8s-cl03/crossplane/ceph/admin-credentials/fake-radosgw \
+  access_key="${FAKE_RADOSGW_ACCESS_KEY}" secret_key="${FAKE_RADOSGW_SECRET_KEY}"
+
 # ----------- integration tests
 echo_step "--- INTEGRATION TESTS ---"
 
 # install package
 echo_step "installing ${PROJECT_NAME} into \"${CROSSPLANE_NAMESPACE}\" namespace"
 
+# the provider logs in to vault with the root token of the dev server
+RUNTIME_CONFIG_YAML="$( cat <<EOF
+apiVersion: pkg.crossplane.io/v1beta1
+kind: DeploymentRuntimeConfig
+metadata:
+  name: "${PACKAGE_NAME}"
+spec:
+  deploymentTemplate:
+    spec:
+      selector: {}
+      template:
+        spec:
+          containers:
+          - name: package-runtime
+            env:
+            - name: VAULT_ADDR
+              value: "http://vault.${VAULT_NAMESPACE}.svc:8200"
+            - name: VAULT_TOKEN
+              value: root
+EOF
+)"
+
+echo "${RUNTIME_CONFIG_YAML}" | "${KUBECTL}" apply -f -
+
 INSTALL_YAML="$( cat <<EOF
 apiVersion: pkg.crossplane.io/v1
 kind: Provider
@@ -160,6 +242,8 @@ metadata:
 spec:
   package: "${PACKAGE_NAME}"
   packagePullPolicy: Never
+  runtimeConfigRef:
+    name: "${PACKAGE_NAME}"
 EOF
 )"
 
@@ -173,6 +257,45 @@ echo_step "waiting for provider to be installed"
 
 kubectl wait "provider.pkg.crossplane.io/${PACKAGE_NAME}" --for=condition=healthy --timeout=180s
 
+echo_step "creating a CephUser on the fake radosgw"
+
+PROVIDER_CONFIG_YAML="$( cat <<EOF
+apiVersion: radosgw.crossplane.io/v1alpha1
+kind: ProviderConfig
+metadata:
+  name: fake-radosgw
+spec:
+  hostname: "${FAKE_RADOSGW_ENDPOINT}"
+EOF
+)"
+
+CEPH_USER_YAML="$( cat <<EOF
+apiVersion: ceph.radosgw.crossplane.io/v1alpha1
+kind: CephUser
+metadata:
+  name: integration-test
+spec:
+  forProvider:
+    uid: integration-test
+    secretCredentialsStore:
+      namespace: "${CROSSPLANE_NAMESPACE}"
+      name: integration-test-credentials
+  providerConfigRef:
+    name: fake-radosgw
+EOF
+)"
+
+echo "${PROVIDER_CONFIG_YAML}" | "${KUBECTL}" apply -f -
+echo "${CEPH_USER_YAML}" | "${KUBECTL}" apply -f -
+
+echo_step "waiting for CephUser to be ready"
+kubectl wait cephuser.ceph.radosgw.crossplane.io/integration-test --for=condition=ready --timeout=180s
+"${KUBECTL}" -n "${CROSSPLANE_NAMESPACE}" get secret integration-test-credentials
+
+echo_step "deleting CephUser"
+echo "${CEPH_USER_YAML}" | "${KUBECTL}" delete -f - --timeout=180s
+echo "${PROVIDER_CONFIG_YAML}" | "${KUBECTL}" delete -f - --timeout=60s
+
 echo_step "uninstalling ${PROJECT_NAME}"
 
 echo "${INSTALL_YAML}" | "${KUBECTL}" delete -f -
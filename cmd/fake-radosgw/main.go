@@ -0,0 +1,66 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// fake-radosgw serves the radosgw Admin Ops API from memory, for testing the
+// provider without a Ceph cluster.
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw/fake"
+)
+
+func main() {
+	var (
+		app       = kingpin.New(filepath.Base(os.Args[0]), "An in-memory radosgw Admin Ops API for testing.").DefaultEnvars()
+		debug     = app.Flag("debug", "Run with debug logging.").Short('d').Bool()
+		address   = app.Flag("address", "The address to serve the Admin Ops API on.").Default(":8480").String()
+		adminUID  = app.Flag("admin-uid", "The id of the admin user.").Default("admin").String()
+		accessKey = app.Flag("access-key", "The S3 access key of the admin user.").Required().String()
+		secretKey = app.Flag("secret-key", "The S3 secret key of the admin user.").Required().String()
+	)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	log := logging.NewLogrLogger(zap.New(zap.UseDevMode(*debug)).WithName("fake-radosgw"))
+
+	rgw := fake.NewClient()
+	kingpin.FatalIfError(rgw.AddAdmin(*adminUID, *accessKey, *secretKey), "Cannot create admin user")
+
+	srv := &http.Server{
+		Addr:              *address,
+		Handler:           logRequests(log, fake.NewServer(rgw)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Info("Serving the radosgw Admin Ops API", "address", *address, "admin", *adminUID)
+	kingpin.FatalIfError(srv.ListenAndServe(), "Cannot serve the radosgw Admin Ops API")
+}
+
+// logRequests logs every request at debug level.
+func logRequests(log logging.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Debug("Request", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery)
+		h.ServeHTTP(w, r)
+	})
+}
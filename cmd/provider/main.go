@@ -30,6 +30,7 @@ import (
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
@@ -41,6 +42,7 @@ import (
 	"github.com/daanvinken/provider-radosgw/apis"
 	"github.com/daanvinken/provider-radosgw/apis/v1alpha1"
 	radosgw "github.com/daanvinken/provider-radosgw/internal/controller"
+	radosgwwebhook "github.com/daanvinken/provider-radosgw/internal/webhook"
 )
 
 func main() {
@@ -59,6 +61,9 @@ func main() {
 		namespace                  = app.Flag("namespace", "Namespace used to set as default scope in default secret store config.").Default("crossplane-system").Envar("POD_NAMESPACE").String()
 		enableExternalSecretStores = app.Flag("enable-external-secret-stores", "Enable support for ExternalSecretStores.").Default("false").Envar("ENABLE_EXTERNAL_SECRET_STORES").Bool()
 		enableManagementPolicies   = app.Flag("enable-management-policies", "Enable support for Management Policies.").Default("false").Envar("ENABLE_MANAGEMENT_POLICIES").Bool()
+
+		webhookTLSCertDir = app.Flag("webhook-tls-cert-dir", "The directory of the TLS certificate used by the webhook server. It should contain tls.crt and tls.key files. The webhook server is disabled when not set.").Envar("WEBHOOK_TLS_CERT_DIR").String()
+		webhookPort       = app.Flag("webhook-port", "The port the webhook server listens on.").Default("9443").Int()
 	)
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
@@ -91,6 +96,11 @@ func main() {
 		LeaderElectionResourceLock: resourcelock.LeasesResourceLock,
 		LeaseDuration:              func() *time.Duration { d := 60 * time.Second; return &d }(),
 		RenewDeadline:              func() *time.Duration { d := 50 * time.Second; return &d }(),
+
+		WebhookServer: webhook.NewServer(webhook.Options{
+			CertDir: *webhookTLSCertDir,
+			Port:    *webhookPort,
+		}),
 	})
 	kingpin.FatalIfError(err, "Cannot create controller manager")
 	kingpin.FatalIfError(apis.AddToScheme(mgr.GetScheme()), "Cannot add radosgw APIs to scheme")
@@ -128,5 +138,14 @@ func main() {
 	}
 
 	kingpin.FatalIfError(radosgw.Setup(mgr, o), "Cannot setup radosgw controllers")
+
+	// CephUser is served in more than one version, which requires the
+	// conversion webhook. Crossplane mounts the certificates of the webhook
+	// server when it installs the package.
+	if *webhookTLSCertDir != "" {
+		kingpin.FatalIfError(radosgwwebhook.Setup(mgr), "Cannot setup radosgw webhooks")
+	} else {
+		log.Info("Webhook server disabled, only the storage version of resources can be used", "flag", "webhook-tls-cert-dir")
+	}
 	kingpin.FatalIfError(mgr.Start(ctrl.SetupSignalHandler()), "Cannot start controller manager")
 }
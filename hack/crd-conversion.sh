@@ -0,0 +1,20 @@
+#!/usr/bin/env bash
+# Enables webhook conversion on the supplied CRDs. controller-gen has no marker
+# for this. Crossplane fills in the client config of the webhook when it
+# installs the package.
+set -e
+
+for crd in "$@"; do
+  awk '
+    { print }
+    /^spec:$/ && !done {
+      print "  conversion:"
+      print "    strategy: Webhook"
+      print "    webhook:"
+      print "      conversionReviewVersions:"
+      print "      - v1"
+      done = 1
+    }
+  ' "${crd}" > "${crd}.tmp"
+  mv "${crd}.tmp" "${crd}"
+done
@@ -0,0 +1,147 @@
+package credentials
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+const (
+	errGetKeySecret   = "cannot get encryption key Secret"
+	errMissingKey     = "encryption key Secret has no such key"
+	errPathOutsideDir = "path must be relative to, and within, the credentials directory"
+	errEncrypt        = "cannot encrypt credentials"
+	errDecrypt        = "cannot decrypt credentials"
+	errWriteFile      = "cannot write credentials file"
+	errReadFile       = "cannot read credentials file"
+	errDeleteFile     = "cannot delete credentials file"
+)
+
+// FileStore stores credentials in files on the local filesystem, encrypted
+// with AES-GCM. The encryption key is derived from a passphrase read from a
+// Kubernetes Secret.
+type FileStore struct {
+	kube   client.Reader
+	dir    string
+	config v1alpha1.FileStoreConfig
+}
+
+// NewFileStore returns a Store that writes credentials to the file configured
+// by the supplied FileStoreConfig, within the supplied directory.
+func NewFileStore(kube client.Reader, dir string, config v1alpha1.FileStoreConfig) *FileStore {
+	return &FileStore{kube: kube, dir: dir, config: config}
+}
+
+func (s *FileStore) Write(ctx context.Context, _ *v1alpha1.CephUser, data map[string]string) error {
+	path, err := s.path()
+	if err != nil {
+		return err
+	}
+	aead, err := s.aead(ctx)
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, errEncrypt)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrap(err, errEncrypt)
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(s.config.Path))
+
+	// Write to a temporary file first so readers never see a partial file.
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return errors.Wrap(err, errWriteFile)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0o600); err != nil {
+		return errors.Wrap(err, errWriteFile)
+	}
+	return errors.Wrap(os.Rename(tmp, path), errWriteFile)
+}
+
+func (s *FileStore) Read(ctx context.Context, _ *v1alpha1.CephUser) (map[string]string, error) {
+	path, err := s.path()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := os.ReadFile(path) //nolint:gosec // The path is confined to the credentials directory.
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errReadFile)
+	}
+	aead, err := s.aead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New(errDecrypt)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(s.config.Path))
+	if err != nil {
+		return nil, errors.Wrap(err, errDecrypt)
+	}
+	data := map[string]string{}
+	return data, errors.Wrap(json.Unmarshal(plain, &data), errDecrypt)
+}
+
+func (s *FileStore) Delete(_ context.Context, _ *v1alpha1.CephUser) error {
+	path, err := s.path()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, errDeleteFile)
+	}
+	return nil
+}
+
+// path returns the absolute path of the credentials file, making sure it does
+// not escape the credentials directory.
+func (s *FileStore) path() (string, error) {
+	if filepath.IsAbs(s.config.Path) {
+		return "", errors.New(errPathOutsideDir)
+	}
+	dir := filepath.Clean(s.dir)
+	path := filepath.Join(dir, s.config.Path)
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", errors.New(errPathOutsideDir)
+	}
+	return path, nil
+}
+
+func (s *FileStore) aead(ctx context.Context) (cipher.AEAD, error) {
+	ref := s.config.EncryptionKeySecretRef
+	sec := &corev1.Secret{}
+	if err := s.kube.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, sec); err != nil {
+		return nil, errors.Wrap(err, errGetKeySecret)
+	}
+	passphrase, ok := sec.Data[ref.Key]
+	if !ok || len(passphrase) == 0 {
+		return nil, errors.New(errMissingKey)
+	}
+	key := sha256.Sum256(passphrase)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,94 @@
+package credentials
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+func keySecret(passphrase string) *test.MockClient {
+	return &test.MockClient{
+		MockGet: func(_ context.Context, _ client.ObjectKey, obj client.Object) error {
+			obj.(*corev1.Secret).Data = map[string][]byte{"key": []byte(passphrase)}
+			return nil
+		},
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ref := xpv1.SecretKeySelector{SecretReference: xpv1.SecretReference{Namespace: "ns", Name: "key"}, Key: "key"}
+	data := map[string]string{KeyAccessKey: "access", KeySecretKey: "secret"}
+	cr := &v1alpha1.CephUser{}
+
+	type want struct {
+		read    map[string]string
+		readErr bool
+		err     error
+	}
+
+	cases := map[string]struct {
+		reason   string
+		path     string
+		readWith string
+		want     want
+	}{
+		"RoundTrip": {
+			reason:   "Credentials written should be read back.",
+			path:     "team/user.enc",
+			readWith: "passphrase",
+			want:     want{read: data},
+		},
+		"WrongKey": {
+			reason:   "Credentials should not be readable with another passphrase.",
+			path:     "user.enc",
+			readWith: "other",
+			want:     want{readErr: true},
+		},
+		"OutsideDir": {
+			reason: "Paths escaping the credentials directory should be rejected.",
+			path:   "../user.enc",
+			want:   want{err: errors.New(errPathOutsideDir)},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			config := v1alpha1.FileStoreConfig{Path: tc.path, EncryptionKeySecretRef: ref}
+
+			err := NewFileStore(keySecret("passphrase"), dir, config).Write(context.Background(), cr, data)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Fatalf("\n%s\ns.Write(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+
+			s := NewFileStore(keySecret(tc.readWith), dir, config)
+			got, err := s.Read(context.Background(), cr)
+			if (err != nil) != tc.want.readErr {
+				t.Fatalf("\n%s\ns.Read(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.read, got); err == nil && diff != "" {
+				t.Errorf("\n%s\ns.Read(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+
+			if err := s.Delete(context.Background(), cr); err != nil {
+				t.Errorf("\n%s\ns.Delete(...): unexpected error: %v", tc.reason, err)
+			}
+			got, err = s.Read(context.Background(), cr)
+			if err != nil || got != nil {
+				t.Errorf("\n%s\ns.Read(...) after Delete: want nil, nil, got %v, %v", tc.reason, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package credentials
+
+import (
+	"context"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+const (
+	errGetSecret    = "cannot get credentials Secret"
+	errApplySecret  = "cannot apply credentials Secret"
+	errDeleteSecret = "cannot delete credentials Secret"
+	errSecretOwner  = "credentials Secret already exists and is not owned by this CephUser"
+
+	// LabelKeyCephUser is set on Secrets holding the credentials of a
+	// CephUser to the name of that CephUser.
+	LabelKeyCephUser = "ceph.radosgw.crossplane.io/cephuser"
+)
+
+// SecretStore stores credentials in a Kubernetes Secret.
+type SecretStore struct {
+	kube   client.Client
+	config v1alpha1.SecretStoreConfig
+}
+
+// NewSecretStore returns a Store that writes credentials to the Secret
+// configured by the supplied SecretStoreConfig.
+func NewSecretStore(kube client.Client, config v1alpha1.SecretStoreConfig) *SecretStore {
+	return &SecretStore{kube: kube, config: config}
+}
+
+func (s *SecretStore) Write(ctx context.Context, cr *v1alpha1.CephUser, data map[string]string) error {
+	sec := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: s.config.Namespace, Name: s.config.Name}}
+	_, err := controllerutil.CreateOrUpdate(ctx, s.kube, sec, func() error {
+		// Refuse to overwrite Secrets this CephUser did not create, e.g. those
+		// of another CephUser or ones the provider does not manage at all.
+		if sec.GetResourceVersion() != "" && !ownedBy(sec, cr) {
+			return errors.New(errSecretOwner)
+		}
+		labels := sec.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[LabelKeyCephUser] = cr.GetName()
+		sec.SetLabels(labels)
+		sec.Data = make(map[string][]byte, len(data))
+		for k, v := range data {
+			sec.Data[k] = []byte(v)
+		}
+		return nil
+	})
+	return errors.Wrap(err, errApplySecret)
+}
+
+func (s *SecretStore) Read(ctx context.Context, cr *v1alpha1.CephUser) (map[string]string, error) {
+	sec := &corev1.Secret{}
+	if err := s.kube.Get(ctx, types.NamespacedName{Namespace: s.config.Namespace, Name: s.config.Name}, sec); err != nil {
+		return nil, errors.Wrap(resource.IgnoreNotFound(err), errGetSecret)
+	}
+	if !ownedBy(sec, cr) {
+		return nil, nil
+	}
+	data := make(map[string]string, len(sec.Data))
+	for k, v := range sec.Data {
+		data[k] = string(v)
+	}
+	return data, nil
+}
+
+func (s *SecretStore) Delete(ctx context.Context, cr *v1alpha1.CephUser) error {
+	sec := &corev1.Secret{}
+	if err := s.kube.Get(ctx, types.NamespacedName{Namespace: s.config.Namespace, Name: s.config.Name}, sec); err != nil {
+		return errors.Wrap(resource.IgnoreNotFound(err), errGetSecret)
+	}
+	if !ownedBy(sec, cr) {
+		// Not ours to delete.
+		return nil
+	}
+	err := s.kube.Delete(ctx, sec)
+	return errors.Wrap(resource.Ignore(kerrors.IsNotFound, err), errDeleteSecret)
+}
+
+// ownedBy returns whether the supplied Secret holds the credentials of the
+// supplied CephUser.
+func ownedBy(sec *corev1.Secret, cr *v1alpha1.CephUser) bool {
+	return sec.GetLabels()[LabelKeyCephUser] == cr.GetName()
+}
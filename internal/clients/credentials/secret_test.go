@@ -0,0 +1,192 @@
+package credentials
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+// secret returns a Secret as it exists in the API server, labelled as holding
+// the credentials of the supplied CephUser unless that is empty.
+func secret(owner string, data map[string][]byte) *corev1.Secret {
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "creds", ResourceVersion: "1"},
+		Data:       data,
+	}
+	if owner != "" {
+		sec.SetLabels(map[string]string{LabelKeyCephUser: owner})
+	}
+	return sec
+}
+
+// secretClient returns a client for an API server holding the supplied
+// Secret, or none if it is nil, that records the Secret written and whether it
+// was deleted.
+func secretClient(existing *corev1.Secret, written **corev1.Secret, deleted *bool) *test.MockClient {
+	return &test.MockClient{
+		MockGet: func(_ context.Context, _ client.ObjectKey, obj client.Object) error {
+			if existing == nil {
+				return kerrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "creds")
+			}
+			existing.DeepCopyInto(obj.(*corev1.Secret))
+			return nil
+		},
+		MockCreate: func(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+			*written = obj.(*corev1.Secret).DeepCopy()
+			return nil
+		},
+		MockUpdate: func(_ context.Context, obj client.Object, _ ...client.UpdateOption) error {
+			*written = obj.(*corev1.Secret).DeepCopy()
+			return nil
+		},
+		MockDelete: func(_ context.Context, _ client.Object, _ ...client.DeleteOption) error {
+			*deleted = true
+			return nil
+		},
+	}
+}
+
+func TestSecretStoreWrite(t *testing.T) {
+	cr := &v1alpha1.CephUser{ObjectMeta: metav1.ObjectMeta{Name: "cr"}}
+	data := map[string]string{KeyAccessKey: "AK", KeySecretKey: "SK"}
+	written := map[string][]byte{KeyAccessKey: []byte("AK"), KeySecretKey: []byte("SK")}
+
+	type want struct {
+		written *corev1.Secret
+		err     error
+	}
+
+	cases := map[string]struct {
+		reason   string
+		existing *corev1.Secret
+		want     want
+	}{
+		"Create": {
+			reason: "A Secret that does not exist should be created, labelled as holding the credentials of the CephUser.",
+			want: want{written: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "creds", Labels: map[string]string{LabelKeyCephUser: "cr"}},
+				Data:       written,
+			}},
+		},
+		"Owned": {
+			reason:   "A Secret holding the credentials of the CephUser should be overwritten.",
+			existing: secret("cr", map[string][]byte{KeyAccessKey: []byte("old"), "extra": []byte("x")}),
+			want:     want{written: secret("cr", written)},
+		},
+		"OtherCephUser": {
+			reason:   "A Secret holding the credentials of another CephUser should not be touched.",
+			existing: secret("other", nil),
+			want:     want{err: errors.Wrap(errors.New(errSecretOwner), errApplySecret)},
+		},
+		"Unlabelled": {
+			reason:   "A Secret the provider did not create should not be touched.",
+			existing: secret("", map[string][]byte{"token": []byte("t")}),
+			want:     want{err: errors.Wrap(errors.New(errSecretOwner), errApplySecret)},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got want
+			var deleted bool
+			s := NewSecretStore(secretClient(tc.existing, &got.written, &deleted), v1alpha1.SecretStoreConfig{Namespace: "ns", Name: "creds"})
+			got.err = s.Write(context.Background(), cr, data)
+			if diff := cmp.Diff(tc.want.err, got.err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nWrite(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.written, got.written); diff != "" {
+				t.Errorf("\n%s\nWrite(...): -want Secret, +got Secret:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSecretStoreRead(t *testing.T) {
+	cr := &v1alpha1.CephUser{ObjectMeta: metav1.ObjectMeta{Name: "cr"}}
+
+	cases := map[string]struct {
+		reason   string
+		existing *corev1.Secret
+		want     map[string]string
+	}{
+		"Owned": {
+			reason:   "The credentials of the CephUser should be read.",
+			existing: secret("cr", map[string][]byte{KeyAccessKey: []byte("AK")}),
+			want:     map[string]string{KeyAccessKey: "AK"},
+		},
+		"NotFound": {
+			reason: "A Secret that does not exist should be read as no credentials.",
+		},
+		"Unlabelled": {
+			reason:   "A Secret the provider did not create should be read as no credentials.",
+			existing: secret("", map[string][]byte{"token": []byte("t")}),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var written *corev1.Secret
+			var deleted bool
+			s := NewSecretStore(secretClient(tc.existing, &written, &deleted), v1alpha1.SecretStoreConfig{Namespace: "ns", Name: "creds"})
+			got, err := s.Read(context.Background(), cr)
+			if err != nil {
+				t.Fatalf("\n%s\nRead(...): unexpected error: %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nRead(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSecretStoreDelete(t *testing.T) {
+	cr := &v1alpha1.CephUser{ObjectMeta: metav1.ObjectMeta{Name: "cr"}}
+
+	cases := map[string]struct {
+		reason   string
+		existing *corev1.Secret
+		want     bool
+	}{
+		"Owned": {
+			reason:   "A Secret holding the credentials of the CephUser should be deleted.",
+			existing: secret("cr", nil),
+			want:     true,
+		},
+		"NotFound": {
+			reason: "A Secret that does not exist should not be deleted.",
+		},
+		"OtherCephUser": {
+			reason:   "A Secret holding the credentials of another CephUser should not be deleted.",
+			existing: secret("other", nil),
+		},
+		"Unlabelled": {
+			reason:   "A Secret the provider did not create should not be deleted.",
+			existing: secret("", nil),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var written *corev1.Secret
+			var deleted bool
+			s := NewSecretStore(secretClient(tc.existing, &written, &deleted), v1alpha1.SecretStoreConfig{Namespace: "ns", Name: "creds"})
+			if err := s.Delete(context.Background(), cr); err != nil {
+				t.Fatalf("\n%s\nDelete(...): unexpected error: %s", tc.reason, err)
+			}
+			if deleted != tc.want {
+				t.Errorf("\n%s\nDelete(...): want deleted %t, got %t", tc.reason, tc.want, deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Package credentials stores the credentials of CephUsers in the places they
+// ask for, e.g. Vault or a Kubernetes Secret.
+package credentials
+
+import (
+	"context"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+// Keys of the credentials written to a Store.
+const (
+	KeyAccessKey = "access_key"
+	KeySecretKey = "secret_key"
+)
+
+// A Store persists the credentials of CephUsers. Where a Store writes the
+// credentials of a CephUser is up to the Store.
+type Store interface {
+	// Write stores the supplied credentials of the supplied CephUser,
+	// replacing any credentials stored before.
+	Write(ctx context.Context, cr *v1alpha1.CephUser, data map[string]string) error
+
+	// Read returns the credentials stored for the supplied CephUser, or nil
+	// if there are none.
+	Read(ctx context.Context, cr *v1alpha1.CephUser) (map[string]string, error)
+
+	// Delete removes the credentials stored for the supplied CephUser. It is
+	// not an error if there are none.
+	Delete(ctx context.Context, cr *v1alpha1.CephUser) error
+}
@@ -0,0 +1,86 @@
+package credentials
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+	"github.com/daanvinken/provider-radosgw/internal/utils"
+)
+
+// DefaultRegion is the region of clusters whose ProviderConfig does not
+// specify one. It is the zonegroup radosgw creates by default.
+const DefaultRegion = "default"
+
+const (
+	errParseTemplate  = "cannot parse credentials template"
+	errRenderTemplate = "cannot render credentials template"
+)
+
+// TemplateData is available to credentials templates.
+type TemplateData struct {
+	AccessKey   string
+	SecretKey   string
+	Endpoint    string
+	Region      string
+	UID         string
+	Tenant      string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// NewTemplateData returns the data credentials templates of the supplied
+// CephUser are rendered with.
+func NewTemplateData(cr *v1alpha1.CephUser, pc *apisv1alpha1.ProviderConfig, accessKey, secretKey string) TemplateData {
+	endpoint := ""
+	if endpoints := radosgw.Endpoints(pc); len(endpoints) > 0 {
+		endpoint = endpoints[0]
+	}
+	return TemplateData{
+		AccessKey:   accessKey,
+		SecretKey:   secretKey,
+		Endpoint:    endpoint,
+		Region:      utils.StringValue(pc.Spec.Region, DefaultRegion),
+		UID:         utils.StringValue(cr.Spec.ForProvider.UID, ""),
+		Tenant:      utils.StringValue(cr.Spec.ForProvider.Tenant, ""),
+		Name:        cr.GetName(),
+		Labels:      cr.GetLabels(),
+		Annotations: cr.GetAnnotations(),
+	}
+}
+
+// ParseTemplate parses the credentials template with the supplied key.
+func ParseTemplate(key, tmpl string) (*template.Template, error) {
+	t, err := template.New(key).Option("missingkey=error").Parse(tmpl)
+	return t, errors.Wrapf(err, "%s %q", errParseTemplate, key)
+}
+
+// Render returns the credentials to store for the supplied data. Without
+// templates these are the access and secret key.
+func Render(templates map[string]string, data TemplateData) (map[string]string, error) {
+	if len(templates) == 0 {
+		return map[string]string{
+			KeyAccessKey: data.AccessKey,
+			KeySecretKey: data.SecretKey,
+		}, nil
+	}
+
+	out := make(map[string]string, len(templates))
+	for key, tmpl := range templates {
+		t, err := ParseTemplate(key, tmpl)
+		if err != nil {
+			return nil, err
+		}
+		b := &bytes.Buffer{}
+		if err := t.Execute(b, data); err != nil {
+			return nil, errors.Wrapf(err, "%s %q", errRenderTemplate, key)
+		}
+		out[key] = b.String()
+	}
+	return out, nil
+}
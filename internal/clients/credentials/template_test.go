@@ -0,0 +1,97 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+func TestRender(t *testing.T) {
+	uid := "user"
+	region := "eu-west"
+
+	cr := &v1alpha1.CephUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cr",
+			Annotations: map[string]string{"bucket": "backups"},
+		},
+		Spec: v1alpha1.CephUserSpec{ForProvider: v1alpha1.CephUserParameters{UID: &uid}},
+	}
+	pc := &apisv1alpha1.ProviderConfig{Spec: apisv1alpha1.ProviderConfigSpec{HostName: "https://rgw.example.com"}}
+	regional := &apisv1alpha1.ProviderConfig{Spec: apisv1alpha1.ProviderConfigSpec{HostName: "https://rgw.example.com", Region: &region}}
+
+	type args struct {
+		templates map[string]string
+		pc        *apisv1alpha1.ProviderConfig
+	}
+
+	type want struct {
+		data map[string]string
+		err  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"NoTemplates": {
+			reason: "Without templates the access and secret key should be written.",
+			args:   args{pc: pc},
+			want:   want{data: map[string]string{KeyAccessKey: "AK", KeySecretKey: "SK"}},
+		},
+		"Environment": {
+			reason: "Templates should be able to render AWS style keys and the endpoint.",
+			args: args{
+				pc: pc,
+				templates: map[string]string{
+					"AWS_ACCESS_KEY_ID":     "{{ .AccessKey }}",
+					"AWS_SECRET_ACCESS_KEY": "{{ .SecretKey }}",
+					"AWS_ENDPOINT_URL":      "{{ .Endpoint }}",
+					"AWS_REGION":            "{{ .Region }}",
+					"BUCKET":                `{{ index .Annotations "bucket" }}`,
+				},
+			},
+			want: want{data: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "AK",
+				"AWS_SECRET_ACCESS_KEY": "SK",
+				"AWS_ENDPOINT_URL":      "https://rgw.example.com",
+				"AWS_REGION":            DefaultRegion,
+				"BUCKET":                "backups",
+			}},
+		},
+		"CredentialsFile": {
+			reason: "Templates should be able to render whole configuration files.",
+			args: args{
+				pc: regional,
+				templates: map[string]string{
+					"credentials": "[default]\naws_access_key_id = {{ .AccessKey }}\naws_secret_access_key = {{ .SecretKey }}\nregion = {{ .Region }}\n",
+				},
+			},
+			want: want{data: map[string]string{
+				"credentials": "[default]\naws_access_key_id = AK\naws_secret_access_key = SK\nregion = eu-west\n",
+			}},
+		},
+		"UnknownField": {
+			reason: "Templates referring to unknown fields should fail to render.",
+			args:   args{pc: pc, templates: map[string]string{"key": "{{ .Bucket }}"}},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := Render(tc.args.templates, NewTemplateData(cr, tc.args.pc, "AK", "SK"))
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Fatalf("\n%s\nRender(...): -want error, +got error:\n%s\n%v", tc.reason, diff, err)
+			}
+			if diff := cmp.Diff(tc.want.data, got); diff != "" {
+				t.Errorf("\n%s\nRender(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	vault_sdk "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+	"github.com/daanvinken/provider-radosgw/internal/clients/vault"
+)
+
+const errBuildSecretPath = "failed to build secret path for storing CephUser credentials"
+
+// VaultStore stores credentials in a Vault KV secrets engine.
+type VaultStore struct {
+	client *vault_sdk.Client
+	config v1alpha1.VaultConfig
+	pc     *apisv1alpha1.ProviderConfig
+	log    logging.Logger
+}
+
+// NewVaultStore returns a Store that writes credentials to the KV secrets
+// engine configured by the supplied VaultConfig. The ProviderConfig is used to
+// build the path of the credentials.
+func NewVaultStore(client *vault_sdk.Client, config v1alpha1.VaultConfig, pc *apisv1alpha1.ProviderConfig, log logging.Logger) *VaultStore {
+	return &VaultStore{client: client, config: config, pc: pc, log: log}
+}
+
+// Write writes the supplied credentials to Vault and records where, and at
+// which version, in the status of the supplied CephUser. Custom metadata
+// describing the credentials is written on a best-effort basis: the
+// credentials are usable without it.
+func (s *VaultStore) Write(_ context.Context, cr *v1alpha1.CephUser, data map[string]string) error {
+	path, err := vault.BuildCephUserSecretPath(*s.pc, cr)
+	if err != nil {
+		return errors.Wrap(err, errBuildSecretPath)
+	}
+	d := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		d[k] = v
+	}
+	version := s.lastVersion(cr, path)
+	if version == 0 && s.config.CheckAndSet {
+		// A CephUser that was deleted and recreated did not record the
+		// version of the secret it deleted, which is kept nonetheless.
+		if version, err = vault.DeletedVersion(s.client, s.config, path); err != nil {
+			return err
+		}
+	}
+	version, err = vault.WriteSecretsToVault(s.client, s.config, &path, &d, version)
+	if err != nil {
+		return err
+	}
+
+	o := &v1alpha1.VaultCredentialsObservation{
+		MountPath: s.config.MountPath,
+		Path:      path,
+		KVVersion: s.config.KVVersion,
+	}
+	if version > 0 {
+		o.Version = &version
+	}
+	if cr.Status.AtProvider.Credentials == nil {
+		cr.Status.AtProvider.Credentials = &v1alpha1.CredentialsObservation{}
+	}
+	cr.Status.AtProvider.Credentials.Vault = o
+
+	if err := vault.WriteCustomMetadata(s.client, s.config, path, s.metadata(cr)); err != nil {
+		s.log.Info("Cannot write metadata of CephUser credentials to Vault", "path", path, "error", err)
+	}
+	return nil
+}
+
+// lastVersion returns the version of the credentials at the supplied path the
+// supplied CephUser recorded it wrote last, or 0 if it recorded none.
+func (s *VaultStore) lastVersion(cr *v1alpha1.CephUser, path string) int {
+	c := cr.Status.AtProvider.Credentials
+	if c == nil || c.Vault == nil || c.Vault.Version == nil {
+		return 0
+	}
+	if c.Vault.MountPath != s.config.MountPath || c.Vault.Path != path {
+		return 0
+	}
+	return *c.Vault.Version
+}
+
+// metadata describes who owns the credentials of the supplied CephUser. The
+// labels Crossplane sets on composed resources identify the claim and
+// composite the CephUser belongs to.
+func (s *VaultStore) metadata(cr *v1alpha1.CephUser) map[string]string {
+	m := map[string]string{
+		"crossplane-name": cr.GetName(),
+		"uid":             radosgw.UserID(cr.Spec.ForProvider),
+		"cluster":         vault.ClusterName(*s.pc),
+		"provider-config": s.pc.GetName(),
+	}
+	for k, v := range cr.GetLabels() {
+		if strings.HasPrefix(k, "crossplane.io/") {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func (s *VaultStore) Read(_ context.Context, cr *v1alpha1.CephUser) (map[string]string, error) {
+	path, err := vault.BuildCephUserSecretPath(*s.pc, cr)
+	if err != nil {
+		return nil, errors.Wrap(err, errBuildSecretPath)
+	}
+	d, err := vault.ReadSecretsFromVault(s.client, s.config, &path)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(d))
+	for k, v := range d {
+		data[k] = fmt.Sprint(v)
+	}
+	return data, nil
+}
+
+func (s *VaultStore) Delete(_ context.Context, cr *v1alpha1.CephUser) error {
+	path, err := vault.BuildCephUserSecretPath(*s.pc, cr)
+	if err != nil {
+		return errors.Wrap(err, errBuildSecretPath)
+	}
+	return vault.RemoveSecretFromVault(s.client, s.config, &path)
+}
@@ -0,0 +1,349 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/google/go-cmp/cmp"
+	vault_sdk "github.com/hashicorp/vault/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+// fakeKVv2 records the requests made to a KV v2 secrets engine mounted at
+// 'secret' that holds a single secret with the supplied data at the supplied
+// version.
+type fakeKVv2 struct {
+	version int
+	data    map[string]interface{}
+	// deleted marks the version of the secret as deleted, as deleting a KV
+	// v2 secret does.
+	deleted bool
+	// forbidMetadata refuses writes of custom metadata.
+	forbidMetadata bool
+
+	mu       sync.Mutex
+	requests []string
+	options  map[string]interface{}
+	metadata map[string]interface{}
+}
+
+func (f *fakeKVv2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/v1/secret/"))
+	body := map[string]map[string]interface{}{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+		if f.version == 0 {
+			notFound(w)
+			return
+		}
+		deletionTime := ""
+		if f.deleted {
+			deletionTime = "2023-01-01T00:00:00Z"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"current_version": f.version,
+			"versions": map[string]interface{}{
+				strconv.Itoa(f.version): map[string]interface{}{"version": f.version, "deletion_time": deletionTime, "destroyed": false},
+			},
+		}})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		if f.version == 0 || f.deleted {
+			notFound(w)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"data":     f.data,
+			"metadata": map[string]interface{}{"version": f.version},
+		}})
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		f.options = body["options"]
+		if cas, ok := f.options["cas"]; ok && cas != float64(f.version) {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"version": f.version + 1}})
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/") && f.forbidMetadata:
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+		f.metadata = body["custom_metadata"]
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// notFound answers like Vault does for secrets that do not exist.
+func notFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{}})
+}
+
+func TestVaultStore(t *testing.T) {
+	uid := "user"
+	cr := &v1alpha1.CephUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "cr",
+			Labels: map[string]string{"crossplane.io/claim-name": "claim", "team": "storage"},
+		},
+		Spec: v1alpha1.CephUserSpec{ForProvider: v1alpha1.CephUserParameters{UID: &uid}},
+	}
+	pc := &apisv1alpha1.ProviderConfig{ObjectMeta: metav1.ObjectMeta{Name: "ceph-cl01"}}
+	metadata := map[string]interface{}{
+		"crossplane-name":          "cr",
+		"uid":                      "user",
+		"cluster":                  "cl01",
+		"provider-config":          "ceph-cl01",
+		"crossplane.io/claim-name": "claim",
+	}
+
+	type want struct {
+		requests []string
+		options  map[string]interface{}
+		metadata map[string]interface{}
+		status   *v1alpha1.VaultCredentialsObservation
+		failed   bool
+	}
+
+	one, two, three, four := 1, 2, 3, 4
+	cases := map[string]struct {
+		reason         string
+		version        int
+		deleted        bool
+		forbidMetadata bool
+		config         v1alpha1.VaultConfig
+		written        *v1alpha1.VaultCredentialsObservation
+		op             func(s *VaultStore, cr *v1alpha1.CephUser) error
+		want           want
+	}{
+		"Write": {
+			reason: "Credentials should be written along with custom metadata.",
+			config: v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane"},
+			op: func(s *VaultStore, cr *v1alpha1.CephUser) error {
+				return s.Write(context.Background(), cr, map[string]string{KeyAccessKey: "AK"})
+			},
+			want: want{
+				requests: []string{"PUT data/crossplane/cl01/users/user", "PATCH metadata/crossplane/cl01/users/user"},
+				metadata: metadata,
+				status: &v1alpha1.VaultCredentialsObservation{
+					MountPath: "secret",
+					Path:      "crossplane/cl01/users/user",
+					KVVersion: "2",
+					Version:   &one,
+				},
+			},
+		},
+		"MetadataRefused": {
+			reason:         "Credentials should be written even if their metadata cannot be.",
+			forbidMetadata: true,
+			config:         v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane"},
+			op: func(s *VaultStore, cr *v1alpha1.CephUser) error {
+				return s.Write(context.Background(), cr, map[string]string{KeyAccessKey: "AK"})
+			},
+			want: want{
+				requests: []string{"PUT data/crossplane/cl01/users/user", "PATCH metadata/crossplane/cl01/users/user"},
+				status: &v1alpha1.VaultCredentialsObservation{
+					MountPath: "secret",
+					Path:      "crossplane/cl01/users/user",
+					KVVersion: "2",
+					Version:   &one,
+				},
+			},
+		},
+		"CheckAndSet": {
+			reason:  "Check-and-set writes should be based on the version that was written last.",
+			version: 3,
+			config:  v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane", CheckAndSet: true},
+			written: &v1alpha1.VaultCredentialsObservation{MountPath: "secret", Path: "crossplane/cl01/users/user", KVVersion: "2", Version: &three},
+			op: func(s *VaultStore, cr *v1alpha1.CephUser) error {
+				return s.Write(context.Background(), cr, map[string]string{KeyAccessKey: "AK"})
+			},
+			want: want{
+				requests: []string{"PUT data/crossplane/cl01/users/user", "PATCH metadata/crossplane/cl01/users/user"},
+				options:  map[string]interface{}{"cas": float64(3)},
+				metadata: metadata,
+				status: &v1alpha1.VaultCredentialsObservation{
+					MountPath: "secret",
+					Path:      "crossplane/cl01/users/user",
+					KVVersion: "2",
+					Version:   &four,
+				},
+			},
+		},
+		"CheckAndSetFirstWrite": {
+			reason: "Check-and-set writes of credentials that were never written should only create the secret.",
+			config: v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane", CheckAndSet: true},
+			op: func(s *VaultStore, cr *v1alpha1.CephUser) error {
+				return s.Write(context.Background(), cr, map[string]string{KeyAccessKey: "AK"})
+			},
+			want: want{
+				requests: []string{"GET metadata/crossplane/cl01/users/user", "PUT data/crossplane/cl01/users/user", "PATCH metadata/crossplane/cl01/users/user"},
+				options:  map[string]interface{}{"cas": float64(0)},
+				metadata: metadata,
+				status: &v1alpha1.VaultCredentialsObservation{
+					MountPath: "secret",
+					Path:      "crossplane/cl01/users/user",
+					KVVersion: "2",
+					Version:   &one,
+				},
+			},
+		},
+		"CheckAndSetRecreate": {
+			reason:  "Check-and-set writes of credentials that were never written should be based on the version of a secret that was deleted, e.g. by a previous CephUser of the same name.",
+			version: 3,
+			deleted: true,
+			config:  v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane", CheckAndSet: true},
+			op: func(s *VaultStore, cr *v1alpha1.CephUser) error {
+				return s.Write(context.Background(), cr, map[string]string{KeyAccessKey: "AK"})
+			},
+			want: want{
+				requests: []string{"GET metadata/crossplane/cl01/users/user", "PUT data/crossplane/cl01/users/user", "PATCH metadata/crossplane/cl01/users/user"},
+				options:  map[string]interface{}{"cas": float64(3)},
+				metadata: metadata,
+				status: &v1alpha1.VaultCredentialsObservation{
+					MountPath: "secret",
+					Path:      "crossplane/cl01/users/user",
+					KVVersion: "2",
+					Version:   &four,
+				},
+			},
+		},
+		"CheckAndSetExisting": {
+			reason:  "Check-and-set writes of credentials that were never written should not overwrite a secret that was not deleted.",
+			version: 3,
+			config:  v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane", CheckAndSet: true},
+			op: func(s *VaultStore, cr *v1alpha1.CephUser) error {
+				return s.Write(context.Background(), cr, map[string]string{KeyAccessKey: "AK"})
+			},
+			want: want{
+				requests: []string{"GET metadata/crossplane/cl01/users/user", "PUT data/crossplane/cl01/users/user"},
+				options:  map[string]interface{}{"cas": float64(0)},
+				failed:   true,
+			},
+		},
+		"CheckAndSetConflict": {
+			reason:  "Check-and-set writes should fail if another writer changed the secret since it was written last.",
+			version: 3,
+			config:  v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane", CheckAndSet: true},
+			written: &v1alpha1.VaultCredentialsObservation{MountPath: "secret", Path: "crossplane/cl01/users/user", KVVersion: "2", Version: &two},
+			op: func(s *VaultStore, cr *v1alpha1.CephUser) error {
+				return s.Write(context.Background(), cr, map[string]string{KeyAccessKey: "AK"})
+			},
+			want: want{
+				requests: []string{"PUT data/crossplane/cl01/users/user"},
+				options:  map[string]interface{}{"cas": float64(2)},
+				status:   &v1alpha1.VaultCredentialsObservation{MountPath: "secret", Path: "crossplane/cl01/users/user", KVVersion: "2", Version: &two},
+				failed:   true,
+			},
+		},
+		"SoftDelete": {
+			reason: "By default only the latest version should be deleted.",
+			config: v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane"},
+			op:     func(s *VaultStore, cr *v1alpha1.CephUser) error { return s.Delete(context.Background(), cr) },
+			want:   want{requests: []string{"DELETE data/crossplane/cl01/users/user"}},
+		},
+		"Destroy": {
+			reason: "Destroying should remove the metadata and with it every version.",
+			config: v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane", KVDeletionPolicy: v1alpha1.KVDeletionPolicyDestroy},
+			op:     func(s *VaultStore, cr *v1alpha1.CephUser) error { return s.Delete(context.Background(), cr) },
+			want:   want{requests: []string{"DELETE metadata/crossplane/cl01/users/user"}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeKVv2{version: tc.version, deleted: tc.deleted, forbidMetadata: tc.forbidMetadata}
+			srv := httptest.NewServer(f)
+			defer srv.Close()
+
+			cfg := vault_sdk.DefaultConfig()
+			cfg.Address = srv.URL
+			c, err := vault_sdk.NewClient(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.SetToken("token")
+
+			user := cr.DeepCopy()
+			user.Spec.ForProvider.VaultCredentialsStore = &tc.config
+			if tc.written != nil {
+				user.Status.AtProvider.Credentials = &v1alpha1.CredentialsObservation{Vault: tc.written}
+			}
+			err = tc.op(NewVaultStore(c, tc.config, pc, logging.NewNopLogger()), user)
+
+			got := want{requests: f.requests, options: f.options, metadata: f.metadata, failed: err != nil}
+			if c := user.Status.AtProvider.Credentials; c != nil {
+				got.status = c.Vault
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\n-want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestVaultStoreRead(t *testing.T) {
+	uid := "user"
+	config := v1alpha1.VaultConfig{KVVersion: "2", MountPath: "secret", SecretPath: "crossplane"}
+	cr := &v1alpha1.CephUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "cr"},
+		Spec:       v1alpha1.CephUserSpec{ForProvider: v1alpha1.CephUserParameters{UID: &uid, VaultCredentialsStore: &config}},
+	}
+	pc := &apisv1alpha1.ProviderConfig{ObjectMeta: metav1.ObjectMeta{Name: "ceph-cl01"}}
+
+	cases := map[string]struct {
+		reason  string
+		version int
+		data    map[string]interface{}
+		want    map[string]string
+	}{
+		"Exists": {
+			reason:  "The data of an existing secret should be read.",
+			version: 2,
+			data:    map[string]interface{}{KeyAccessKey: "AK", KeySecretKey: "SK"},
+			want:    map[string]string{KeyAccessKey: "AK", KeySecretKey: "SK"},
+		},
+		"NotFound": {
+			reason: "A secret that does not exist should be read as no credentials.",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(&fakeKVv2{version: tc.version, data: tc.data})
+			defer srv.Close()
+
+			cfg := vault_sdk.DefaultConfig()
+			cfg.Address = srv.URL
+			c, err := vault_sdk.NewClient(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.SetToken("token")
+
+			got, err := NewVaultStore(c, config, pc, logging.NewNopLogger()).Read(context.Background(), cr)
+			if err != nil {
+				t.Fatalf("\n%s\nRead(...): unexpected error: %s", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nRead(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package radosgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+)
+
+// go-ceph does not expose every parameter of the radosgw Admin Ops API, most
+// notably the system flag, the op-mask and the default placement of a user.
+// The calls in this file talk to the API directly, signing requests the same
+// way go-ceph does.
+
+const (
+	adminPath         = "/admin"
+	adminAuthRegion   = "default"
+	adminAuthService  = "s3"
+	errUnmarshalAdmin = "failed to unmarshal radosgw http response"
+)
+
+// UserInfo is a radosgw user including the attributes go-ceph does not decode.
+type UserInfo struct {
+	radosgw_admin.User
+
+	System flexBool `json:"system"`
+}
+
+// flexBool decodes both JSON booleans and the "true"/"false" strings some
+// radosgw releases return.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	s := string(bytes.Trim(data, `"`))
+	if s == "" || s == "null" {
+		*b = false
+		return nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*b = flexBool(v)
+	return nil
+}
+
+// Info describes the Ceph cluster a radosgw stores its data in.
+type Info struct {
+	StorageBackends []StorageBackend `json:"storage_backends"`
+}
+
+// A StorageBackend is a cluster a radosgw stores data in.
+type StorageBackend struct {
+	Name      string `json:"name"`
+	ClusterID string `json:"cluster_id"`
+}
+
+// FSID returns the id of the RADOS cluster radosgw stores its data in, or an
+// empty string if it reported none.
+func (i Info) FSID() string {
+	for _, b := range i.StorageBackends {
+		if b.Name == "rados" {
+			return b.ClusterID
+		}
+	}
+	return ""
+}
+
+// UserAttributes are the user attributes that are modified through a direct
+// admin call. Nil fields are left untouched.
+type UserAttributes struct {
+	DisplayName      *string
+	Email            *string
+	MaxBuckets       *int
+	OpMask           *string
+	System           *bool
+	DefaultPlacement *string
+}
+
+// Client is the part of the radosgw Admin Ops API the provider uses.
+type Client interface {
+	// GetUserInfo returns the user with the supplied id, including the
+	// attributes go-ceph does not decode.
+	GetUserInfo(ctx context.Context, uid string) (UserInfo, error)
+	CreateUser(ctx context.Context, user radosgw_admin.User) (radosgw_admin.User, error)
+	// ModifyUserAttributes sets the supplied attributes on the user with the
+	// supplied id, including those go-ceph does not support.
+	ModifyUserAttributes(ctx context.Context, uid string, attrs UserAttributes) error
+	RemoveUser(ctx context.Context, user radosgw_admin.User) error
+	// ListUsers returns the ids of all users, including their tenant.
+	ListUsers(ctx context.Context) ([]string, error)
+
+	SetUserQuota(ctx context.Context, quota radosgw_admin.QuotaSpec) error
+
+	ListUsersBuckets(ctx context.Context, uid string) ([]string, error)
+
+	CreateKey(ctx context.Context, key radosgw_admin.UserKeySpec) (*[]radosgw_admin.UserKeySpec, error)
+	RemoveKey(ctx context.Context, key radosgw_admin.UserKeySpec) error
+
+	CreateSubuser(ctx context.Context, user radosgw_admin.User, subuser radosgw_admin.SubuserSpec) error
+	RemoveSubuser(ctx context.Context, user radosgw_admin.User, subuser radosgw_admin.SubuserSpec) error
+
+	AddUserCap(ctx context.Context, uid, userCap string) ([]radosgw_admin.UserCapSpec, error)
+	RemoveUserCap(ctx context.Context, uid, userCap string) ([]radosgw_admin.UserCapSpec, error)
+
+	// GetInfo returns the cluster radosgw stores its data in. It requires the
+	// 'info=read' capability.
+	GetInfo(ctx context.Context) (Info, error)
+}
+
+// adminClient is a Client backed by go-ceph, extended with direct calls for
+// what go-ceph does not support.
+type adminClient struct {
+	*radosgw_admin.API
+}
+
+// GetUserInfo retrieves the user with the supplied id.
+func (c adminClient) GetUserInfo(ctx context.Context, uid string) (UserInfo, error) {
+	body, err := adminCall(ctx, c.API, http.MethodGet, "/user", url.Values{"uid": {uid}})
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	u := UserInfo{}
+	if err := json.Unmarshal(body, &u); err != nil {
+		return UserInfo{}, fmt.Errorf("%s. %s. %w", errUnmarshalAdmin, string(body), err)
+	}
+	return u, nil
+}
+
+// GetInfo returns the cluster radosgw stores its data in.
+func (c adminClient) GetInfo(ctx context.Context) (Info, error) {
+	body, err := adminCall(ctx, c.API, http.MethodGet, "/info", url.Values{})
+	if err != nil {
+		return Info{}, err
+	}
+
+	resp := struct {
+		Info Info `json:"info"`
+	}{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return Info{}, fmt.Errorf("%s. %s. %w", errUnmarshalAdmin, string(body), err)
+	}
+	return resp.Info, nil
+}
+
+// ListUsers returns the ids of all users.
+func (c adminClient) ListUsers(ctx context.Context) ([]string, error) {
+	users, err := c.API.GetUsers(ctx)
+	if err != nil || users == nil {
+		return nil, err
+	}
+	return *users, nil
+}
+
+// ModifyUserAttributes sets the supplied attributes on the user with the
+// supplied id.
+func (c adminClient) ModifyUserAttributes(ctx context.Context, uid string, attrs UserAttributes) error {
+	v := url.Values{"uid": {uid}}
+	if attrs.DisplayName != nil {
+		v.Set("display-name", *attrs.DisplayName)
+	}
+	if attrs.Email != nil {
+		v.Set("email", *attrs.Email)
+	}
+	if attrs.MaxBuckets != nil {
+		v.Set("max-buckets", strconv.Itoa(*attrs.MaxBuckets))
+	}
+	if attrs.OpMask != nil {
+		v.Set("op-mask", *attrs.OpMask)
+	}
+	if attrs.System != nil {
+		v.Set("system", strconv.FormatBool(*attrs.System))
+	}
+	if attrs.DefaultPlacement != nil {
+		v.Set("default-placement", *attrs.DefaultPlacement)
+	}
+
+	_, err := adminCall(ctx, c.API, http.MethodPost, "/user", v)
+	return err
+}
+
+func adminCall(ctx context.Context, api *radosgw_admin.API, method, path string, args url.Values) ([]byte, error) {
+	args.Set("format", "json")
+	request, err := http.NewRequestWithContext(ctx, method, api.Endpoint+adminPath+path+"?"+args.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := v4.NewSigner(credentials.NewStaticCredentials(api.AccessKey, api.SecretKey, ""))
+	if _, err := signer.Sign(request, nil, adminAuthService, adminAuthRegion, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := api.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, newStatusError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
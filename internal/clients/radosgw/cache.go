@@ -0,0 +1,100 @@
+package radosgw
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+// A ClientCache hands out radosgw clients, one per ProviderConfig. Creating a
+// client reads the admin credentials of its ProviderConfig from Vault, which
+// is too expensive to do on every reconcile of every CephUser. Clients are
+// keyed on the UID of their ProviderConfig and reused until its spec changes,
+// i.e. its generation rather than its resourceVersion, which changes with
+// every status update.
+// They are created again earlier when they are invalidated, e.g. because
+// radosgw rejected their credentials.
+//
+// Admin credentials rotated in Vault are not noticed as such: Vault KV v1
+// secrets do not carry a version to compare, and reading them on every use is
+// what the cache avoids. Clients are therefore created again once they reach
+// their maximum age, or as soon as radosgw rejects the old credentials.
+type ClientCache struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu sync.Mutex
+	// clients holds the client of each ProviderConfig. Each has a lock of its
+	// own that is held while the client is created, so that a ProviderConfig
+	// whose Vault or radosgw is slow only holds up its own CephUsers.
+	clients map[types.UID]*cacheEntry
+}
+
+type cacheEntry struct {
+	mu     sync.Mutex
+	cached *cachedClient
+}
+
+type cachedClient struct {
+	client     Client
+	generation int64
+	created    time.Time
+}
+
+// NewClientCache returns an empty ClientCache whose clients are created again
+// once they are older than the supplied maximum age.
+func NewClientCache(maxAge time.Duration) *ClientCache {
+	return &ClientCache{
+		maxAge:  maxAge,
+		now:     time.Now,
+		clients: map[types.UID]*cacheEntry{},
+	}
+}
+
+// Get returns the client of the supplied ProviderConfig. The supplied function
+// creates it if none is cached, or the cached one is outdated.
+func (c *ClientCache) Get(ctx context.Context, pc *apisv1alpha1.ProviderConfig, newClient func(ctx context.Context) (Client, error)) (Client, error) {
+	e := c.entry(pc.GetUID())
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := c.now()
+	if cc := e.cached; cc != nil && cc.generation == pc.GetGeneration() && now.Sub(cc.created) < c.maxAge {
+		return cc.client, nil
+	}
+
+	// Clients that cannot be created again are not reused either, e.g. when
+	// the host of the ProviderConfig is invalid.
+	e.cached = nil
+	rc, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.cached = &cachedClient{client: rc, generation: pc.GetGeneration(), created: now}
+	return rc, nil
+}
+
+// entry returns the entry of the ProviderConfig with the supplied UID, adding
+// it if necessary.
+func (c *ClientCache) entry(uid types.UID) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.clients[uid]
+	if !ok {
+		e = &cacheEntry{}
+		c.clients[uid] = e
+	}
+	return e
+}
+
+// Invalidate the client of the ProviderConfig with the supplied UID, so that
+// it is created again on its next use.
+func (c *ClientCache) Invalidate(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients, uid)
+}
@@ -0,0 +1,115 @@
+package radosgw
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+func TestClientCache(t *testing.T) {
+	pc := func(uid types.UID, generation int64) *apisv1alpha1.ProviderConfig {
+		return &apisv1alpha1.ProviderConfig{ObjectMeta: metav1.ObjectMeta{UID: uid, Generation: generation}}
+	}
+
+	type use struct {
+		pc         *apisv1alpha1.ProviderConfig
+		after      time.Duration
+		invalidate bool
+		err        error
+	}
+
+	cases := map[string]struct {
+		reason string
+		uses   []use
+		want   int
+	}{
+		"Reused": {
+			reason: "A client should be created once per ProviderConfig.",
+			uses:   []use{{pc: pc("a", 1)}, {pc: pc("a", 1)}, {pc: pc("b", 1)}, {pc: pc("a", 1)}},
+			want:   2,
+		},
+		"ProviderConfigChanged": {
+			reason: "A client should be created again when its ProviderConfig changed.",
+			uses:   []use{{pc: pc("a", 1)}, {pc: pc("a", 2)}, {pc: pc("a", 2)}},
+			want:   2,
+		},
+		"Expired": {
+			reason: "A client should be created again once it reached its maximum age.",
+			uses:   []use{{pc: pc("a", 1)}, {pc: pc("a", 1), after: time.Minute}},
+			want:   2,
+		},
+		"Invalidated": {
+			reason: "A client should be created again after it was invalidated.",
+			uses:   []use{{pc: pc("a", 1), invalidate: true}, {pc: pc("a", 1)}},
+			want:   2,
+		},
+		"Failed": {
+			reason: "A client that could not be created should be created again on its next use.",
+			uses:   []use{{pc: pc("a", 1), err: errors.New("boom")}, {pc: pc("a", 1)}, {pc: pc("a", 1)}},
+			want:   2,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			c := NewClientCache(time.Minute)
+			c.now = func() time.Time { return now }
+
+			created := 0
+			for _, u := range tc.uses {
+				now = now.Add(u.after)
+				_, _ = c.Get(context.Background(), u.pc, func(context.Context) (Client, error) {
+					created++
+					return adminClient{}, u.err
+				})
+				if u.invalidate {
+					c.Invalidate(u.pc.GetUID())
+				}
+			}
+			if diff := cmp.Diff(tc.want, created); diff != "" {
+				t.Errorf("\n%s\n-want created, +got created:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestClientCacheSlowClient(t *testing.T) {
+	pc := func(uid types.UID) *apisv1alpha1.ProviderConfig {
+		return &apisv1alpha1.ProviderConfig{ObjectMeta: metav1.ObjectMeta{UID: uid, Generation: 1}}
+	}
+	c := NewClientCache(time.Minute)
+
+	// The client of ProviderConfig 'slow' is not created until it is released.
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	go func() {
+		_, _ = c.Get(context.Background(), pc("slow"), func(context.Context) (Client, error) {
+			close(started)
+			<-release
+			return adminClient{}, nil
+		})
+	}()
+	<-started
+
+	done := make(chan error)
+	go func() {
+		_, err := c.Get(context.Background(), pc("fast"), func(context.Context) (Client, error) { return adminClient{}, nil })
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Get(...): unexpected error: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Get(...): creating the client of one ProviderConfig held up the client of another")
+	}
+}
@@ -5,31 +5,68 @@ import (
 	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
 	"github.com/daanvinken/provider-radosgw/internal/utils"
+	"github.com/pkg/errors"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 )
 
+// LabelKeyClaimNamespace is the label Crossplane sets on composed resources to
+// record the namespace of the claim they were created for.
+const LabelKeyClaimNamespace = "crossplane.io/claim-namespace"
+
+// QuotaUnlimited is the quota value radosgw uses for 'no limit'.
+const QuotaUnlimited = -1
+
+const errInvalidHost = "radosgw host must be an http or https URL"
+
 type Credentials struct {
 	AccessKey string
 	SecretKey string
 }
 
-func NewRadosgwClient(host string, creds Credentials) *radosgw_admin.API {
-	httpClient := &http.Client{}
-	rgwClient, err := radosgw_admin.New(host, creds.AccessKey, creds.SecretKey, httpClient)
+// transport is shared by all radosgw clients, so that connections are reused
+// across clients and reconciles. The default transport keeps only two idle
+// connections per host, far fewer than there are concurrent reconciles.
+var transport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 100
+	t.MaxIdleConnsPerHost = 100
+	return t
+}()
+
+// NewRadosgwClient returns a client for the Admin Ops API of the radosgw at
+// the supplied host.
+func NewRadosgwClient(host string, creds Credentials) (Client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.Wrap(err, errInvalidHost)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.Errorf("%s: %q", errInvalidHost, host)
+	}
+
+	httpClient := statusClient{client: &http.Client{Transport: transport}}
+	api, err := radosgw_admin.New(host, creds.AccessKey, creds.SecretKey, httpClient)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return rgwClient
+	return adminClient{API: api}, nil
 }
 
 func GenerateCephUserInput(cephUser *v1alpha1.CephUser) *radosgw_admin.User {
+	// radosgw refuses to create a user without a display name, so fall back
+	// to the uid when none was specified.
+	displayName := utils.StringValue(cephUser.Spec.ForProvider.DisplayedName, *cephUser.Spec.ForProvider.UID)
 
 	createCephUserInput := &radosgw_admin.User{
-		ID:          *cephUser.Spec.ForProvider.UID,
+		ID:          UserID(cephUser.Spec.ForProvider),
 		MaxBuckets:  cephUser.Spec.ForProvider.UserQuotaMaxBuckets,
-		DisplayName: *cephUser.Spec.ForProvider.DisplayedName,
+		DisplayName: displayName,
+		Email:       utils.StringValue(cephUser.Spec.ForProvider.Email, ""),
 		Keys: []radosgw_admin.UserKeySpec{
 			{
 				AccessKey: utils.GenerateRandomSecret(15),
@@ -45,7 +82,7 @@ func GenerateCephUserQuotaInput(cephUser *v1alpha1.CephUser) *radosgw_admin.Quot
 	quotaEnable := true
 	userQuotaSpec := &radosgw_admin.QuotaSpec{
 		QuotaType:  "user",
-		UID:        *cephUser.Spec.ForProvider.UID,
+		UID:        UserID(cephUser.Spec.ForProvider),
 		MaxSizeKb:  cephUser.Spec.ForProvider.UserQuotaMaxSizeKB,
 		MaxObjects: cephUser.Spec.ForProvider.UserQuotaMaxObjects,
 		Enabled:    &quotaEnable,
@@ -53,18 +90,144 @@ func GenerateCephUserQuotaInput(cephUser *v1alpha1.CephUser) *radosgw_admin.Quot
 	return userQuotaSpec
 }
 
-func CephUserExists(ctx context.Context, radosgwclient *radosgw_admin.API, UID string) (bool, error) {
-	_, err := radosgwclient.GetUser(ctx, radosgw_admin.User{ID: UID})
+// UserID returns the user id radosgw knows the user by. Users that belong to a
+// tenant are addressed as 'tenant$uid'.
+func UserID(params v1alpha1.CephUserParameters) string {
+	if params.Tenant == nil || *params.Tenant == "" {
+		return *params.UID
+	}
+	return *params.Tenant + "$" + *params.UID
+}
+
+// DefaultTenant returns the tenant the supplied ProviderConfig assigns to
+// CephUsers that do not specify one, or nil if it assigns none.
+func DefaultTenant(pc *apisv1alpha1.ProviderConfig, cephUser *v1alpha1.CephUser) *string {
+	if pc.Spec.TenantFromClaimNamespace {
+		if ns, ok := cephUser.GetLabels()[LabelKeyClaimNamespace]; ok && ns != "" {
+			return &ns
+		}
+	}
+	return pc.Spec.DefaultTenant
+}
+
+// GenerateCephUserAttributes returns the attributes of the supplied CephUser
+// that are reconciled through ModifyUser.
+func GenerateCephUserAttributes(cephUser *v1alpha1.CephUser) UserAttributes {
+	p := cephUser.Spec.ForProvider
+	attrs := UserAttributes{
+		DisplayName:      p.DisplayedName,
+		Email:            p.Email,
+		MaxBuckets:       p.UserQuotaMaxBuckets,
+		OpMask:           p.OpMask,
+		System:           p.System,
+		DefaultPlacement: p.DefaultPlacement,
+	}
+	// radosgw takes the default storage class as part of the placement rule,
+	// i.e. 'placement/storage-class'. An empty placement selects the default
+	// placement of the zonegroup.
+	if p.DefaultStorageClass != nil {
+		rule := utils.StringValue(p.DefaultPlacement, "") + "/" + *p.DefaultStorageClass
+		attrs.DefaultPlacement = &rule
+	}
+	return attrs
+}
+
+// HasExtendedAttributes returns true if the supplied CephUser sets attributes
+// that radosgw does not accept when creating a user.
+func HasExtendedAttributes(cephUser *v1alpha1.CephUser) bool {
+	p := cephUser.Spec.ForProvider
+	return p.OpMask != nil || p.System != nil || p.DefaultPlacement != nil || p.DefaultStorageClass != nil
+}
+
+// GetCephUser returns the radosgw user with the supplied UID, or nil if no such
+// user exists.
+func GetCephUser(ctx context.Context, radosgwclient Client, UID string) (*UserInfo, error) {
+	user, err := radosgwclient.GetUserInfo(ctx, UID)
 	if err != nil {
-		return false, resource.Ignore(isNotFound, err)
+		return nil, resource.Ignore(IsNotFound, err)
+	}
+	return &user, nil
+}
+
+// LateInitializeCephUser fills the unset fields of the supplied parameters with
+// the values reported by radosgw. It returns true if any field was changed.
+func LateInitializeCephUser(params *v1alpha1.CephUserParameters, user UserInfo) bool {
+	li := false
+
+	params.DisplayedName, li = utils.LateInitializeString(params.DisplayedName, user.DisplayName, li)
+	params.UserQuotaMaxBuckets, li = utils.LateInitializeInt(params.UserQuotaMaxBuckets, user.MaxBuckets, li)
+	params.UserQuotaMaxSizeKB, li = utils.LateInitializeInt(params.UserQuotaMaxSizeKB, observedMaxSizeKB(user.UserQuota), li)
+	params.UserQuotaMaxObjects, li = utils.LateInitializeInt64(params.UserQuotaMaxObjects, user.UserQuota.MaxObjects, li)
+	params.Email, li = utils.LateInitializeString(params.Email, user.Email, li)
+	params.OpMask, li = utils.LateInitializeString(params.OpMask, user.OpMask, li)
+	params.DefaultPlacement, li = utils.LateInitializeString(params.DefaultPlacement, user.DefaultPlacement, li)
+	params.DefaultStorageClass, li = utils.LateInitializeString(params.DefaultStorageClass, user.DefaultStorageClass, li)
+
+	if params.System == nil {
+		system := bool(user.System)
+		params.System = &system
+		li = true
+	}
+
+	return li
+}
+
+// IsCephUserUpToDate returns true if the observed user matches the supplied
+// parameters. Unset parameters are not compared.
+func IsCephUserUpToDate(params v1alpha1.CephUserParameters, user UserInfo) bool {
+	switch {
+	case params.DisplayedName != nil && *params.DisplayedName != user.DisplayName,
+		params.Email != nil && *params.Email != user.Email,
+		params.UserQuotaMaxBuckets != nil && !intEqual(*params.UserQuotaMaxBuckets, user.MaxBuckets),
+		params.UserQuotaMaxSizeKB != nil && !intEqual(normalizeQuota(*params.UserQuotaMaxSizeKB), observedMaxSizeKB(user.UserQuota)),
+		params.UserQuotaMaxObjects != nil && (user.UserQuota.MaxObjects == nil || normalizeQuota(*params.UserQuotaMaxObjects) != normalizeQuota(*user.UserQuota.MaxObjects)),
+		params.OpMask != nil && NormalizeOpMask(*params.OpMask) != NormalizeOpMask(user.OpMask),
+		params.System != nil && *params.System != bool(user.System),
+		params.DefaultPlacement != nil && *params.DefaultPlacement != user.DefaultPlacement,
+		params.DefaultStorageClass != nil && *params.DefaultStorageClass != user.DefaultStorageClass:
+		return false
 	}
-	return true, nil
+	return true
 }
 
-// isNotFound helper function to test for NotFound error
-func isNotFound(err error) bool {
-	if strings.HasPrefix(err.Error(), "NoSuchUser") {
-		return true
+// NormalizeOpMask returns the supplied op-mask as a sorted, comma separated
+// list of operations. radosgw reports op-masks as e.g. "read, write, delete",
+// and accepts "*" as a shorthand for all operations.
+func NormalizeOpMask(mask string) string {
+	ops := []string{}
+	for _, op := range strings.Split(mask, ",") {
+		op = strings.ToLower(strings.TrimSpace(op))
+		switch op {
+		case "":
+			continue
+		case "*":
+			return "delete,read,write"
+		}
+		ops = append(ops, op)
 	}
-	return false
+	sort.Strings(ops)
+	return strings.Join(ops, ",")
+}
+
+// observedMaxSizeKB returns the size limit of the supplied quota in KB, or -1
+// if it is unlimited. radosgw reports a max_size_kb of 0 for unlimited quotas,
+// so the sign of max_size is what tells them apart.
+func observedMaxSizeKB(quota radosgw_admin.QuotaSpec) *int {
+	if quota.MaxSize != nil && *quota.MaxSize < 0 {
+		unlimited := QuotaUnlimited
+		return &unlimited
+	}
+	return quota.MaxSizeKb
+}
+
+// normalizeQuota maps every negative quota to QuotaUnlimited, as radosgw does.
+func normalizeQuota[T int | int64](q T) T {
+	if q < 0 {
+		return QuotaUnlimited
+	}
+	return q
+}
+
+func intEqual(want int, observed *int) bool {
+	return observed != nil && want == *observed
 }
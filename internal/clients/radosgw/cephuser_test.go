@@ -0,0 +1,393 @@
+package radosgw
+
+import (
+	"testing"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+func TestLateInitializeCephUser(t *testing.T) {
+	uid := "user"
+	displayName := "Some User"
+	otherDisplayName := "Other User"
+	maxBuckets := 1000
+	specMaxBuckets := 5
+	maxSizeKB := 0
+	maxObjects := int64(-1)
+	specMaxObjects := int64(100)
+	unlimitedKB := -1
+	email := "user@example.com"
+	opMask := "read, write, delete"
+	specOpMask := "read"
+	system := true
+	notSystem := false
+
+	type args struct {
+		params v1alpha1.CephUserParameters
+		user   UserInfo
+	}
+
+	type want struct {
+		params v1alpha1.CephUserParameters
+		li     bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"AllUnset": {
+			reason: "Every omitted field should be late-initialized from the observed user.",
+			args: args{
+				params: v1alpha1.CephUserParameters{UID: &uid},
+				user: UserInfo{
+					User: radosgw_admin.User{
+						ID:          uid,
+						DisplayName: displayName,
+						Email:       email,
+						MaxBuckets:  &maxBuckets,
+						OpMask:      opMask,
+						UserQuota: radosgw_admin.QuotaSpec{
+							MaxSizeKb:  &maxSizeKB,
+							MaxObjects: &maxObjects,
+						},
+					},
+					System: true,
+				},
+			},
+			want: want{
+				params: v1alpha1.CephUserParameters{
+					UID:                 &uid,
+					DisplayedName:       &displayName,
+					UserQuotaMaxBuckets: &maxBuckets,
+					UserQuotaMaxSizeKB:  &maxSizeKB,
+					UserQuotaMaxObjects: &maxObjects,
+					Email:               &email,
+					OpMask:              &opMask,
+					System:              &system,
+				},
+				li: true,
+			},
+		},
+		"AllSet": {
+			reason: "Fields set in the spec should never be overwritten.",
+			args: args{
+				params: v1alpha1.CephUserParameters{
+					UID:                 &uid,
+					DisplayedName:       &otherDisplayName,
+					UserQuotaMaxBuckets: &specMaxBuckets,
+					UserQuotaMaxSizeKB:  &maxSizeKB,
+					UserQuotaMaxObjects: &specMaxObjects,
+					Email:               &email,
+					OpMask:              &specOpMask,
+					System:              &notSystem,
+				},
+				user: UserInfo{
+					User: radosgw_admin.User{
+						ID:          uid,
+						DisplayName: displayName,
+						MaxBuckets:  &maxBuckets,
+						OpMask:      opMask,
+						UserQuota: radosgw_admin.QuotaSpec{
+							MaxSizeKb:  &maxSizeKB,
+							MaxObjects: &maxObjects,
+						},
+					},
+					System: true,
+				},
+			},
+			want: want{
+				params: v1alpha1.CephUserParameters{
+					UID:                 &uid,
+					DisplayedName:       &otherDisplayName,
+					UserQuotaMaxBuckets: &specMaxBuckets,
+					UserQuotaMaxSizeKB:  &maxSizeKB,
+					UserQuotaMaxObjects: &specMaxObjects,
+					Email:               &email,
+					OpMask:              &specOpMask,
+					System:              &notSystem,
+				},
+				li: false,
+			},
+		},
+		"UnlimitedSize": {
+			reason: "An unlimited size quota should be late-initialized as -1 rather than the 0 KB radosgw reports.",
+			args: args{
+				params: v1alpha1.CephUserParameters{UID: &uid, System: &notSystem},
+				user: UserInfo{User: radosgw_admin.User{
+					ID:        uid,
+					UserQuota: radosgw_admin.QuotaSpec{MaxSize: &maxObjects, MaxSizeKb: &maxSizeKB},
+				}},
+			},
+			want: want{
+				params: v1alpha1.CephUserParameters{UID: &uid, System: &notSystem, UserQuotaMaxSizeKB: &unlimitedKB},
+				li:     true,
+			},
+		},
+		"NothingObserved": {
+			reason: "Fields radosgw does not report should stay unset.",
+			args: args{
+				params: v1alpha1.CephUserParameters{UID: &uid, System: &notSystem},
+				user:   UserInfo{User: radosgw_admin.User{ID: uid}},
+			},
+			want: want{
+				params: v1alpha1.CephUserParameters{UID: &uid, System: &notSystem},
+				li:     false,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			li := LateInitializeCephUser(&tc.args.params, tc.args.user)
+			if diff := cmp.Diff(tc.want.params, tc.args.params); diff != "" {
+				t.Errorf("\n%s\nLateInitializeCephUser(...): -want params, +got params:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.li, li); diff != "" {
+				t.Errorf("\n%s\nLateInitializeCephUser(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestUserID(t *testing.T) {
+	uid := "user"
+	tenant := "team"
+	empty := ""
+
+	cases := map[string]struct {
+		reason string
+		params v1alpha1.CephUserParameters
+		want   string
+	}{
+		"NoTenant": {
+			reason: "Users without a tenant should be addressed by their uid.",
+			params: v1alpha1.CephUserParameters{UID: &uid},
+			want:   "user",
+		},
+		"EmptyTenant": {
+			reason: "An empty tenant is the same as no tenant.",
+			params: v1alpha1.CephUserParameters{UID: &uid, Tenant: &empty},
+			want:   "user",
+		},
+		"Tenant": {
+			reason: "Users with a tenant should be addressed as 'tenant$uid'.",
+			params: v1alpha1.CephUserParameters{UID: &uid, Tenant: &tenant},
+			want:   "team$user",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := UserID(tc.params)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nUserID(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestDefaultTenant(t *testing.T) {
+	tenant := "default"
+	namespace := "team"
+
+	claimed := &v1alpha1.CephUser{ObjectMeta: metav1.ObjectMeta{
+		Labels: map[string]string{LabelKeyClaimNamespace: namespace},
+	}}
+
+	type args struct {
+		pc *apisv1alpha1.ProviderConfig
+		cr *v1alpha1.CephUser
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   *string
+	}{
+		"NoDefault": {
+			reason: "A ProviderConfig without defaults should not assign a tenant.",
+			args: args{
+				pc: &apisv1alpha1.ProviderConfig{},
+				cr: claimed,
+			},
+			want: nil,
+		},
+		"DefaultTenant": {
+			reason: "The default tenant should be used when set.",
+			args: args{
+				pc: &apisv1alpha1.ProviderConfig{Spec: apisv1alpha1.ProviderConfigSpec{DefaultTenant: &tenant}},
+				cr: claimed,
+			},
+			want: &tenant,
+		},
+		"ClaimNamespace": {
+			reason: "The claim namespace should take precedence over the default tenant.",
+			args: args{
+				pc: &apisv1alpha1.ProviderConfig{Spec: apisv1alpha1.ProviderConfigSpec{DefaultTenant: &tenant, TenantFromClaimNamespace: true}},
+				cr: claimed,
+			},
+			want: &namespace,
+		},
+		"NoClaim": {
+			reason: "Resources not created for a claim should fall back to the default tenant.",
+			args: args{
+				pc: &apisv1alpha1.ProviderConfig{Spec: apisv1alpha1.ProviderConfigSpec{DefaultTenant: &tenant, TenantFromClaimNamespace: true}},
+				cr: &v1alpha1.CephUser{},
+			},
+			want: &tenant,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := DefaultTenant(tc.args.pc, tc.args.cr)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nDefaultTenant(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIsCephUserUpToDate(t *testing.T) {
+	uid := "user"
+	displayName := "Some User"
+	otherDisplayName := "Other User"
+	maxBuckets := 5
+	specMaxBuckets := 10
+	opMask := "read, write, delete"
+	specOpMask := "*"
+	readOnly := "read"
+	system := true
+	placement := "default-placement"
+	storageClass := "STANDARD"
+
+	observed := UserInfo{
+		User: radosgw_admin.User{
+			ID:                  uid,
+			DisplayName:         displayName,
+			MaxBuckets:          &maxBuckets,
+			OpMask:              opMask,
+			DefaultPlacement:    placement,
+			DefaultStorageClass: storageClass,
+		},
+		System: true,
+	}
+
+	cases := map[string]struct {
+		reason string
+		params v1alpha1.CephUserParameters
+		want   bool
+	}{
+		"Unset": {
+			reason: "Unset parameters should not be compared.",
+			params: v1alpha1.CephUserParameters{UID: &uid},
+			want:   true,
+		},
+		"Matching": {
+			reason: "A user matching all parameters should be up to date.",
+			params: v1alpha1.CephUserParameters{
+				UID:                 &uid,
+				DisplayedName:       &displayName,
+				UserQuotaMaxBuckets: &maxBuckets,
+				OpMask:              &specOpMask,
+				System:              &system,
+				DefaultPlacement:    &placement,
+				DefaultStorageClass: &storageClass,
+			},
+			want: true,
+		},
+		"DisplayName": {
+			reason: "A different display name should be detected.",
+			params: v1alpha1.CephUserParameters{UID: &uid, DisplayedName: &otherDisplayName},
+			want:   false,
+		},
+		"MaxBuckets": {
+			reason: "A different bucket limit should be detected.",
+			params: v1alpha1.CephUserParameters{UID: &uid, UserQuotaMaxBuckets: &specMaxBuckets},
+			want:   false,
+		},
+		"OpMask": {
+			reason: "A different op-mask should be detected.",
+			params: v1alpha1.CephUserParameters{UID: &uid, OpMask: &readOnly},
+			want:   false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := IsCephUserUpToDate(tc.params, observed)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nIsCephUserUpToDate(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNormalizeOpMask(t *testing.T) {
+	cases := map[string]struct {
+		mask string
+		want string
+	}{
+		"Observed": {mask: "read, write, delete", want: "delete,read,write"},
+		"Wildcard": {mask: "*", want: "delete,read,write"},
+		"Spaces":   {mask: " Write ,read", want: "read,write"},
+		"Empty":    {mask: "", want: ""},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := NormalizeOpMask(tc.mask)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("NormalizeOpMask(%q): -want, +got:\n%s\n", tc.mask, diff)
+			}
+		})
+	}
+}
+
+func TestNewRadosgwClient(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		host    string
+		creds   Credentials
+		wantErr bool
+	}{
+		"Valid": {
+			reason: "An http URL with credentials should be accepted.",
+			host:   "http://rgw.example.com:8080",
+			creds:  Credentials{AccessKey: "AK", SecretKey: "SK"},
+		},
+		"NoScheme": {
+			reason:  "A host without scheme cannot be connected to.",
+			host:    "rgw.example.com",
+			creds:   Credentials{AccessKey: "AK", SecretKey: "SK"},
+			wantErr: true,
+		},
+		"Unparseable": {
+			reason:  "A host that is no URL should be rejected rather than panic.",
+			host:    "http://rgw example.com:port",
+			creds:   Credentials{AccessKey: "AK", SecretKey: "SK"},
+			wantErr: true,
+		},
+		"NoCredentials": {
+			reason:  "Missing credentials should be rejected rather than panic.",
+			host:    "https://rgw.example.com",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewRadosgwClient(tc.host, tc.creds)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("\n%s\nNewRadosgwClient(...): want error %t, got %v", tc.reason, tc.wantErr, err)
+			}
+		})
+	}
+}
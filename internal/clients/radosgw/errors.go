@@ -0,0 +1,256 @@
+package radosgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+)
+
+// Reason classifies why a radosgw request failed.
+type Reason string
+
+// Reasons a radosgw request can fail for.
+const (
+	// ReasonNotFound indicates the user, subuser, key or bucket does not
+	// exist.
+	ReasonNotFound Reason = "NotFound"
+
+	// ReasonConflict indicates the user, subuser, key or email already
+	// exists.
+	ReasonConflict Reason = "Conflict"
+
+	// ReasonUnauthorized indicates radosgw rejected the admin credentials,
+	// or they lack the capabilities required for the request.
+	ReasonUnauthorized Reason = "Unauthorized"
+
+	// ReasonThrottled indicates radosgw asked to slow down.
+	ReasonThrottled Reason = "Throttled"
+
+	// ReasonUnavailable indicates radosgw could not be reached or failed
+	// internally. Retrying later may succeed.
+	ReasonUnavailable Reason = "Unavailable"
+
+	// ReasonUnknown is any other failure, e.g. an invalid request.
+	ReasonUnknown Reason = "Unknown"
+)
+
+// Error codes radosgw returns that go-ceph has no error reason for.
+const (
+	codeNoSuchSubUser        = "NoSuchSubUser"
+	codeBucketAlreadyExists  = "BucketAlreadyExists"
+	codeInvalidAccessKeyID   = "InvalidAccessKeyId"
+	codeRequestTimeTooSkewed = "RequestTimeTooSkewed"
+	codeSlowDown             = "SlowDown"
+	codeTooManyRequests      = "TooManyRequests"
+	codeServiceUnavailable   = "ServiceUnavailable"
+	codeRateLimitExceeded    = "RateLimitExceeded"
+)
+
+var (
+	notFoundCodes = map[string]bool{
+		string(radosgw_admin.ErrNoSuchUser):   true,
+		string(radosgw_admin.ErrNoSuchKey):    true,
+		string(radosgw_admin.ErrNoSuchBucket): true,
+		string(radosgw_admin.ErrNoSuchObject): true,
+		string(radosgw_admin.ErrNoSuchCap):    true,
+		codeNoSuchSubUser:                     true,
+	}
+	conflictCodes = map[string]bool{
+		string(radosgw_admin.ErrUserExists):    true,
+		string(radosgw_admin.ErrKeyExists):     true,
+		string(radosgw_admin.ErrEmailExists):   true,
+		string(radosgw_admin.ErrSubuserExists): true,
+		codeBucketAlreadyExists:                true,
+	}
+	unauthorizedCodes = map[string]bool{
+		string(radosgw_admin.ErrAccessDenied):          true,
+		string(radosgw_admin.ErrSignatureDoesNotMatch): true,
+		codeInvalidAccessKeyID:                         true,
+		codeRequestTimeTooSkewed:                       true,
+	}
+	throttledCodes = map[string]bool{
+		codeSlowDown:          true,
+		codeTooManyRequests:   true,
+		codeRateLimitExceeded: true,
+	}
+	unavailableCodes = map[string]bool{
+		string(radosgw_admin.ErrInternalError): true,
+		codeServiceUnavailable:                 true,
+	}
+)
+
+// StatusError is a failed radosgw Admin Ops request. Unlike the errors go-ceph
+// returns it includes the HTTP status, but it formats the same and matches the
+// go-ceph error reasons with errors.Is.
+type StatusError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"Code,omitempty"`
+	RequestID  string `json:"RequestId,omitempty"`
+	HostID     string `json:"HostId,omitempty"`
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s %s", e.Code, e.RequestID, e.HostID)
+}
+
+// Is reports whether the supplied target is the go-ceph error reason for the
+// code of this error, e.g. radosgw_admin.ErrNoSuchUser.
+func (e *StatusError) Is(target error) bool {
+	return reflect.TypeOf(target) == reflect.TypeOf(radosgw_admin.ErrNoSuchUser) && target.Error() == e.Code
+}
+
+// statusClient returns a StatusError for every response radosgw answers with
+// an error. go-ceph returns errors of the HTTP client as is, so this is how the
+// HTTP status of a failed request reaches the caller.
+type statusClient struct {
+	client radosgw_admin.HTTPClient
+}
+
+func (c statusClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil || resp.StatusCode < http.StatusMultipleChoices {
+		return resp, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	return nil, newStatusError(resp)
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	e := &StatusError{}
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		// Not every error response has a body, e.g. those of a proxy in
+		// front of radosgw, so the code may remain empty.
+		_ = json.Unmarshal(body, e)
+	}
+	e.StatusCode = resp.StatusCode
+	return e
+}
+
+// Classify returns why the supplied radosgw request error occurred.
+func Classify(err error) Reason {
+	if err == nil {
+		return ""
+	}
+
+	se := &StatusError{}
+	if errors.As(err, &se) {
+		return classifyStatus(se.StatusCode, se.Code)
+	}
+
+	te := &ThrottleError{}
+	if errors.As(err, &te) {
+		return te.Reason
+	}
+
+	// Errors of clients that do not use a statusClient carry no HTTP
+	// status.
+	if code, ok := goCephCode(err); ok {
+		return classifyStatus(0, code)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ReasonUnavailable
+	}
+	return ReasonUnknown
+}
+
+func classifyStatus(status int, code string) Reason {
+	switch {
+	case notFoundCodes[code]:
+		return ReasonNotFound
+	case conflictCodes[code]:
+		return ReasonConflict
+	case unauthorizedCodes[code]:
+		return ReasonUnauthorized
+	case throttledCodes[code]:
+		return ReasonThrottled
+	case unavailableCodes[code]:
+		return ReasonUnavailable
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		return ReasonNotFound
+	case status == http.StatusConflict:
+		return ReasonConflict
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ReasonUnauthorized
+	case status == http.StatusTooManyRequests:
+		return ReasonThrottled
+	case status >= http.StatusInternalServerError:
+		return ReasonUnavailable
+	}
+	return ReasonUnknown
+}
+
+// goCephCode returns the radosgw error code of an error returned by go-ceph.
+// go-ceph does not export its error type, so the code is found by matching the
+// error against the reasons it does export.
+func goCephCode(err error) (string, bool) {
+	for _, reason := range goCephReasons {
+		if errors.Is(err, reason) {
+			return reason.Error(), true
+		}
+	}
+	return "", false
+}
+
+var goCephReasons = []error{
+	radosgw_admin.ErrNoSuchUser,
+	radosgw_admin.ErrNoSuchKey,
+	radosgw_admin.ErrNoSuchBucket,
+	radosgw_admin.ErrNoSuchObject,
+	radosgw_admin.ErrNoSuchCap,
+	radosgw_admin.ErrUserExists,
+	radosgw_admin.ErrKeyExists,
+	radosgw_admin.ErrEmailExists,
+	radosgw_admin.ErrSubuserExists,
+	radosgw_admin.ErrAccessDenied,
+	radosgw_admin.ErrSignatureDoesNotMatch,
+	radosgw_admin.ErrInternalError,
+}
+
+// IsNotFound returns true if the supplied error indicates that the requested
+// user, subuser, key or bucket does not exist.
+func IsNotFound(err error) bool { return Classify(err) == ReasonNotFound }
+
+// IsConflict returns true if the supplied error indicates that what was to be
+// created already exists.
+func IsConflict(err error) bool { return Classify(err) == ReasonConflict }
+
+// IsUnauthorized returns true if the supplied error indicates that radosgw
+// rejected the admin credentials.
+func IsUnauthorized(err error) bool { return Classify(err) == ReasonUnauthorized }
+
+// IsAccessDenied returns true if the supplied error indicates that radosgw
+// accepted the admin credentials, but they lack the capabilities required for
+// the request. Rejected credentials are reported with other error codes, e.g.
+// InvalidAccessKeyId or SignatureDoesNotMatch.
+func IsAccessDenied(err error) bool {
+	se := &StatusError{}
+	if errors.As(err, &se) {
+		return se.Code == string(radosgw_admin.ErrAccessDenied)
+	}
+	code, _ := goCephCode(err)
+	return code == string(radosgw_admin.ErrAccessDenied)
+}
+
+// IsThrottled returns true if the supplied error indicates that radosgw asked
+// to slow down.
+func IsThrottled(err error) bool { return Classify(err) == ReasonThrottled }
+
+// IsRetryable returns true if the supplied request error is expected to go away
+// without any change, i.e. radosgw was throttling or unavailable.
+func IsRetryable(err error) bool {
+	r := Classify(err)
+	return r == ReasonThrottled || r == ReasonUnavailable
+}
@@ -0,0 +1,163 @@
+package radosgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestClassify(t *testing.T) {
+	type response struct {
+		status int
+		code   string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		response response
+		want     Reason
+	}{
+		"NoSuchUser": {
+			reason:   "A missing user should be not found.",
+			response: response{status: http.StatusNotFound, code: "NoSuchUser"},
+			want:     ReasonNotFound,
+		},
+		"NoSuchSubUser": {
+			reason:   "A missing subuser should be not found, though go-ceph has no reason for it.",
+			response: response{status: http.StatusNotFound, code: "NoSuchSubUser"},
+			want:     ReasonNotFound,
+		},
+		"UserAlreadyExists": {
+			reason:   "An existing user should conflict.",
+			response: response{status: http.StatusConflict, code: "UserAlreadyExists"},
+			want:     ReasonConflict,
+		},
+		"AccessDenied": {
+			reason:   "Credentials that lack a capability should be unauthorized.",
+			response: response{status: http.StatusForbidden, code: "AccessDenied"},
+			want:     ReasonUnauthorized,
+		},
+		"SignatureDoesNotMatch": {
+			reason:   "A wrong secret key should be unauthorized.",
+			response: response{status: http.StatusForbidden, code: "SignatureDoesNotMatch"},
+			want:     ReasonUnauthorized,
+		},
+		"SlowDown": {
+			reason:   "radosgw asking to slow down should be throttled.",
+			response: response{status: http.StatusServiceUnavailable, code: "SlowDown"},
+			want:     ReasonThrottled,
+		},
+		"TooManyRequests": {
+			reason:   "A 429 without a known code should be throttled.",
+			response: response{status: http.StatusTooManyRequests},
+			want:     ReasonThrottled,
+		},
+		"BadGateway": {
+			reason:   "A proxy in front of radosgw failing should be unavailable.",
+			response: response{status: http.StatusBadGateway},
+			want:     ReasonUnavailable,
+		},
+		"InvalidArgument": {
+			reason:   "Invalid requests are neither transient nor conflicts.",
+			response: response{status: http.StatusBadRequest, code: "InvalidArgument"},
+			want:     ReasonUnknown,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.response.status)
+				if tc.response.code != "" {
+					_ = json.NewEncoder(w).Encode(map[string]string{"Code": tc.response.code})
+				}
+			}))
+			defer srv.Close()
+
+			api, err := NewRadosgwClient(srv.URL, Credentials{AccessKey: "AK", SecretKey: "SK"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = api.GetUserInfo(context.Background(), "user")
+			if diff := cmp.Diff(tc.want, Classify(errors.Wrap(err, "wrapped"))); diff != "" {
+				t.Errorf("\n%s\nClassify(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIsAccessDenied(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   bool
+	}{
+		"AccessDenied": {
+			reason: "Credentials that lack a capability should be denied access.",
+			err:    &StatusError{StatusCode: http.StatusForbidden, Code: "AccessDenied"},
+			want:   true,
+		},
+		"GoCeph": {
+			reason: "Errors of go-ceph should be denied access by their code.",
+			err:    radosgw_admin.ErrAccessDenied,
+			want:   true,
+		},
+		"InvalidAccessKeyId": {
+			reason: "Credentials radosgw does not know should not be denied access, but rejected.",
+			err:    &StatusError{StatusCode: http.StatusForbidden, Code: "InvalidAccessKeyId"},
+		},
+		"SignatureDoesNotMatch": {
+			reason: "A wrong secret key should not be denied access, but rejected.",
+			err:    &StatusError{StatusCode: http.StatusForbidden, Code: "SignatureDoesNotMatch"},
+		},
+		"Forbidden": {
+			reason: "A 403 without a code should not be denied access.",
+			err:    &StatusError{StatusCode: http.StatusForbidden},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := IsAccessDenied(errors.Wrap(tc.err, "wrapped")); got != tc.want {
+				t.Errorf("\n%s\nIsAccessDenied(...): want %t, got %t", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestClassifyGoCeph(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"Code": "NoSuchUser"})
+	}))
+	defer srv.Close()
+
+	// Clients without a statusClient return the errors of go-ceph.
+	api, err := radosgw_admin.New(srv.URL, "AK", "SK", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.GetUser(context.Background(), radosgw_admin.User{ID: "user"})
+	if got := Classify(err); got != ReasonNotFound {
+		t.Errorf("Classify(...): want %s, got %s", ReasonNotFound, got)
+	}
+}
+
+func TestStatusErrorIs(t *testing.T) {
+	err := error(&StatusError{StatusCode: http.StatusNotFound, Code: "NoSuchUser"})
+	if !errors.Is(err, radosgw_admin.ErrNoSuchUser) {
+		t.Errorf("a StatusError should match the go-ceph reason of its code")
+	}
+	if errors.Is(err, radosgw_admin.ErrNoSuchBucket) {
+		t.Errorf("a StatusError should not match the go-ceph reason of another code")
+	}
+	if errors.Is(err, errors.New("NoSuchUser")) {
+		t.Errorf("a StatusError should only match go-ceph reasons")
+	}
+}
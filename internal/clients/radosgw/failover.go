@@ -0,0 +1,207 @@
+package radosgw
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+const errNoEndpoints = "no radosgw endpoint specified"
+
+// endpointCooldown is how long a gateway that could not be reached is passed
+// over, before requests are sent to it again.
+const endpointCooldown = 30 * time.Second
+
+// Endpoints returns the URLs of the radosgw gateways of the supplied
+// ProviderConfig, its hostname first.
+func Endpoints(pc *apisv1alpha1.ProviderConfig) []string {
+	endpoints := []string{}
+	seen := map[string]bool{}
+	for _, e := range append([]string{pc.Spec.HostName}, pc.Spec.Endpoints...) {
+		if e == "" || seen[e] {
+			continue
+		}
+		seen[e] = true
+		endpoints = append(endpoints, e)
+	}
+	return endpoints
+}
+
+// NewClient returns a client for the Admin Ops API of the radosgw gateways at
+// the supplied endpoints. Requests are sent to the first gateway that is up,
+// and fail over to the next one when it cannot be reached.
+func NewClient(endpoints []string, creds Credentials) (Client, error) {
+	switch len(endpoints) {
+	case 0:
+		return nil, errors.New(errNoEndpoints)
+	case 1:
+		return NewRadosgwClient(endpoints[0], creds)
+	}
+
+	c := &failoverClient{now: time.Now, clients: make([]Client, len(endpoints)), downUntil: make([]time.Time, len(endpoints))}
+	for i, e := range endpoints {
+		rc, err := NewRadosgwClient(e, creds)
+		if err != nil {
+			return nil, err
+		}
+		c.clients[i] = rc
+	}
+	return c, nil
+}
+
+// A failoverClient sends requests to the first of several gateways of the same
+// radosgw that is up. Gateways that cannot be reached are considered down for
+// a while, during which requests are only sent to them when every gateway is
+// down.
+type failoverClient struct {
+	now     func() time.Time
+	clients []Client
+
+	mu        sync.Mutex
+	downUntil []time.Time
+}
+
+// order returns the indexes of the gateways in the order they are tried: those
+// that are up, then those that are down, the one that is up again soonest
+// first.
+func (c *failoverClient) order() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	order := make([]int, len(c.clients))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		upA, upB := !now.Before(c.downUntil[order[a]]), !now.Before(c.downUntil[order[b]])
+		if upA || upB {
+			return upA && !upB
+		}
+		return c.downUntil[order[a]].Before(c.downUntil[order[b]])
+	})
+	return order
+}
+
+func (c *failoverClient) record(i int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gatewayDown(err) {
+		c.downUntil[i] = c.now().Add(endpointCooldown)
+		return
+	}
+	c.downUntil[i] = time.Time{}
+}
+
+// notSent returns whether the supplied error indicates a request could not be
+// sent to its gateway at all, so radosgw cannot have applied it.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// gatewayDown returns whether the supplied error indicates the gateway a
+// request was sent to is down, rather than radosgw itself. A proxy in front of
+// the gateway may still have forwarded the request before it gave up, e.g.
+// when it timed out, so radosgw may have applied it.
+func gatewayDown(err error) bool {
+	if notSent(err) {
+		return true
+	}
+	// Proxies in front of a gateway that is down answer without a radosgw
+	// error code.
+	se := &StatusError{}
+	if errors.As(err, &se) && se.Code == "" {
+		switch se.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+// failover sends a request to the gateways of the supplied client in turn,
+// for as long as the supplied retry function allows. Idempotent requests are
+// retried whenever a gateway is down. Others are retried only when they could
+// not be sent, lest radosgw apply them twice.
+func failover[T any](ctx context.Context, c *failoverClient, retry func(error) bool, call func(rc Client) (T, error)) (T, error) {
+	var out T
+	var err error
+	for _, i := range c.order() {
+		out, err = call(c.clients[i])
+		c.record(i, err)
+		if !retry(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return out, err
+}
+
+func (c *failoverClient) GetUserInfo(ctx context.Context, uid string) (UserInfo, error) {
+	return failover(ctx, c, gatewayDown, func(rc Client) (UserInfo, error) { return rc.GetUserInfo(ctx, uid) })
+}
+
+func (c *failoverClient) CreateUser(ctx context.Context, user radosgw_admin.User) (radosgw_admin.User, error) {
+	return failover(ctx, c, notSent, func(rc Client) (radosgw_admin.User, error) { return rc.CreateUser(ctx, user) })
+}
+
+func (c *failoverClient) ModifyUserAttributes(ctx context.Context, uid string, attrs UserAttributes) error {
+	_, err := failover(ctx, c, gatewayDown, func(rc Client) (struct{}, error) { return struct{}{}, rc.ModifyUserAttributes(ctx, uid, attrs) })
+	return err
+}
+
+func (c *failoverClient) RemoveUser(ctx context.Context, user radosgw_admin.User) error {
+	_, err := failover(ctx, c, notSent, func(rc Client) (struct{}, error) { return struct{}{}, rc.RemoveUser(ctx, user) })
+	return err
+}
+
+func (c *failoverClient) ListUsers(ctx context.Context) ([]string, error) {
+	return failover(ctx, c, gatewayDown, func(rc Client) ([]string, error) { return rc.ListUsers(ctx) })
+}
+
+func (c *failoverClient) SetUserQuota(ctx context.Context, quota radosgw_admin.QuotaSpec) error {
+	_, err := failover(ctx, c, gatewayDown, func(rc Client) (struct{}, error) { return struct{}{}, rc.SetUserQuota(ctx, quota) })
+	return err
+}
+
+func (c *failoverClient) ListUsersBuckets(ctx context.Context, uid string) ([]string, error) {
+	return failover(ctx, c, gatewayDown, func(rc Client) ([]string, error) { return rc.ListUsersBuckets(ctx, uid) })
+}
+
+func (c *failoverClient) CreateKey(ctx context.Context, key radosgw_admin.UserKeySpec) (*[]radosgw_admin.UserKeySpec, error) {
+	return failover(ctx, c, notSent, func(rc Client) (*[]radosgw_admin.UserKeySpec, error) { return rc.CreateKey(ctx, key) })
+}
+
+func (c *failoverClient) RemoveKey(ctx context.Context, key radosgw_admin.UserKeySpec) error {
+	_, err := failover(ctx, c, notSent, func(rc Client) (struct{}, error) { return struct{}{}, rc.RemoveKey(ctx, key) })
+	return err
+}
+
+func (c *failoverClient) CreateSubuser(ctx context.Context, user radosgw_admin.User, subuser radosgw_admin.SubuserSpec) error {
+	_, err := failover(ctx, c, notSent, func(rc Client) (struct{}, error) { return struct{}{}, rc.CreateSubuser(ctx, user, subuser) })
+	return err
+}
+
+func (c *failoverClient) RemoveSubuser(ctx context.Context, user radosgw_admin.User, subuser radosgw_admin.SubuserSpec) error {
+	_, err := failover(ctx, c, notSent, func(rc Client) (struct{}, error) { return struct{}{}, rc.RemoveSubuser(ctx, user, subuser) })
+	return err
+}
+
+func (c *failoverClient) AddUserCap(ctx context.Context, uid, userCap string) ([]radosgw_admin.UserCapSpec, error) {
+	return failover(ctx, c, gatewayDown, func(rc Client) ([]radosgw_admin.UserCapSpec, error) { return rc.AddUserCap(ctx, uid, userCap) })
+}
+
+func (c *failoverClient) RemoveUserCap(ctx context.Context, uid, userCap string) ([]radosgw_admin.UserCapSpec, error) {
+	return failover(ctx, c, notSent, func(rc Client) ([]radosgw_admin.UserCapSpec, error) { return rc.RemoveUserCap(ctx, uid, userCap) })
+}
+
+func (c *failoverClient) GetInfo(ctx context.Context) (Info, error) {
+	return failover(ctx, c, gatewayDown, func(rc Client) (Info, error) { return rc.GetInfo(ctx) })
+}
@@ -0,0 +1,171 @@
+package radosgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/google/go-cmp/cmp"
+
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+func TestEndpoints(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		spec   apisv1alpha1.ProviderConfigSpec
+		want   []string
+	}{
+		"HostName": {
+			reason: "A ProviderConfig with only a hostname should have it as its only endpoint.",
+			spec:   apisv1alpha1.ProviderConfigSpec{HostName: "http://a"},
+			want:   []string{"http://a"},
+		},
+		"Endpoints": {
+			reason: "A ProviderConfig without a hostname should have its endpoints.",
+			spec:   apisv1alpha1.ProviderConfigSpec{Endpoints: []string{"http://a", "http://b"}},
+			want:   []string{"http://a", "http://b"},
+		},
+		"Both": {
+			reason: "The hostname should come first, and endpoints should not be repeated.",
+			spec:   apisv1alpha1.ProviderConfigSpec{HostName: "http://b", Endpoints: []string{"http://a", "http://b"}},
+			want:   []string{"http://b", "http://a"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := Endpoints(&apisv1alpha1.ProviderConfig{Spec: tc.spec})
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nEndpoints(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// gateway is a radosgw gateway that answers every request with the supplied
+// status, and a radosgw error code if it is not empty.
+type gateway struct {
+	status   int
+	code     string
+	requests atomic.Int32
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	g.requests.Add(1)
+	w.WriteHeader(g.status)
+	if g.code != "" {
+		_ = json.NewEncoder(w).Encode(map[string]string{"Code": g.code})
+		return
+	}
+	if g.status == http.StatusOK {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"info": Info{StorageBackends: []StorageBackend{{Name: "rados", ClusterID: "fsid"}}}})
+	}
+}
+
+func TestFailover(t *testing.T) {
+	// down is the URL of a gateway that was shut down, which refuses
+	// connections.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	down := closed.URL
+	closed.Close()
+
+	type want struct {
+		reason   Reason
+		requests []int32
+	}
+
+	cases := map[string]struct {
+		reason   string
+		gateways []*gateway
+		down     bool
+		write    bool
+		calls    int
+		want     want
+	}{
+		"Up": {
+			reason:   "Requests should be sent to the first gateway while it is up.",
+			gateways: []*gateway{{status: http.StatusOK}, {status: http.StatusOK}},
+			calls:    2,
+			want:     want{requests: []int32{2, 0}},
+		},
+		"Unreachable": {
+			reason:   "Requests should fail over when a gateway refuses connections.",
+			gateways: []*gateway{{status: http.StatusOK}},
+			down:     true,
+			calls:    2,
+			want:     want{requests: []int32{2}},
+		},
+		"BadGateway": {
+			reason:   "Requests should fail over when a proxy reports its gateway is down, which should be passed over after.",
+			gateways: []*gateway{{status: http.StatusBadGateway}, {status: http.StatusOK}},
+			calls:    2,
+			want:     want{requests: []int32{1, 2}},
+		},
+		"BadGatewayWrite": {
+			reason:   "Requests that are not idempotent should not fail over when a proxy reports its gateway is down, since it may have forwarded them.",
+			gateways: []*gateway{{status: http.StatusBadGateway}, {status: http.StatusOK}},
+			write:    true,
+			calls:    1,
+			want:     want{reason: ReasonUnavailable, requests: []int32{1, 0}},
+		},
+		"UnreachableWrite": {
+			reason:   "Requests that are not idempotent should fail over when a gateway refuses connections, since they were not sent.",
+			gateways: []*gateway{{status: http.StatusOK}},
+			down:     true,
+			write:    true,
+			calls:    1,
+			want:     want{requests: []int32{1}},
+		},
+		"SlowDown": {
+			reason:   "Requests radosgw itself refused should not fail over.",
+			gateways: []*gateway{{status: http.StatusServiceUnavailable, code: "SlowDown"}, {status: http.StatusOK}},
+			calls:    1,
+			want:     want{reason: ReasonThrottled, requests: []int32{1, 0}},
+		},
+		"AllDown": {
+			reason:   "The error of the last gateway should be returned when every gateway is down.",
+			gateways: []*gateway{{status: http.StatusBadGateway}, {status: http.StatusGatewayTimeout}},
+			calls:    1,
+			want:     want{reason: ReasonUnavailable, requests: []int32{1, 1}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			endpoints := []string{}
+			if tc.down {
+				endpoints = append(endpoints, down)
+			}
+			for _, g := range tc.gateways {
+				srv := httptest.NewServer(g)
+				defer srv.Close()
+				endpoints = append(endpoints, srv.URL)
+			}
+			c, err := NewClient(endpoints, Credentials{AccessKey: "AK", SecretKey: "SK"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got want
+			for i := 0; i < tc.calls; i++ {
+				if tc.write {
+					err = c.RemoveKey(context.Background(), radosgw_admin.UserKeySpec{UID: "user", AccessKey: "AK"})
+					continue
+				}
+				_, err = c.GetInfo(context.Background())
+			}
+			got.reason = Classify(err)
+			for _, g := range tc.gateways {
+				got.requests = append(got.requests, g.requests.Load())
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nfailover(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
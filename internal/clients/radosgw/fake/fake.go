@@ -0,0 +1,918 @@
+// Package fake implements an in-memory radosgw for tests. It reproduces the
+// semantics and error codes of the radosgw Admin Ops API as far as the
+// provider relies on them.
+package fake
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+// Methods of a Client, used as keys of Client.Errors.
+const (
+	MethodGetUserInfo          = "GetUserInfo"
+	MethodCreateUser           = "CreateUser"
+	MethodModifyUserAttributes = "ModifyUserAttributes"
+	MethodRemoveUser           = "RemoveUser"
+	MethodListUsers            = "ListUsers"
+	MethodSetUserQuota         = "SetUserQuota"
+	MethodListUsersBuckets     = "ListUsersBuckets"
+	MethodCreateKey            = "CreateKey"
+	MethodRemoveKey            = "RemoveKey"
+	MethodCreateSubuser        = "CreateSubuser"
+	MethodRemoveSubuser        = "RemoveSubuser"
+	MethodAddUserCap           = "AddUserCap"
+	MethodRemoveUserCap        = "RemoveUserCap"
+	MethodGetUserQuota         = "GetUserQuota"
+	MethodSetUserSuspended     = "SetUserSuspended"
+	MethodListBuckets          = "ListBuckets"
+	MethodGetBucketInfo        = "GetBucketInfo"
+	MethodRemoveBucket         = "RemoveBucket"
+	MethodGetInfo              = "GetInfo"
+)
+
+// Error codes radosgw returns.
+const (
+	codeNoSuchUser          = "NoSuchUser"
+	codeNoSuchKey           = "NoSuchKey"
+	codeNoSuchSubUser       = "NoSuchSubUser"
+	codeNoSuchCap           = "NoSuchCap"
+	codeNoSuchBucket        = "NoSuchBucket"
+	codeBucketNotEmpty      = "BucketNotEmpty"
+	codeUserAlreadyExists   = "UserAlreadyExists"
+	codeKeyExists           = "KeyExists"
+	codeEmailExists         = "EmailExists"
+	codeSubuserExists       = "SubuserExists"
+	codeInvalidArgument     = "InvalidArgument"
+	codeBucketAlreadyExists = "BucketAlreadyExists"
+)
+
+const (
+	defaultMaxBuckets = 1000
+	defaultOpMask     = "read, write, delete"
+
+	accessKeyLength = 20
+	secretKeyLength = 40
+
+	// FSID is the id of the cluster an in-memory radosgw reports.
+	FSID = "3a4b1c2d-0000-4000-8000-fa4ef5a4e000"
+)
+
+var (
+	errMissingUserID      = errors.New("missing user ID")
+	errMissingDisplayName = errors.New("missing user display name")
+	errMissingSubuserID   = errors.New("missing subuser ID")
+	errMissingAccessKey   = errors.New("missing user access key")
+	errMissingUserCap     = errors.New("missing user capabilities")
+	errMissingBucket      = errors.New("missing bucket name")
+)
+
+// opOrder is the order radosgw reports the operations of an op-mask in.
+var opOrder = []string{"read", "write", "delete"}
+
+// A Client is an in-memory radosgw. Its zero value is not usable; use
+// NewClient.
+type Client struct {
+	// Errors are returned by the method they are keyed by, e.g.
+	// MethodGetUserInfo, instead of calling it.
+	Errors map[string]error
+
+	mu      sync.Mutex
+	users   map[string]*user
+	buckets map[string]bucket
+}
+
+type bucket struct {
+	owner   string
+	objects bool
+}
+
+type user struct {
+	radosgw_admin.User
+	system bool
+}
+
+var _ radosgw.Client = &Client{}
+
+// NewClient returns an empty in-memory radosgw.
+func NewClient() *Client {
+	return &Client{
+		Errors:  map[string]error{},
+		users:   map[string]*user{},
+		buckets: map[string]bucket{},
+	}
+}
+
+// AddBucket creates a bucket owned by the user with the supplied id. Buckets
+// are not created through the Admin Ops API, so this is how tests create them.
+func (c *Client) AddBucket(uid, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buckets[name] = bucket{owner: uid}
+}
+
+// AddObject stores an object in the named bucket, so that radosgw refuses to
+// remove the bucket unless its objects are purged.
+func (c *Client) AddObject(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.buckets[name]; ok {
+		b.objects = true
+		c.buckets[name] = b
+	}
+}
+
+// GetInfo returns the cluster the in-memory radosgw stores its data in.
+func (c *Client) GetInfo(_ context.Context) (radosgw.Info, error) {
+	if err := c.injected(MethodGetInfo); err != nil {
+		return radosgw.Info{}, err
+	}
+	return radosgw.Info{StorageBackends: []radosgw.StorageBackend{{Name: "rados", ClusterID: FSID}}}, nil
+}
+
+// Users returns the ids of all users.
+func (c *Client) Users() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := make([]string, 0, len(c.users))
+	for id := range c.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func statusError(status int, code string) error {
+	return &radosgw.StatusError{StatusCode: status, Code: code}
+}
+
+func (c *Client) injected(method string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Errors[method]
+}
+
+// GetUserInfo returns the user with the supplied id.
+func (c *Client) GetUserInfo(_ context.Context, uid string) (radosgw.UserInfo, error) {
+	if err := c.injected(MethodGetUserInfo); err != nil {
+		return radosgw.UserInfo{}, err
+	}
+	if uid == "" {
+		return radosgw.UserInfo{}, errMissingUserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[uid]
+	if !ok {
+		return radosgw.UserInfo{}, statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	info := radosgw.UserInfo{User: copyUser(u.User)}
+	if u.system {
+		info.System = true
+	}
+	return info, nil
+}
+
+// CreateUser creates the supplied user. Like radosgw it generates a key unless
+// one is supplied or key generation is disabled.
+func (c *Client) CreateUser(_ context.Context, in radosgw_admin.User) (radosgw_admin.User, error) {
+	if err := c.injected(MethodCreateUser); err != nil {
+		return radosgw_admin.User{}, err
+	}
+	if in.ID == "" {
+		return radosgw_admin.User{}, errMissingUserID
+	}
+	if in.DisplayName == "" {
+		return radosgw_admin.User{}, errMissingDisplayName
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := in.ID
+	if in.Tenant != "" {
+		id = in.Tenant + "$" + in.ID
+	}
+	if _, ok := c.users[id]; ok {
+		return radosgw_admin.User{}, statusError(http.StatusConflict, codeUserAlreadyExists)
+	}
+	if in.Email != "" && c.emailOwner(in.Email) != "" {
+		return radosgw_admin.User{}, statusError(http.StatusConflict, codeEmailExists)
+	}
+
+	keys := []radosgw_admin.UserKeySpec{}
+	for _, k := range in.Keys {
+		if k.AccessKey == "" {
+			continue
+		}
+		if owner := c.keyOwner(k.AccessKey); owner != "" {
+			return radosgw_admin.User{}, statusError(http.StatusConflict, codeKeyExists)
+		}
+		secret := k.SecretKey
+		if secret == "" {
+			secret = randomString(secretKeyLength)
+		}
+		keys = append(keys, radosgw_admin.UserKeySpec{User: id, AccessKey: k.AccessKey, SecretKey: secret})
+	}
+	if len(keys) == 0 && (in.GenerateKey == nil || *in.GenerateKey) {
+		keys = append(keys, c.generateKey(id))
+	}
+
+	caps, err := parseCaps(in.UserCaps)
+	if err != nil {
+		return radosgw_admin.User{}, err
+	}
+
+	maxBuckets := defaultMaxBuckets
+	if in.MaxBuckets != nil {
+		maxBuckets = *in.MaxBuckets
+	}
+	suspended := 0
+	if in.Suspended != nil {
+		suspended = *in.Suspended
+	}
+	opMask := defaultOpMask
+	if in.OpMask != "" {
+		opMask = formatOpMask(in.OpMask)
+	}
+
+	u := &user{User: radosgw_admin.User{
+		ID:          id,
+		DisplayName: in.DisplayName,
+		Email:       in.Email,
+		Suspended:   &suspended,
+		MaxBuckets:  &maxBuckets,
+		Subusers:    []radosgw_admin.SubuserSpec{},
+		Keys:        keys,
+		SwiftKeys:   []radosgw_admin.SwiftKeySpec{},
+		Caps:        mergeCaps(nil, caps),
+		OpMask:      opMask,
+		BucketQuota: unlimitedQuota(),
+		UserQuota:   unlimitedQuota(),
+		Type:        "rgw",
+	}}
+	c.users[id] = u
+	return copyUser(u.User), nil
+}
+
+// ModifyUserAttributes sets the supplied attributes on the user with the
+// supplied id.
+func (c *Client) ModifyUserAttributes(_ context.Context, uid string, attrs radosgw.UserAttributes) error {
+	if err := c.injected(MethodModifyUserAttributes); err != nil {
+		return err
+	}
+	if uid == "" {
+		return errMissingUserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[uid]
+	if !ok {
+		return statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	if attrs.Email != nil && *attrs.Email != "" {
+		if owner := c.emailOwner(*attrs.Email); owner != "" && owner != uid {
+			return statusError(http.StatusConflict, codeEmailExists)
+		}
+	}
+
+	if attrs.DisplayName != nil {
+		u.DisplayName = *attrs.DisplayName
+	}
+	if attrs.Email != nil {
+		u.Email = *attrs.Email
+	}
+	if attrs.MaxBuckets != nil {
+		n := *attrs.MaxBuckets
+		u.MaxBuckets = &n
+	}
+	if attrs.OpMask != nil {
+		u.OpMask = formatOpMask(*attrs.OpMask)
+	}
+	if attrs.System != nil {
+		u.system = *attrs.System
+	}
+	if attrs.DefaultPlacement != nil {
+		// radosgw takes the storage class as part of the placement rule.
+		placement, class, _ := strings.Cut(*attrs.DefaultPlacement, "/")
+		u.DefaultPlacement = placement
+		u.DefaultStorageClass = class
+	}
+	return nil
+}
+
+// RemoveUser removes the supplied user. Like radosgw it refuses to remove a
+// user that owns buckets, unless their data is purged.
+func (c *Client) RemoveUser(_ context.Context, in radosgw_admin.User) error {
+	if err := c.injected(MethodRemoveUser); err != nil {
+		return err
+	}
+	if in.ID == "" {
+		return errMissingUserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.users[in.ID]; !ok {
+		return statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	purge := in.PurgeData != nil && *in.PurgeData != 0
+	for name, b := range c.buckets {
+		if b.owner != in.ID {
+			continue
+		}
+		if !purge {
+			return statusError(http.StatusConflict, codeBucketAlreadyExists)
+		}
+		delete(c.buckets, name)
+	}
+	delete(c.users, in.ID)
+	return nil
+}
+
+// SetUserQuota sets the user quota of the user the supplied quota is for.
+func (c *Client) SetUserQuota(_ context.Context, q radosgw_admin.QuotaSpec) error {
+	if err := c.injected(MethodSetUserQuota); err != nil {
+		return err
+	}
+	if q.UID == "" {
+		return errMissingUserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[q.UID]
+	if !ok {
+		return statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+
+	if q.Enabled != nil {
+		enabled := *q.Enabled
+		u.UserQuota.Enabled = &enabled
+	}
+	// radosgw reports unlimited sizes as a max_size of -1 and a
+	// max_size_kb of 0.
+	switch {
+	case q.MaxSizeKb != nil && *q.MaxSizeKb < 0:
+		size, kb := int64(-1), 0
+		u.UserQuota.MaxSize, u.UserQuota.MaxSizeKb = &size, &kb
+	case q.MaxSizeKb != nil:
+		size, kb := int64(*q.MaxSizeKb)*1024, *q.MaxSizeKb
+		u.UserQuota.MaxSize, u.UserQuota.MaxSizeKb = &size, &kb
+	case q.MaxSize != nil && *q.MaxSize < 0:
+		size, kb := int64(-1), 0
+		u.UserQuota.MaxSize, u.UserQuota.MaxSizeKb = &size, &kb
+	case q.MaxSize != nil:
+		size, kb := *q.MaxSize, int((*q.MaxSize+1023)/1024)
+		u.UserQuota.MaxSize, u.UserQuota.MaxSizeKb = &size, &kb
+	}
+	if q.MaxObjects != nil {
+		objects := *q.MaxObjects
+		if objects < 0 {
+			objects = -1
+		}
+		u.UserQuota.MaxObjects = &objects
+	}
+	return nil
+}
+
+// ListUsers returns the ids of all users.
+func (c *Client) ListUsers(_ context.Context) ([]string, error) {
+	if err := c.injected(MethodListUsers); err != nil {
+		return nil, err
+	}
+	return c.Users(), nil
+}
+
+// ListUsersBuckets returns the buckets owned by the user with the supplied id.
+func (c *Client) ListUsersBuckets(_ context.Context, uid string) ([]string, error) {
+	if err := c.injected(MethodListUsersBuckets); err != nil {
+		return nil, err
+	}
+	if uid == "" {
+		return nil, errMissingUserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.users[uid]; !ok {
+		return nil, statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	buckets := []string{}
+	for name, b := range c.buckets {
+		if b.owner == uid {
+			buckets = append(buckets, name)
+		}
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+// GetUserQuota returns the user quota of the user with the supplied id.
+func (c *Client) GetUserQuota(_ context.Context, uid string) (radosgw_admin.QuotaSpec, error) {
+	if err := c.injected(MethodGetUserQuota); err != nil {
+		return radosgw_admin.QuotaSpec{}, err
+	}
+	if uid == "" {
+		return radosgw_admin.QuotaSpec{}, errMissingUserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[uid]
+	if !ok {
+		return radosgw_admin.QuotaSpec{}, statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	return u.UserQuota, nil
+}
+
+// SetUserSuspended suspends, or resumes, the user with the supplied id.
+func (c *Client) SetUserSuspended(_ context.Context, uid string, suspended bool) error {
+	if err := c.injected(MethodSetUserSuspended); err != nil {
+		return err
+	}
+	if uid == "" {
+		return errMissingUserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[uid]
+	if !ok {
+		return statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	s := 0
+	if suspended {
+		s = 1
+	}
+	u.Suspended = &s
+	return nil
+}
+
+// UserByAccessKey returns the user the supplied S3 access key belongs to.
+func (c *Client) UserByAccessKey(ctx context.Context, accessKey string) (radosgw.UserInfo, error) {
+	c.mu.Lock()
+	uid := c.keyOwner(accessKey)
+	c.mu.Unlock()
+	if uid == "" {
+		return radosgw.UserInfo{}, statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	return c.GetUserInfo(ctx, uid)
+}
+
+// ListBuckets returns the names of all buckets.
+func (c *Client) ListBuckets(_ context.Context) ([]string, error) {
+	if err := c.injected(MethodListBuckets); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buckets := []string{}
+	for name := range c.buckets {
+		buckets = append(buckets, name)
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+// GetBucketInfo returns the named bucket.
+func (c *Client) GetBucketInfo(_ context.Context, name string) (radosgw_admin.Bucket, error) {
+	if err := c.injected(MethodGetBucketInfo); err != nil {
+		return radosgw_admin.Bucket{}, err
+	}
+	if name == "" {
+		return radosgw_admin.Bucket{}, errMissingBucket
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.buckets[name]
+	if !ok {
+		return radosgw_admin.Bucket{}, statusError(http.StatusNotFound, codeNoSuchBucket)
+	}
+	return radosgw_admin.Bucket{Bucket: name, Owner: b.owner, BucketQuota: unlimitedQuota()}, nil
+}
+
+// RemoveBucket removes the named bucket. Like radosgw it refuses to remove a
+// bucket that holds objects, unless they are purged.
+func (c *Client) RemoveBucket(_ context.Context, name string, purgeObjects bool) error {
+	if err := c.injected(MethodRemoveBucket); err != nil {
+		return err
+	}
+	if name == "" {
+		return errMissingBucket
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.buckets[name]
+	if !ok {
+		return statusError(http.StatusNotFound, codeNoSuchBucket)
+	}
+	if b.objects && !purgeObjects {
+		return statusError(http.StatusConflict, codeBucketNotEmpty)
+	}
+	delete(c.buckets, name)
+	return nil
+}
+
+// CreateKey adds an S3 key to the user, or subuser, the supplied key is for.
+// It returns every key of the user, including those of its subusers.
+func (c *Client) CreateKey(_ context.Context, k radosgw_admin.UserKeySpec) (*[]radosgw_admin.UserKeySpec, error) {
+	if err := c.injected(MethodCreateKey); err != nil {
+		return nil, err
+	}
+	if k.UID == "" {
+		return nil, errMissingUserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[k.UID]
+	if !ok {
+		return nil, statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	owner := k.UID
+	if k.SubUser != "" {
+		owner = subuserName(k.UID, k.SubUser)
+		if !hasSubuser(u.User, owner) {
+			return nil, statusError(http.StatusNotFound, codeNoSuchSubUser)
+		}
+	}
+
+	switch {
+	case k.AccessKey != "":
+		if o := c.keyOwner(k.AccessKey); o != "" && o != k.UID {
+			return nil, statusError(http.StatusConflict, codeKeyExists)
+		}
+		secret := k.SecretKey
+		if secret == "" {
+			secret = randomString(secretKeyLength)
+		}
+		replaced := false
+		for i := range u.Keys {
+			if u.Keys[i].AccessKey == k.AccessKey {
+				u.Keys[i].SecretKey, replaced = secret, true
+			}
+		}
+		if !replaced {
+			u.Keys = append(u.Keys, radosgw_admin.UserKeySpec{User: owner, AccessKey: k.AccessKey, SecretKey: secret})
+		}
+	case k.GenerateKey == nil || *k.GenerateKey:
+		u.Keys = append(u.Keys, c.generateKey(owner))
+	default:
+		return nil, statusError(http.StatusBadRequest, codeInvalidArgument)
+	}
+
+	keys := append([]radosgw_admin.UserKeySpec{}, u.Keys...)
+	return &keys, nil
+}
+
+// RemoveKey removes the S3 key with the supplied access key.
+func (c *Client) RemoveKey(_ context.Context, k radosgw_admin.UserKeySpec) error {
+	if err := c.injected(MethodRemoveKey); err != nil {
+		return err
+	}
+	if k.UID == "" {
+		return errMissingUserID
+	}
+	if k.AccessKey == "" {
+		return errMissingAccessKey
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[k.UID]
+	if !ok {
+		return statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	for i := range u.Keys {
+		if u.Keys[i].AccessKey == k.AccessKey {
+			u.Keys = append(u.Keys[:i], u.Keys[i+1:]...)
+			return nil
+		}
+	}
+	return statusError(http.StatusNotFound, codeNoSuchKey)
+}
+
+// CreateSubuser adds the supplied subuser to the supplied user.
+func (c *Client) CreateSubuser(_ context.Context, in radosgw_admin.User, s radosgw_admin.SubuserSpec) error {
+	if err := c.injected(MethodCreateSubuser); err != nil {
+		return err
+	}
+	if in.ID == "" {
+		return errMissingUserID
+	}
+	if s.Name == "" {
+		return errMissingSubuserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[in.ID]
+	if !ok {
+		return statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	name := subuserName(in.ID, s.Name)
+	if hasSubuser(u.User, name) {
+		return statusError(http.StatusConflict, codeSubuserExists)
+	}
+	u.Subusers = append(u.Subusers, radosgw_admin.SubuserSpec{Name: name, Access: s.Access})
+	return nil
+}
+
+// RemoveSubuser removes the supplied subuser from the supplied user. Like
+// radosgw it purges the keys of the subuser unless told not to.
+func (c *Client) RemoveSubuser(_ context.Context, in radosgw_admin.User, s radosgw_admin.SubuserSpec) error {
+	if err := c.injected(MethodRemoveSubuser); err != nil {
+		return err
+	}
+	if in.ID == "" {
+		return errMissingUserID
+	}
+	if s.Name == "" {
+		return errMissingSubuserID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[in.ID]
+	if !ok {
+		return statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	name := subuserName(in.ID, s.Name)
+	if !hasSubuser(u.User, name) {
+		return statusError(http.StatusNotFound, codeNoSuchSubUser)
+	}
+
+	subusers := []radosgw_admin.SubuserSpec{}
+	for _, su := range u.Subusers {
+		if su.Name != name {
+			subusers = append(subusers, su)
+		}
+	}
+	u.Subusers = subusers
+
+	if s.PurgeKeys == nil || *s.PurgeKeys {
+		keys := []radosgw_admin.UserKeySpec{}
+		for _, k := range u.Keys {
+			if k.User != name {
+				keys = append(keys, k)
+			}
+		}
+		u.Keys = keys
+	}
+	return nil
+}
+
+// AddUserCap grants the supplied capabilities, e.g. 'users=read;buckets=*',
+// to the user with the supplied id.
+func (c *Client) AddUserCap(_ context.Context, uid, userCap string) ([]radosgw_admin.UserCapSpec, error) {
+	if err := c.injected(MethodAddUserCap); err != nil {
+		return nil, err
+	}
+	if uid == "" {
+		return nil, errMissingUserID
+	}
+	if userCap == "" {
+		return nil, errMissingUserCap
+	}
+	caps, err := parseCaps(userCap)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[uid]
+	if !ok {
+		return nil, statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+	u.Caps = mergeCaps(u.Caps, caps)
+	return append([]radosgw_admin.UserCapSpec{}, u.Caps...), nil
+}
+
+// RemoveUserCap revokes the supplied capabilities from the user with the
+// supplied id.
+func (c *Client) RemoveUserCap(_ context.Context, uid, userCap string) ([]radosgw_admin.UserCapSpec, error) {
+	if err := c.injected(MethodRemoveUserCap); err != nil {
+		return nil, err
+	}
+	if uid == "" {
+		return nil, errMissingUserID
+	}
+	if userCap == "" {
+		return nil, errMissingUserCap
+	}
+	caps, err := parseCaps(userCap)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[uid]
+	if !ok {
+		return nil, statusError(http.StatusNotFound, codeNoSuchUser)
+	}
+
+	current := capPerms(u.Caps)
+	for t, perms := range caps {
+		if _, ok := current[t]; !ok {
+			return nil, statusError(http.StatusNotFound, codeNoSuchCap)
+		}
+		for p := range perms {
+			delete(current[t], p)
+		}
+		if len(current[t]) == 0 {
+			delete(current, t)
+		}
+	}
+	u.Caps = formatCaps(current)
+	return append([]radosgw_admin.UserCapSpec{}, u.Caps...), nil
+}
+
+func (c *Client) keyOwner(accessKey string) string {
+	for id, u := range c.users {
+		for _, k := range u.Keys {
+			if k.AccessKey == accessKey {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+func (c *Client) emailOwner(email string) string {
+	for id, u := range c.users {
+		if strings.EqualFold(u.Email, email) {
+			return id
+		}
+	}
+	return ""
+}
+
+func (c *Client) generateKey(owner string) radosgw_admin.UserKeySpec {
+	for {
+		ak := randomString(accessKeyLength)
+		if c.keyOwner(ak) == "" {
+			return radosgw_admin.UserKeySpec{User: owner, AccessKey: ak, SecretKey: randomString(secretKeyLength)}
+		}
+	}
+}
+
+// subuserName returns the full name of a subuser, i.e. 'uid:name'. radosgw
+// accepts subusers both with and without the uid.
+func subuserName(uid, name string) string {
+	if strings.Contains(name, ":") {
+		return name
+	}
+	return uid + ":" + name
+}
+
+func hasSubuser(u radosgw_admin.User, name string) bool {
+	for _, su := range u.Subusers {
+		if su.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func unlimitedQuota() radosgw_admin.QuotaSpec {
+	enabled := false
+	size, kb, objects := int64(-1), 0, int64(-1)
+	return radosgw_admin.QuotaSpec{Enabled: &enabled, MaxSize: &size, MaxSizeKb: &kb, MaxObjects: &objects}
+}
+
+// formatOpMask returns the supplied op-mask the way radosgw reports it, e.g.
+// 'read, write'.
+func formatOpMask(mask string) string {
+	ops := map[string]bool{}
+	for _, op := range strings.Split(mask, ",") {
+		op = strings.ToLower(strings.TrimSpace(op))
+		if op == "*" {
+			return defaultOpMask
+		}
+		ops[op] = true
+	}
+	out := []string{}
+	for _, op := range opOrder {
+		if ops[op] {
+			out = append(out, op)
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// parseCaps parses capabilities like 'users=read;buckets=*' into the
+// permissions per type.
+func parseCaps(caps string) (map[string]map[string]bool, error) {
+	out := map[string]map[string]bool{}
+	if caps == "" {
+		return out, nil
+	}
+	for _, c := range strings.Split(caps, ";") {
+		t, perm, ok := strings.Cut(strings.TrimSpace(c), "=")
+		t, perm = strings.TrimSpace(t), strings.TrimSpace(perm)
+		if !ok || t == "" {
+			return nil, statusError(http.StatusBadRequest, codeInvalidArgument)
+		}
+		if out[t] == nil {
+			out[t] = map[string]bool{}
+		}
+		for _, p := range strings.Split(perm, ",") {
+			switch strings.TrimSpace(p) {
+			case "*":
+				out[t]["read"], out[t]["write"] = true, true
+			case "read", "write":
+				out[t][strings.TrimSpace(p)] = true
+			default:
+				return nil, statusError(http.StatusBadRequest, codeInvalidArgument)
+			}
+		}
+	}
+	return out, nil
+}
+
+func capPerms(caps []radosgw_admin.UserCapSpec) map[string]map[string]bool {
+	out := map[string]map[string]bool{}
+	for _, c := range caps {
+		out[c.Type] = map[string]bool{}
+		switch c.Perm {
+		case "*":
+			out[c.Type]["read"], out[c.Type]["write"] = true, true
+		default:
+			out[c.Type][c.Perm] = true
+		}
+	}
+	return out
+}
+
+func mergeCaps(current []radosgw_admin.UserCapSpec, add map[string]map[string]bool) []radosgw_admin.UserCapSpec {
+	perms := capPerms(current)
+	for t, ps := range add {
+		if perms[t] == nil {
+			perms[t] = map[string]bool{}
+		}
+		for p := range ps {
+			perms[t][p] = true
+		}
+	}
+	return formatCaps(perms)
+}
+
+// formatCaps returns capabilities the way radosgw reports them: sorted by type,
+// with '*' for read and write.
+func formatCaps(perms map[string]map[string]bool) []radosgw_admin.UserCapSpec {
+	caps := []radosgw_admin.UserCapSpec{}
+	for t, ps := range perms {
+		switch {
+		case ps["read"] && ps["write"]:
+			caps = append(caps, radosgw_admin.UserCapSpec{Type: t, Perm: "*"})
+		case ps["read"]:
+			caps = append(caps, radosgw_admin.UserCapSpec{Type: t, Perm: "read"})
+		case ps["write"]:
+			caps = append(caps, radosgw_admin.UserCapSpec{Type: t, Perm: "write"})
+		}
+	}
+	sort.Slice(caps, func(i, j int) bool { return caps[i].Type < caps[j].Type })
+	return caps
+}
+
+func copyUser(u radosgw_admin.User) radosgw_admin.User {
+	out := u
+	out.Subusers = append([]radosgw_admin.SubuserSpec{}, u.Subusers...)
+	out.Keys = append([]radosgw_admin.UserKeySpec{}, u.Keys...)
+	out.SwiftKeys = append([]radosgw_admin.SwiftKeySpec{}, u.SwiftKeys...)
+	out.Caps = append([]radosgw_admin.UserCapSpec{}, u.Caps...)
+	return out
+}
+
+const keyAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(keyAlphabet)))
+	for i := range b {
+		r, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = keyAlphabet[r.Int64()]
+	}
+	return string(b)
+}
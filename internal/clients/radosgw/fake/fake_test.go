@@ -0,0 +1,163 @@
+package fake
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	purge := false
+
+	cases := map[string]struct {
+		reason string
+		call   func(c *Client) error
+		want   error
+	}{
+		"UserExists": {
+			reason: "Creating a user twice should fail like radosgw does.",
+			call: func(c *Client) error {
+				_, err := c.CreateUser(ctx, radosgw_admin.User{ID: "user", DisplayName: "user"})
+				return err
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusConflict, Code: "UserAlreadyExists"},
+		},
+		"EmailExists": {
+			reason: "Emails should be unique across users.",
+			call: func(c *Client) error {
+				_, err := c.CreateUser(ctx, radosgw_admin.User{ID: "other", DisplayName: "other", Email: "USER@example.com"})
+				return err
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusConflict, Code: "EmailExists"},
+		},
+		"KeyExists": {
+			reason: "Access keys should be unique across users.",
+			call: func(c *Client) error {
+				_, err := c.CreateUser(ctx, radosgw_admin.User{ID: "other", DisplayName: "other", Keys: []radosgw_admin.UserKeySpec{{AccessKey: "AK", SecretKey: "SK"}}})
+				return err
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusConflict, Code: "KeyExists"},
+		},
+		"NoSuchUser": {
+			reason: "Operations on a missing user should fail like radosgw does.",
+			call: func(c *Client) error {
+				_, err := c.GetUserInfo(ctx, "other")
+				return err
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusNotFound, Code: "NoSuchUser"},
+		},
+		"NoSuchSubUser": {
+			reason: "Removing a missing subuser should fail like radosgw does.",
+			call: func(c *Client) error {
+				return c.RemoveSubuser(ctx, radosgw_admin.User{ID: "user"}, radosgw_admin.SubuserSpec{Name: "sub"})
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusNotFound, Code: "NoSuchSubUser"},
+		},
+		"NoSuchKey": {
+			reason: "Removing a missing key should fail like radosgw does.",
+			call: func(c *Client) error {
+				return c.RemoveKey(ctx, radosgw_admin.UserKeySpec{UID: "user", AccessKey: "other"})
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusNotFound, Code: "NoSuchKey"},
+		},
+		"HasBuckets": {
+			reason: "A user that owns buckets should only be removed with its data.",
+			call: func(c *Client) error {
+				c.AddBucket("user", "bucket")
+				return c.RemoveUser(ctx, radosgw_admin.User{ID: "user"})
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusConflict, Code: "BucketAlreadyExists"},
+		},
+		"SubuserKeysKept": {
+			reason: "Keys of a removed subuser should be kept when not purged.",
+			call: func(c *Client) error {
+				if err := c.CreateSubuser(ctx, radosgw_admin.User{ID: "user"}, radosgw_admin.SubuserSpec{Name: "sub"}); err != nil {
+					return err
+				}
+				if _, err := c.CreateKey(ctx, radosgw_admin.UserKeySpec{UID: "user", SubUser: "sub", AccessKey: "SUB"}); err != nil {
+					return err
+				}
+				if err := c.RemoveSubuser(ctx, radosgw_admin.User{ID: "user"}, radosgw_admin.SubuserSpec{Name: "user:sub", PurgeKeys: &purge}); err != nil {
+					return err
+				}
+				return c.RemoveKey(ctx, radosgw_admin.UserKeySpec{UID: "user", AccessKey: "SUB"})
+			},
+		},
+		"Injected": {
+			reason: "Injected errors should be returned instead of calling the method.",
+			call: func(c *Client) error {
+				c.Errors[MethodGetUserInfo] = &radosgw.StatusError{StatusCode: http.StatusServiceUnavailable}
+				_, err := c.GetUserInfo(ctx, "user")
+				return err
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusServiceUnavailable},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient()
+			if _, err := c.CreateUser(ctx, radosgw_admin.User{ID: "user", DisplayName: "user", Email: "user@example.com", Keys: []radosgw_admin.UserKeySpec{{AccessKey: "AK", SecretKey: "SK"}}}); err != nil {
+				t.Fatal(err)
+			}
+			err := tc.call(c)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\n-want error, +got error:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCaps(t *testing.T) {
+	ctx := context.Background()
+
+	cases := map[string]struct {
+		reason string
+		add    []string
+		remove []string
+		want   []radosgw_admin.UserCapSpec
+	}{
+		"Merged": {
+			reason: "Read and write on the same type should be reported as '*'.",
+			add:    []string{"users=read;buckets=write", "users=write"},
+			want:   []radosgw_admin.UserCapSpec{{Type: "buckets", Perm: "write"}, {Type: "users", Perm: "*"}},
+		},
+		"Removed": {
+			reason: "Removing a permission should leave the others.",
+			add:    []string{"users=*;buckets=read"},
+			remove: []string{"users=write", "buckets=read"},
+			want:   []radosgw_admin.UserCapSpec{{Type: "users", Perm: "read"}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient()
+			if _, err := c.CreateUser(ctx, radosgw_admin.User{ID: "user", DisplayName: "user"}); err != nil {
+				t.Fatal(err)
+			}
+			var got []radosgw_admin.UserCapSpec
+			var err error
+			for _, caps := range tc.add {
+				if got, err = c.AddUserCap(ctx, "user", caps); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, caps := range tc.remove {
+				if got, err = c.RemoveUserCap(ctx, "user", caps); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\n-want caps, +got caps:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+const (
+	adminPath = "/admin"
+	hostID    = "fake-radosgw"
+
+	codeNotImplemented = "NotImplemented"
+	codeMethodNotAllow = "MethodNotAllowed"
+)
+
+// A Server serves the radosgw Admin Ops API backed by an in-memory radosgw.
+// Requests must be signed, with AWS signature version 2 or 4, by a user with
+// the capabilities radosgw requires for them.
+type Server struct {
+	rgw      *Client
+	now      func() time.Time
+	requests atomic.Uint64
+}
+
+// NewServer returns a Server for the supplied in-memory radosgw. Use
+// Client.AddAdmin to create a user to sign requests with.
+func NewServer(c *Client) *Server {
+	return &Server{rgw: c, now: time.Now}
+}
+
+// userJSON is a user the way radosgw encodes it.
+type userJSON struct {
+	Tenant              string                       `json:"tenant"`
+	ID                  string                       `json:"user_id"`
+	DisplayName         string                       `json:"display_name"`
+	Email               string                       `json:"email"`
+	Suspended           int                          `json:"suspended"`
+	MaxBuckets          int                          `json:"max_buckets"`
+	Subusers            []radosgw_admin.SubuserSpec  `json:"subusers"`
+	Keys                []radosgw_admin.UserKeySpec  `json:"keys"`
+	SwiftKeys           []radosgw_admin.SwiftKeySpec `json:"swift_keys"`
+	Caps                []radosgw_admin.UserCapSpec  `json:"caps"`
+	OpMask              string                       `json:"op_mask"`
+	System              bool                         `json:"system"`
+	DefaultPlacement    string                       `json:"default_placement"`
+	DefaultStorageClass string                       `json:"default_storage_class"`
+	PlacementTags       []string                     `json:"placement_tags"`
+	BucketQuota         quotaJSON                    `json:"bucket_quota"`
+	UserQuota           quotaJSON                    `json:"user_quota"`
+	TempURLKeys         []string                     `json:"temp_url_keys"`
+	Type                string                       `json:"type"`
+	MfaIDs              []string                     `json:"mfa_ids"`
+}
+
+// quotaJSON is a quota the way radosgw encodes it.
+type quotaJSON struct {
+	Enabled    bool  `json:"enabled"`
+	CheckOnRaw bool  `json:"check_on_raw"`
+	MaxSize    int64 `json:"max_size"`
+	MaxSizeKb  int   `json:"max_size_kb"`
+	MaxObjects int64 `json:"max_objects"`
+}
+
+// bucketJSON is a bucket the way radosgw encodes it.
+type bucketJSON struct {
+	Bucket      string    `json:"bucket"`
+	Owner       string    `json:"owner"`
+	BucketQuota quotaJSON `json:"bucket_quota"`
+}
+
+// usageJSON is the usage of users the way radosgw encodes it.
+type usageJSON struct {
+	Entries []usageEntryJSON   `json:"entries"`
+	Summary []usageSummaryJSON `json:"summary"`
+}
+
+type usageEntryJSON struct {
+	User    string   `json:"user"`
+	Buckets []string `json:"buckets"`
+}
+
+type usageSummaryJSON struct {
+	User       string         `json:"user"`
+	Categories []string       `json:"categories"`
+	Total      usageTotalJSON `json:"total"`
+}
+
+type usageTotalJSON struct {
+	BytesSent     uint64 `json:"bytes_sent"`
+	BytesReceived uint64 `json:"bytes_received"`
+	Ops           uint64 `json:"ops"`
+	SuccessfulOps uint64 `json:"successful_ops"`
+}
+
+func toUserJSON(u radosgw.UserInfo) userJSON {
+	tenant := ""
+	if t, _, ok := strings.Cut(u.ID, "$"); ok {
+		tenant = t
+	}
+	return userJSON{
+		Tenant:              tenant,
+		ID:                  u.ID,
+		DisplayName:         u.DisplayName,
+		Email:               u.Email,
+		Suspended:           intValue(u.Suspended),
+		MaxBuckets:          intValue(u.MaxBuckets),
+		Subusers:            u.Subusers,
+		Keys:                u.Keys,
+		SwiftKeys:           u.SwiftKeys,
+		Caps:                u.Caps,
+		OpMask:              u.OpMask,
+		System:              bool(u.System),
+		DefaultPlacement:    u.DefaultPlacement,
+		DefaultStorageClass: u.DefaultStorageClass,
+		PlacementTags:       []string{},
+		BucketQuota:         toQuotaJSON(u.BucketQuota),
+		UserQuota:           toQuotaJSON(u.UserQuota),
+		TempURLKeys:         []string{},
+		Type:                u.Type,
+		MfaIDs:              []string{},
+	}
+}
+
+func toQuotaJSON(q radosgw_admin.QuotaSpec) quotaJSON {
+	out := quotaJSON{CheckOnRaw: q.CheckOnRaw}
+	if q.Enabled != nil {
+		out.Enabled = *q.Enabled
+	}
+	if q.MaxSize != nil {
+		out.MaxSize = *q.MaxSize
+	}
+	if q.MaxSizeKb != nil {
+		out.MaxSizeKb = *q.MaxSizeKb
+	}
+	if q.MaxObjects != nil {
+		out.MaxObjects = *q.MaxObjects
+	}
+	return out
+}
+
+func intValue(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// ServeHTTP serves a radosgw Admin Ops API request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := fmt.Sprintf("tx%021x-%s", s.requests.Add(1), hostID)
+
+	resource := strings.TrimPrefix(r.URL.Path, adminPath)
+	capType := ""
+	switch resource {
+	case "/user":
+		capType = "users"
+	case "/bucket":
+		capType = "buckets"
+	case "/usage":
+		capType = "usage"
+	case "/metadata/user":
+		capType = "metadata"
+	case "/info":
+		capType = "info"
+	default:
+		writeError(w, requestID, statusError(http.StatusNotFound, codeNotImplemented))
+		return
+	}
+
+	uid, err := s.rgw.authenticate(r, s.now())
+	if err == nil {
+		err = s.rgw.authorize(uid, capType, r.Method)
+	}
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	var body interface{}
+	switch resource {
+	case "/user":
+		body, err = s.user(r)
+	case "/bucket":
+		body, err = s.bucket(r)
+	case "/usage":
+		body, err = s.usage(r)
+	case "/metadata/user":
+		body, err = s.metadataUser(r)
+	case "/info":
+		body, err = s.info(r)
+	}
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amz-Request-Id", requestID)
+	if body == nil {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) user(r *http.Request) (interface{}, error) { //nolint:gocyclo // A switch over the operations of the user resource.
+	ctx := r.Context()
+	q := r.URL.Query()
+	uid := q.Get("uid")
+	_, quota := q["quota"]
+	_, key := q["key"]
+	_, caps := q["caps"]
+	_, subuser := q["subuser"]
+
+	switch {
+	case r.Method == http.MethodGet && quota:
+		if qt := q.Get("quota-type"); qt != "" && qt != "user" {
+			return nil, statusError(http.StatusNotImplemented, codeNotImplemented)
+		}
+		spec, err := s.rgw.GetUserQuota(ctx, uid)
+		return toQuotaJSON(spec), err
+
+	case r.Method == http.MethodGet:
+		var u radosgw.UserInfo
+		var err error
+		if ak := q.Get("access-key"); ak != "" && uid == "" {
+			u, err = s.rgw.UserByAccessKey(ctx, ak)
+		} else {
+			u, err = s.rgw.GetUserInfo(ctx, uid)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return toUserJSON(u), nil
+
+	case r.Method == http.MethodPut && quota:
+		if qt := q.Get("quota-type"); qt != "" && qt != "user" {
+			return nil, statusError(http.StatusNotImplemented, codeNotImplemented)
+		}
+		spec := radosgw_admin.QuotaSpec{UID: uid}
+		var err error
+		if spec.Enabled, err = boolParam(q, "enabled"); err != nil {
+			return nil, err
+		}
+		if spec.MaxSize, err = int64Param(q, "max-size"); err != nil {
+			return nil, err
+		}
+		if spec.MaxSizeKb, err = intParam(q, "max-size-kb"); err != nil {
+			return nil, err
+		}
+		if spec.MaxObjects, err = int64Param(q, "max-objects"); err != nil {
+			return nil, err
+		}
+		return nil, s.rgw.SetUserQuota(ctx, spec)
+
+	case r.Method == http.MethodPut && key:
+		spec := radosgw_admin.UserKeySpec{UID: uid, SubUser: q.Get("subuser"), AccessKey: q.Get("access-key"), SecretKey: q.Get("secret-key"), KeyType: q.Get("key-type")}
+		var err error
+		if spec.GenerateKey, err = boolParam(q, "generate-key"); err != nil {
+			return nil, err
+		}
+		keys, err := s.rgw.CreateKey(ctx, spec)
+		if err != nil {
+			return nil, err
+		}
+		return *keys, nil
+
+	case r.Method == http.MethodDelete && key:
+		return nil, s.rgw.RemoveKey(ctx, radosgw_admin.UserKeySpec{UID: uid, AccessKey: q.Get("access-key")})
+
+	case r.Method == http.MethodPut && caps:
+		return s.rgw.AddUserCap(ctx, uid, q.Get("user-caps"))
+
+	case r.Method == http.MethodDelete && caps:
+		return s.rgw.RemoveUserCap(ctx, uid, q.Get("user-caps"))
+
+	case r.Method == http.MethodPut && subuser:
+		return nil, s.rgw.CreateSubuser(ctx, radosgw_admin.User{ID: uid}, radosgw_admin.SubuserSpec{Name: q.Get("subuser"), Access: radosgw_admin.SubuserAccess(q.Get("access"))})
+
+	case r.Method == http.MethodDelete && subuser:
+		spec := radosgw_admin.SubuserSpec{Name: q.Get("subuser")}
+		var err error
+		if spec.PurgeKeys, err = boolParam(q, "purge-keys"); err != nil {
+			return nil, err
+		}
+		return nil, s.rgw.RemoveSubuser(ctx, radosgw_admin.User{ID: uid}, spec)
+
+	case r.Method == http.MethodPut:
+		return s.createUser(r)
+
+	case r.Method == http.MethodPost && !subuser:
+		return s.modifyUser(r)
+
+	case r.Method == http.MethodDelete:
+		user := radosgw_admin.User{ID: uid}
+		purge, err := boolParam(q, "purge-data")
+		if err != nil {
+			return nil, err
+		}
+		if purge != nil && *purge {
+			one := 1
+			user.PurgeData = &one
+		}
+		return nil, s.rgw.RemoveUser(ctx, user)
+	}
+	return nil, statusError(http.StatusMethodNotAllowed, codeMethodNotAllow)
+}
+
+func (s *Server) createUser(r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	user := radosgw_admin.User{
+		ID:          q.Get("uid"),
+		Tenant:      q.Get("tenant"),
+		DisplayName: q.Get("display-name"),
+		Email:       q.Get("email"),
+		UserCaps:    q.Get("user-caps"),
+		OpMask:      q.Get("op-mask"),
+	}
+	if ak := q.Get("access-key"); ak != "" {
+		user.Keys = []radosgw_admin.UserKeySpec{{AccessKey: ak, SecretKey: q.Get("secret-key")}}
+	}
+	var err error
+	if user.GenerateKey, err = boolParam(q, "generate-key"); err != nil {
+		return nil, err
+	}
+	if user.MaxBuckets, err = intParam(q, "max-buckets"); err != nil {
+		return nil, err
+	}
+	if user.Suspended, err = intParam(q, "suspended"); err != nil {
+		return nil, err
+	}
+	if _, err := s.rgw.CreateUser(r.Context(), user); err != nil {
+		return nil, err
+	}
+
+	id := user.ID
+	if user.Tenant != "" {
+		id = user.Tenant + "$" + user.ID
+	}
+	u, err := s.rgw.GetUserInfo(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	return toUserJSON(u), nil
+}
+
+func (s *Server) modifyUser(r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	uid := q.Get("uid")
+
+	attrs := radosgw.UserAttributes{
+		DisplayName:      stringParam(q, "display-name"),
+		Email:            stringParam(q, "email"),
+		OpMask:           stringParam(q, "op-mask"),
+		DefaultPlacement: stringParam(q, "default-placement"),
+	}
+	var err error
+	if attrs.MaxBuckets, err = intParam(q, "max-buckets"); err != nil {
+		return nil, err
+	}
+	if attrs.System, err = boolParam(q, "system"); err != nil {
+		return nil, err
+	}
+	if err := s.rgw.ModifyUserAttributes(ctx, uid, attrs); err != nil {
+		return nil, err
+	}
+
+	suspended, err := boolParam(q, "suspended")
+	if err != nil {
+		return nil, err
+	}
+	if suspended != nil {
+		if err := s.rgw.SetUserSuspended(ctx, uid, *suspended); err != nil {
+			return nil, err
+		}
+	}
+
+	// radosgw creates a key when asked to, or when one is supplied.
+	if ak := q.Get("access-key"); ak != "" || q.Get("generate-key") == "true" {
+		if _, err := s.rgw.CreateKey(ctx, radosgw_admin.UserKeySpec{UID: uid, AccessKey: ak, SecretKey: q.Get("secret-key")}); err != nil {
+			return nil, err
+		}
+	}
+
+	u, err := s.rgw.GetUserInfo(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return toUserJSON(u), nil
+}
+
+// infoJSON is the cluster info the way radosgw encodes it.
+type infoJSON struct {
+	Info radosgw.Info `json:"info"`
+}
+
+func (s *Server) info(r *http.Request) (interface{}, error) {
+	if r.Method != http.MethodGet {
+		return nil, statusError(http.StatusMethodNotAllowed, codeMethodNotAllow)
+	}
+	info, err := s.rgw.GetInfo(r.Context())
+	return infoJSON{Info: info}, err
+}
+
+func (s *Server) bucket(r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	name, uid := q.Get("bucket"), q.Get("uid")
+
+	switch r.Method {
+	case http.MethodGet:
+		if _, policy := q["policy"]; policy {
+			return nil, statusError(http.StatusNotImplemented, codeNotImplemented)
+		}
+		if name != "" {
+			b, err := s.rgw.GetBucketInfo(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			return bucketJSON{Bucket: b.Bucket, Owner: b.Owner, BucketQuota: toQuotaJSON(b.BucketQuota)}, nil
+		}
+
+		var names []string
+		var err error
+		if uid != "" {
+			names, err = s.rgw.ListUsersBuckets(ctx, uid)
+		} else {
+			names, err = s.rgw.ListBuckets(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if q.Get("stats") != "true" {
+			return names, nil
+		}
+		buckets := make([]bucketJSON, 0, len(names))
+		for _, n := range names {
+			b, err := s.rgw.GetBucketInfo(ctx, n)
+			if err != nil {
+				return nil, err
+			}
+			buckets = append(buckets, bucketJSON{Bucket: b.Bucket, Owner: b.Owner, BucketQuota: toQuotaJSON(b.BucketQuota)})
+		}
+		return buckets, nil
+
+	case http.MethodDelete:
+		purge, err := boolParam(q, "purge-objects")
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.rgw.RemoveBucket(ctx, name, purge != nil && *purge)
+	}
+	return nil, statusError(http.StatusMethodNotAllowed, codeMethodNotAllow)
+}
+
+// usage serves the usage of users. The in-memory radosgw serves no S3
+// requests, so every user has used nothing.
+func (s *Server) usage(r *http.Request) (interface{}, error) {
+	uid := r.URL.Query().Get("uid")
+	switch r.Method {
+	case http.MethodGet:
+		out := usageJSON{Entries: []usageEntryJSON{}, Summary: []usageSummaryJSON{}}
+		for _, id := range s.rgw.Users() {
+			if uid != "" && id != uid {
+				continue
+			}
+			out.Entries = append(out.Entries, usageEntryJSON{User: id, Buckets: []string{}})
+			out.Summary = append(out.Summary, usageSummaryJSON{User: id, Categories: []string{}})
+		}
+		return out, nil
+	case http.MethodDelete:
+		return nil, nil
+	}
+	return nil, statusError(http.StatusMethodNotAllowed, codeMethodNotAllow)
+}
+
+func (s *Server) metadataUser(r *http.Request) (interface{}, error) {
+	if r.Method != http.MethodGet {
+		return nil, statusError(http.StatusMethodNotAllowed, codeMethodNotAllow)
+	}
+	return s.rgw.ListUsers(r.Context())
+}
+
+func writeError(w http.ResponseWriter, requestID string, err error) {
+	se := &radosgw.StatusError{}
+	if !errors.As(err, &se) {
+		// Requests missing a parameter are all the in-memory radosgw
+		// fails without a status.
+		se = &radosgw.StatusError{StatusCode: http.StatusBadRequest, Code: codeInvalidArgument}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amz-Request-Id", requestID)
+	w.WriteHeader(se.StatusCode)
+	_ = json.NewEncoder(w).Encode(&radosgw.StatusError{Code: se.Code, RequestID: requestID, HostID: hostID})
+}
+
+func stringParam(q url.Values, name string) *string {
+	v, ok := q[name]
+	if !ok || len(v) == 0 {
+		return nil
+	}
+	return &v[0]
+}
+
+func boolParam(q url.Values, name string) (*bool, error) {
+	v := stringParam(q, name)
+	if v == nil || *v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(*v)
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest, codeInvalidArgument)
+	}
+	return &b, nil
+}
+
+func intParam(q url.Values, name string) (*int, error) {
+	v := stringParam(q, name)
+	if v == nil || *v == "" {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(*v)
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest, codeInvalidArgument)
+	}
+	return &i, nil
+}
+
+func int64Param(q url.Values, name string) (*int64, error) {
+	v := stringParam(q, name)
+	if v == nil || *v == "" {
+		return nil, nil
+	}
+	i, err := strconv.ParseInt(*v, 10, 64)
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest, codeInvalidArgument)
+	}
+	return &i, nil
+}
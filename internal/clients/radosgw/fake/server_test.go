@@ -0,0 +1,252 @@
+package fake
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // AWS signature version 2 is defined in terms of HMAC-SHA1.
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+func newTestServer(t *testing.T) (*Client, string) {
+	t.Helper()
+	c := NewClient()
+	if err := c.AddAdmin("admin", "ADMIN", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewServer(c))
+	t.Cleanup(srv.Close)
+	return c, srv.URL
+}
+
+func TestServerClient(t *testing.T) {
+	ctx := context.Background()
+	fake, url := newTestServer(t)
+	rgw, err := radosgw.NewRadosgwClient(url, radosgw.Credentials{AccessKey: "ADMIN", SecretKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxBuckets, maxObjects, system := 10, int64(100), true
+	if _, err := rgw.CreateUser(ctx, radosgw_admin.User{ID: "user", DisplayName: "User", MaxBuckets: &maxBuckets, Keys: []radosgw_admin.UserKeySpec{{AccessKey: "AK", SecretKey: "SK"}}}); err != nil {
+		t.Fatalf("CreateUser(...): %v", err)
+	}
+	if _, err := rgw.CreateUser(ctx, radosgw_admin.User{ID: "user", DisplayName: "User"}); !radosgw.IsConflict(err) {
+		t.Errorf("CreateUser(...): want conflict, got %v", err)
+	}
+	opMask, placement := "read", "default-placement/COLD"
+	if err := rgw.ModifyUserAttributes(ctx, "user", radosgw.UserAttributes{OpMask: &opMask, System: &system, DefaultPlacement: &placement}); err != nil {
+		t.Fatalf("ModifyUserAttributes(...): %v", err)
+	}
+	enabled := true
+	if err := rgw.SetUserQuota(ctx, radosgw_admin.QuotaSpec{UID: "user", QuotaType: "user", Enabled: &enabled, MaxObjects: &maxObjects}); err != nil {
+		t.Fatalf("SetUserQuota(...): %v", err)
+	}
+	if err := rgw.CreateSubuser(ctx, radosgw_admin.User{ID: "user"}, radosgw_admin.SubuserSpec{Name: "sub", Access: radosgw_admin.SubuserAccessRead}); err != nil {
+		t.Fatalf("CreateSubuser(...): %v", err)
+	}
+	if _, err := rgw.CreateKey(ctx, radosgw_admin.UserKeySpec{UID: "user", SubUser: "sub", AccessKey: "SUB", SecretKey: "SK"}); err != nil {
+		t.Fatalf("CreateKey(...): %v", err)
+	}
+	if _, err := rgw.AddUserCap(ctx, "user", "buckets=read"); err != nil {
+		t.Fatalf("AddUserCap(...): %v", err)
+	}
+
+	got, err := rgw.GetUserInfo(ctx, "user")
+	if err != nil {
+		t.Fatalf("GetUserInfo(...): %v", err)
+	}
+	want, err := fake.GetUserInfo(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("GetUserInfo(...): -want, +got:\n%s", diff)
+	}
+	if got.OpMask != "read" || !bool(got.System) || got.DefaultStorageClass != "COLD" || *got.UserQuota.MaxObjects != maxObjects {
+		t.Errorf("GetUserInfo(...): attributes were not modified: %+v", got)
+	}
+
+	fake.AddBucket("user", "bucket")
+	buckets, err := rgw.ListUsersBuckets(ctx, "user")
+	if diff := cmp.Diff([]string{"bucket"}, buckets); err != nil || diff != "" {
+		t.Errorf("ListUsersBuckets(...): %v: -want, +got:\n%s", err, diff)
+	}
+	if err := rgw.RemoveUser(ctx, radosgw_admin.User{ID: "user"}); !radosgw.IsConflict(err) {
+		t.Errorf("RemoveUser(...): want conflict, got %v", err)
+	}
+	purge := 1
+	if err := rgw.RemoveUser(ctx, radosgw_admin.User{ID: "user", PurgeData: &purge}); err != nil {
+		t.Errorf("RemoveUser(...): %v", err)
+	}
+	if _, err := rgw.GetUserInfo(ctx, "user"); !radosgw.IsNotFound(err) {
+		t.Errorf("GetUserInfo(...): want not found, got %v", err)
+	}
+
+	info, err := rgw.GetInfo(ctx)
+	if err != nil || info.FSID() != FSID {
+		t.Errorf("GetInfo(...): %v: want fsid %q, got %+v", err, FSID, info)
+	}
+}
+
+func TestServerGoCeph(t *testing.T) {
+	ctx := context.Background()
+	fake, url := newTestServer(t)
+	api, err := radosgw_admin.New(url, "ADMIN", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.CreateUser(ctx, radosgw_admin.User{ID: "user", DisplayName: "User"}); err != nil {
+		t.Fatalf("CreateUser(...): %v", err)
+	}
+	fake.AddBucket("user", "bucket")
+
+	users, err := api.GetUsers(ctx)
+	if diff := cmp.Diff(&[]string{"admin", "user"}, users); err != nil || diff != "" {
+		t.Errorf("GetUsers(...): %v: -want, +got:\n%s", err, diff)
+	}
+	b, err := api.GetBucketInfo(ctx, radosgw_admin.Bucket{Bucket: "bucket"})
+	if err != nil || b.Owner != "user" {
+		t.Errorf("GetBucketInfo(...): %v: want owner user, got %q", err, b.Owner)
+	}
+	usage, err := api.GetUsage(ctx, radosgw_admin.Usage{UserID: "user"})
+	if err != nil || len(usage.Summary) != 1 || usage.Summary[0].User != "user" {
+		t.Errorf("GetUsage(...): %v: want summary of user, got %+v", err, usage.Summary)
+	}
+	if err := api.RemoveBucket(ctx, radosgw_admin.Bucket{Bucket: "bucket"}); err != nil {
+		t.Errorf("RemoveBucket(...): %v", err)
+	}
+	if _, err := api.GetUser(ctx, radosgw_admin.User{ID: "other"}); !errors.Is(err, radosgw_admin.ErrNoSuchUser) {
+		t.Errorf("GetUser(...): want %v, got %v", radosgw_admin.ErrNoSuchUser, err)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	ctx := context.Background()
+	fake, url := newTestServer(t)
+	if _, err := fake.CreateUser(ctx, radosgw_admin.User{ID: "reader", DisplayName: "reader", UserCaps: "users=read", Keys: []radosgw_admin.UserKeySpec{{AccessKey: "READER", SecretKey: "secret"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		reason string
+		creds  radosgw.Credentials
+		call   func(radosgw.Client) error
+		want   error
+	}{
+		"Authorized": {
+			reason: "Requests signed by a user with the required capabilities should be served.",
+			creds:  radosgw.Credentials{AccessKey: "READER", SecretKey: "secret"},
+			call: func(c radosgw.Client) error {
+				_, err := c.GetUserInfo(ctx, "admin")
+				return err
+			},
+		},
+		"UnknownKey": {
+			reason: "Requests signed with a key radosgw does not know should be rejected.",
+			creds:  radosgw.Credentials{AccessKey: "OTHER", SecretKey: "secret"},
+			call: func(c radosgw.Client) error {
+				_, err := c.GetUserInfo(ctx, "admin")
+				return err
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "InvalidAccessKeyId"},
+		},
+		"WrongSecret": {
+			reason: "Requests signed with the wrong secret should be rejected.",
+			creds:  radosgw.Credentials{AccessKey: "ADMIN", SecretKey: "wrong"},
+			call: func(c radosgw.Client) error {
+				_, err := c.GetUserInfo(ctx, "admin")
+				return err
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "SignatureDoesNotMatch"},
+		},
+		"MissingCaps": {
+			reason: "Requests of a user without the required capabilities should be denied.",
+			creds:  radosgw.Credentials{AccessKey: "READER", SecretKey: "secret"},
+			call: func(c radosgw.Client) error {
+				return c.RemoveUser(ctx, radosgw_admin.User{ID: "admin"})
+			},
+			want: &radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "AccessDenied"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, err := radosgw.NewRadosgwClient(url, tc.creds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tc.call(c)
+			// Request and host ids are not compared.
+			if se := (&radosgw.StatusError{}); errors.As(err, &se) {
+				err = &radosgw.StatusError{StatusCode: se.StatusCode, Code: se.Code}
+			}
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\n-want error, +got error:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestServerSigV2(t *testing.T) {
+	_, url := newTestServer(t)
+
+	sign := func(secret string, date time.Time) *http.Request {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url+"/admin/user?quota&uid=admin&quota-type=user", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+		mac := hmac.New(sha1.New, []byte(secret))
+		mac.Write([]byte("GET\n\n\n" + req.Header.Get("Date") + "\n/admin/user?quota"))
+		req.Header.Set("Authorization", "AWS ADMIN:"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		return req
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *http.Request
+		want   int
+	}{
+		"Signed": {
+			reason: "Requests signed with signature version 2 should be served.",
+			req:    sign("secret", time.Now()),
+			want:   http.StatusOK,
+		},
+		"WrongSecret": {
+			reason: "Requests signed with the wrong secret should be rejected.",
+			req:    sign("wrong", time.Now()),
+			want:   http.StatusForbidden,
+		},
+		"Skewed": {
+			reason: "Requests signed too long ago should be rejected.",
+			req:    sign("secret", time.Now().Add(-time.Hour)),
+			want:   http.StatusForbidden,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.DefaultClient.Do(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close() //nolint:errcheck
+			if diff := cmp.Diff(tc.want, resp.StatusCode); diff != "" {
+				t.Errorf("\n%s\n-want status, +got status:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
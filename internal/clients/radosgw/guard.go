@@ -0,0 +1,378 @@
+package radosgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+const (
+	// DefaultRequestsPerSecond is the rate of requests made to a radosgw
+	// whose ProviderConfig does not specify one.
+	DefaultRequestsPerSecond = 50
+
+	// maxRateLimitWait is how long a request waits for the rate limit of its
+	// radosgw. Requests that would have to wait longer fail as throttled, so
+	// that a slow cluster does not hold on to the workers of every other.
+	maxRateLimitWait = time.Second
+
+	// breakerThreshold is how many requests in a row radosgw may fail as
+	// unavailable before its circuit opens.
+	breakerThreshold = 5
+
+	// minOpenDuration and maxOpenDuration bound how long a circuit stays open.
+	// It stays open twice as long each time it opens again in a row.
+	minOpenDuration = 5 * time.Second
+	maxOpenDuration = 5 * time.Minute
+
+	// openJitter is the factor by which how long a circuit stays open is
+	// randomly extended, so that controllers do not retry in lockstep.
+	openJitter = 0.5
+)
+
+// A ThrottleError is returned for requests the provider did not send to
+// radosgw, because it is rate limited or its circuit is open.
+type ThrottleError struct {
+	// Reason is why the request was not sent, i.e. ReasonThrottled for rate
+	// limited requests and ReasonUnavailable while the circuit is open.
+	Reason  Reason
+	Message string
+}
+
+func (e *ThrottleError) Error() string {
+	return e.Message
+}
+
+// A Breaker stops requests to a radosgw that keeps failing them, or that asked
+// to slow down, for a while. Once that while is over one request is let
+// through to find out whether radosgw recovered.
+type Breaker struct {
+	now    func() time.Time
+	jitter func(time.Duration) time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	opened    int
+	openUntil time.Time
+	probing   bool
+	lastErr   error
+}
+
+// NewBreaker returns a closed Breaker.
+func NewBreaker() *Breaker {
+	return &Breaker{
+		now:    time.Now,
+		jitter: func(d time.Duration) time.Duration { return wait.Jitter(d, openJitter) },
+	}
+}
+
+// Open returns whether the circuit is open and why. A circuit that waits for a
+// request to find out whether radosgw recovered is still open.
+func (b *Breaker) Open() (bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.opened == 0 {
+		return false, ""
+	}
+	return true, fmt.Sprintf("requests to radosgw are suspended after it failed %d times in a row, last with: %v", b.failures, b.lastErr)
+}
+
+// allow returns an error unless a request may be sent.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.opened == 0 {
+		return nil
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return &ThrottleError{
+			Reason:  ReasonUnavailable,
+			Message: fmt.Sprintf("circuit of radosgw is open until %s, last error: %v", b.openUntil.Format(time.RFC3339), b.lastErr),
+		}
+	}
+	b.probing = true
+	return nil
+}
+
+// abort a request that was allowed but not sent.
+func (b *Breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record the outcome of a request that was sent. Requests radosgw answered
+// close the circuit, even if it refused them. Requests it asked to slow down,
+// i.e. with a 503 or SlowDown response, open it right away; others that failed
+// as unavailable once they failed breakerThreshold times in a row.
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+
+	reason := Classify(err)
+	if reason != ReasonUnavailable && reason != ReasonThrottled {
+		b.failures, b.opened, b.lastErr = 0, 0, nil
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if !slowDown(err) && b.opened == 0 && b.failures < breakerThreshold {
+		return
+	}
+
+	d := minOpenDuration << b.opened
+	if d > maxOpenDuration || d <= 0 {
+		d = maxOpenDuration
+	}
+	b.opened++
+	b.openUntil = b.now().Add(b.jitter(d))
+}
+
+// slowDown returns whether radosgw asked for fewer requests.
+func slowDown(err error) bool {
+	if Classify(err) == ReasonThrottled {
+		return true
+	}
+	se := &StatusError{}
+	return errors.As(err, &se) && se.StatusCode == http.StatusServiceUnavailable
+}
+
+// A guard rate limits the requests to a radosgw and breaks its circuit.
+type guard struct {
+	limiter *rate.Limiter
+	breaker *Breaker
+}
+
+// acquire returns an error unless a request may be sent, waiting for the rate
+// limit if necessary. Requests that were acquired must be released.
+func (g *guard) acquire(ctx context.Context) error {
+	if err := g.breaker.allow(); err != nil {
+		return err
+	}
+	r := g.limiter.Reserve()
+	d := r.Delay()
+	if !r.OK() || d > maxRateLimitWait {
+		r.Cancel()
+		g.breaker.abort()
+		return &ThrottleError{Reason: ReasonThrottled, Message: "rate limit of requests to radosgw exceeded"}
+	}
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		g.breaker.abort()
+		return ctx.Err()
+	}
+}
+
+func (g *guard) release(err error) {
+	g.breaker.record(err)
+}
+
+// Guards rate limit and break the circuit of the requests made to the radosgw
+// of each ProviderConfig, so that a slow or failing cluster does not take the
+// reconciles of every other cluster down with it.
+type Guards struct {
+	mu     sync.Mutex
+	guards map[types.UID]*guard
+}
+
+// NewGuards returns Guards without any ProviderConfig.
+func NewGuards() *Guards {
+	return &Guards{guards: map[types.UID]*guard{}}
+}
+
+// Client returns a client that sends requests through the supplied client,
+// subject to the rate limit and circuit of the supplied ProviderConfig.
+func (g *Guards) Client(pc *apisv1alpha1.ProviderConfig, c Client) Client {
+	return &guardedClient{Client: c, guard: g.get(pc)}
+}
+
+// Breaker returns the Breaker of the supplied ProviderConfig.
+func (g *Guards) Breaker(pc *apisv1alpha1.ProviderConfig) *Breaker {
+	return g.get(pc).breaker
+}
+
+func (g *Guards) get(pc *apisv1alpha1.ProviderConfig) *guard {
+	limit, burst := rateLimit(pc)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gd, ok := g.guards[pc.GetUID()]
+	if !ok {
+		gd = &guard{limiter: rate.NewLimiter(limit, burst), breaker: NewBreaker()}
+		g.guards[pc.GetUID()] = gd
+	}
+	if gd.limiter.Limit() != limit || gd.limiter.Burst() != burst {
+		gd.limiter.SetLimit(limit)
+		gd.limiter.SetBurst(burst)
+	}
+	return gd
+}
+
+// rateLimit returns the rate limit of the supplied ProviderConfig.
+func rateLimit(pc *apisv1alpha1.ProviderConfig) (rate.Limit, int) {
+	rps := DefaultRequestsPerSecond
+	burst := 0
+	if rl := pc.Spec.RateLimit; rl != nil {
+		if rl.RequestsPerSecond != nil {
+			rps = *rl.RequestsPerSecond
+		}
+		if rl.Burst != nil {
+			burst = *rl.Burst
+		}
+	}
+	if burst == 0 {
+		burst = 2 * rps
+	}
+	return rate.Limit(rps), burst
+}
+
+// A guardedClient sends every request through a guard.
+type guardedClient struct {
+	Client
+	guard *guard
+}
+
+func (c *guardedClient) GetUserInfo(ctx context.Context, uid string) (UserInfo, error) {
+	if err := c.guard.acquire(ctx); err != nil {
+		return UserInfo{}, err
+	}
+	u, err := c.Client.GetUserInfo(ctx, uid)
+	c.guard.release(err)
+	return u, err
+}
+
+func (c *guardedClient) CreateUser(ctx context.Context, user radosgw_admin.User) (radosgw_admin.User, error) {
+	if err := c.guard.acquire(ctx); err != nil {
+		return radosgw_admin.User{}, err
+	}
+	u, err := c.Client.CreateUser(ctx, user)
+	c.guard.release(err)
+	return u, err
+}
+
+func (c *guardedClient) ModifyUserAttributes(ctx context.Context, uid string, attrs UserAttributes) error {
+	if err := c.guard.acquire(ctx); err != nil {
+		return err
+	}
+	err := c.Client.ModifyUserAttributes(ctx, uid, attrs)
+	c.guard.release(err)
+	return err
+}
+
+func (c *guardedClient) RemoveUser(ctx context.Context, user radosgw_admin.User) error {
+	if err := c.guard.acquire(ctx); err != nil {
+		return err
+	}
+	err := c.Client.RemoveUser(ctx, user)
+	c.guard.release(err)
+	return err
+}
+
+func (c *guardedClient) ListUsers(ctx context.Context) ([]string, error) {
+	if err := c.guard.acquire(ctx); err != nil {
+		return nil, err
+	}
+	users, err := c.Client.ListUsers(ctx)
+	c.guard.release(err)
+	return users, err
+}
+
+func (c *guardedClient) SetUserQuota(ctx context.Context, quota radosgw_admin.QuotaSpec) error {
+	if err := c.guard.acquire(ctx); err != nil {
+		return err
+	}
+	err := c.Client.SetUserQuota(ctx, quota)
+	c.guard.release(err)
+	return err
+}
+
+func (c *guardedClient) ListUsersBuckets(ctx context.Context, uid string) ([]string, error) {
+	if err := c.guard.acquire(ctx); err != nil {
+		return nil, err
+	}
+	buckets, err := c.Client.ListUsersBuckets(ctx, uid)
+	c.guard.release(err)
+	return buckets, err
+}
+
+func (c *guardedClient) CreateKey(ctx context.Context, key radosgw_admin.UserKeySpec) (*[]radosgw_admin.UserKeySpec, error) {
+	if err := c.guard.acquire(ctx); err != nil {
+		return nil, err
+	}
+	keys, err := c.Client.CreateKey(ctx, key)
+	c.guard.release(err)
+	return keys, err
+}
+
+func (c *guardedClient) RemoveKey(ctx context.Context, key radosgw_admin.UserKeySpec) error {
+	if err := c.guard.acquire(ctx); err != nil {
+		return err
+	}
+	err := c.Client.RemoveKey(ctx, key)
+	c.guard.release(err)
+	return err
+}
+
+func (c *guardedClient) CreateSubuser(ctx context.Context, user radosgw_admin.User, subuser radosgw_admin.SubuserSpec) error {
+	if err := c.guard.acquire(ctx); err != nil {
+		return err
+	}
+	err := c.Client.CreateSubuser(ctx, user, subuser)
+	c.guard.release(err)
+	return err
+}
+
+func (c *guardedClient) RemoveSubuser(ctx context.Context, user radosgw_admin.User, subuser radosgw_admin.SubuserSpec) error {
+	if err := c.guard.acquire(ctx); err != nil {
+		return err
+	}
+	err := c.Client.RemoveSubuser(ctx, user, subuser)
+	c.guard.release(err)
+	return err
+}
+
+func (c *guardedClient) AddUserCap(ctx context.Context, uid, userCap string) ([]radosgw_admin.UserCapSpec, error) {
+	if err := c.guard.acquire(ctx); err != nil {
+		return nil, err
+	}
+	caps, err := c.Client.AddUserCap(ctx, uid, userCap)
+	c.guard.release(err)
+	return caps, err
+}
+
+func (c *guardedClient) RemoveUserCap(ctx context.Context, uid, userCap string) ([]radosgw_admin.UserCapSpec, error) {
+	if err := c.guard.acquire(ctx); err != nil {
+		return nil, err
+	}
+	caps, err := c.Client.RemoveUserCap(ctx, uid, userCap)
+	c.guard.release(err)
+	return caps, err
+}
+
+func (c *guardedClient) GetInfo(ctx context.Context) (Info, error) {
+	if err := c.guard.acquire(ctx); err != nil {
+		return Info{}, err
+	}
+	info, err := c.Client.GetInfo(ctx)
+	c.guard.release(err)
+	return info, err
+}
@@ -0,0 +1,158 @@
+package radosgw
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+func TestBreaker(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusInternalServerError, Code: "InternalError"}
+	slowDown := &StatusError{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"}
+	notFound := &StatusError{StatusCode: http.StatusNotFound, Code: "NoSuchUser"}
+
+	type request struct {
+		after time.Duration
+		err   error
+	}
+
+	type want struct {
+		open    bool
+		allowed bool
+	}
+
+	cases := map[string]struct {
+		reason   string
+		requests []request
+		after    time.Duration
+		want     want
+	}{
+		"Closed": {
+			reason:   "A circuit should stay closed while radosgw answers requests.",
+			requests: []request{{err: nil}, {err: notFound}},
+			want:     want{open: false, allowed: true},
+		},
+		"BelowThreshold": {
+			reason:   "A circuit should stay closed until radosgw failed breakerThreshold requests in a row.",
+			requests: []request{{err: unavailable}, {err: unavailable}, {err: unavailable}, {err: unavailable}},
+			want:     want{open: false, allowed: true},
+		},
+		"Answered": {
+			reason:   "Requests radosgw answered should reset the failures counted so far.",
+			requests: []request{{err: unavailable}, {err: unavailable}, {err: unavailable}, {err: notFound}, {err: unavailable}, {err: unavailable}},
+			want:     want{open: false, allowed: true},
+		},
+		"Threshold": {
+			reason:   "A circuit should open once radosgw failed breakerThreshold requests in a row.",
+			requests: []request{{err: unavailable}, {err: unavailable}, {err: unavailable}, {err: unavailable}, {err: unavailable}},
+			want:     want{open: true, allowed: false},
+		},
+		"SlowDown": {
+			reason:   "A circuit should open right away when radosgw asks to slow down.",
+			requests: []request{{err: slowDown}},
+			want:     want{open: true, allowed: false},
+		},
+		"ServiceUnavailable": {
+			reason:   "A circuit should open right away when radosgw responds with 503.",
+			requests: []request{{err: &StatusError{StatusCode: http.StatusServiceUnavailable}}},
+			want:     want{open: true, allowed: false},
+		},
+		"HalfOpen": {
+			reason:   "One request should be let through once the circuit was open for a while.",
+			requests: []request{{err: slowDown}},
+			after:    minOpenDuration,
+			want:     want{open: true, allowed: true},
+		},
+		"ProbeFailed": {
+			reason:   "A circuit should open for longer when the request let through fails.",
+			requests: []request{{err: slowDown}, {after: minOpenDuration, err: unavailable}},
+			after:    minOpenDuration,
+			want:     want{open: true, allowed: false},
+		},
+		"Recovered": {
+			reason:   "A circuit should close when the request let through is answered.",
+			requests: []request{{err: slowDown}, {after: minOpenDuration, err: notFound}},
+			want:     want{open: false, allowed: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			b := NewBreaker()
+			b.now = func() time.Time { return now }
+			b.jitter = func(d time.Duration) time.Duration { return d }
+
+			for i, r := range tc.requests {
+				now = now.Add(r.after)
+				if err := b.allow(); err != nil {
+					t.Fatalf("allow(): request %d was not allowed: %v", i, err)
+				}
+				b.record(r.err)
+			}
+			now = now.Add(tc.after)
+
+			open, _ := b.Open()
+			got := want{open: open, allowed: b.allow() == nil}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\n-want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGuards(t *testing.T) {
+	one := 1
+	pc := &apisv1alpha1.ProviderConfig{
+		ObjectMeta: metav1.ObjectMeta{UID: "a"},
+		Spec:       apisv1alpha1.ProviderConfigSpec{RateLimit: &apisv1alpha1.RateLimit{RequestsPerSecond: &one, Burst: &one}},
+	}
+	c := &countingClient{users: map[string]UserInfo{}}
+
+	cases := map[string]struct {
+		reason string
+		client func() Client
+		want   Reason
+	}{
+		"Allowed": {
+			reason: "Requests within the rate limit should be sent.",
+			client: func() Client { return NewGuards().Client(pc, c) },
+			want:   "",
+		},
+		"RateLimited": {
+			reason: "Requests that would wait too long for the rate limit should fail as throttled.",
+			client: func() Client {
+				g := NewGuards()
+				for i := 0; i < 3; i++ {
+					g.get(pc).limiter.Reserve()
+				}
+				return g.Client(pc, c)
+			},
+			want: ReasonThrottled,
+		},
+		"CircuitOpen": {
+			reason: "Requests should fail as unavailable while the circuit is open.",
+			client: func() Client {
+				g := NewGuards()
+				g.Breaker(pc).record(&StatusError{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"})
+				return g.Client(pc, c)
+			},
+			want: ReasonUnavailable,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.client().ListUsers(context.Background())
+			if diff := cmp.Diff(tc.want, Classify(err)); diff != "" {
+				t.Errorf("\n%s\nListUsers(...): -want reason, +got reason:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package radosgw
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+// An Observer keeps a snapshot of the users of a radosgw, so that CephUsers are
+// observed without a request to radosgw each, however often they are
+// reconciled.
+//
+// radosgw cannot read many users at once: its metadata API lists user ids,
+// but the quota and keys of a user are only returned by reading that user.
+// The snapshot is therefore not a bulk observation. It is refreshed in the
+// background: all user ids are listed with one request, then the users that
+// were observed recently are read with one request each, those read least
+// recently first, up to maxReadsPerRefresh per refresh. Users are read on
+// demand when they were not listed or read recently enough, or when they were
+// changed since.
+//
+// Observing N CephUsers thus costs 1 + min(N, 200) requests per interval as
+// long as every user is read by a refresh at least every observedFor
+// intervals, i.e. up to 600 users. Beyond that, the users the refreshes do not
+// get to are read on demand, so that each user is still read about every
+// observedFor intervals: roughly N/3 requests per interval.
+type Observer struct {
+	interval time.Duration
+	maxReads int
+	now      func() time.Time
+
+	mu sync.Mutex
+	// client is the client the latest observation was made with, which is
+	// used to refresh the snapshot.
+	client Client
+	// users are the users that exist according to the snapshot.
+	users map[string]*snapshotUser
+	// listed is when all user ids were last listed, or zero if never.
+	// attempted is when the snapshot was last refreshed.
+	listed     time.Time
+	attempted  time.Time
+	refreshing bool
+	// observed is when each user was last observed. Only users that were
+	// observed within the last few intervals are read when refreshing.
+	observed map[string]time.Time
+	// changed are the users that were changed since they were last read.
+	changed map[string]bool
+}
+
+// A snapshotUser is a user as it was last read, if it was read at all.
+type snapshotUser struct {
+	// user is nil if the user was listed, but not read yet.
+	user *UserInfo
+	// read is when the user was read, or zero if never.
+	read time.Time
+}
+
+const (
+	// observedFor is for how many intervals a user is read when refreshing
+	// after it was last observed. CephUsers that are deleted are forgotten
+	// after that. It is also for how many intervals what was listed and read
+	// is used, e.g. while radosgw is unavailable.
+	observedFor = 3
+
+	// maxReadsPerRefresh bounds how many users a refresh reads, so that it
+	// completes however many CephUsers a radosgw has. Users that were not
+	// read recently enough are read on demand when they are observed.
+	maxReadsPerRefresh = 200
+)
+
+// NewObserver returns an Observer whose snapshot is refreshed when it is older
+// than the supplied interval.
+func NewObserver(interval time.Duration) *Observer {
+	return &Observer{
+		interval: interval,
+		maxReads: maxReadsPerRefresh,
+		now:      time.Now,
+		users:    map[string]*snapshotUser{},
+		observed: map[string]time.Time{},
+		changed:  map[string]bool{},
+	}
+}
+
+// User returns the user with the supplied id, or nil if no such user exists.
+// The supplied client is used to read the user if it is not part of the
+// snapshot, and to refresh the snapshot when it is outdated. A nil Observer
+// reads every user from radosgw.
+func (o *Observer) User(ctx context.Context, c Client, uid string) (*UserInfo, error) {
+	if o == nil {
+		return GetCephUser(ctx, c, uid)
+	}
+
+	o.mu.Lock()
+	now := o.now()
+	o.client = c
+	o.observed[uid] = now
+	if !o.refreshing && now.Sub(o.attempted) >= o.interval {
+		o.refreshing = true
+		o.attempted = now
+		go o.refresh(context.Background()) //nolint:contextcheck // The refresh outlives the reconcile that triggered it.
+	}
+	su, listed := o.users[uid]
+	var u *UserInfo
+	cached := false
+	switch {
+	case o.changed[uid]:
+	case listed:
+		u, cached = su.user, o.recent(now, su.read)
+	default:
+		cached = o.recent(now, o.listed)
+	}
+	o.mu.Unlock()
+
+	if cached {
+		if u == nil {
+			return nil, nil
+		}
+		cp := *u
+		return &cp, nil
+	}
+
+	read := now
+	user, err := GetCephUser(ctx, c, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.store(uid, user, read)
+	delete(o.changed, uid)
+	return user, nil
+}
+
+// Changed records that the user with the supplied id is about to be changed,
+// so that it is read from radosgw the next time it is observed. A nil Observer
+// does nothing.
+func (o *Observer) Changed(uid string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.changed[uid] = true
+}
+
+// recent returns whether something that happened at the supplied time is
+// recent enough to be used.
+func (o *Observer) recent(now, t time.Time) bool {
+	return !t.IsZero() && now.Sub(t) < observedFor*o.interval
+}
+
+// store the supplied user as it was read at the supplied time, unless it was
+// read again since. Users that no longer exist are removed from the snapshot.
+func (o *Observer) store(uid string, user *UserInfo, read time.Time) {
+	su, ok := o.users[uid]
+	if ok && su.read.After(read) {
+		return
+	}
+	if user == nil {
+		delete(o.users, uid)
+		return
+	}
+	cp := *user
+	o.users[uid] = &snapshotUser{user: &cp, read: read}
+}
+
+// refresh lists all users with one request, then reads the users that were
+// observed recently with one request each, those read least recently first.
+// Whatever was listed and read is kept when the refresh fails part way; the
+// rest is refreshed after the next interval.
+func (o *Observer) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, observedFor*o.interval)
+	defer cancel()
+	defer func() {
+		o.mu.Lock()
+		o.refreshing = false
+		o.mu.Unlock()
+	}()
+
+	o.mu.Lock()
+	c := o.client
+	now := o.now()
+	o.mu.Unlock()
+
+	ids, err := c.ListUsers(ctx)
+	if err != nil {
+		return
+	}
+
+	o.mu.Lock()
+	o.list(ids, now)
+	due := o.due(now)
+	o.mu.Unlock()
+
+	for _, uid := range due {
+		read := o.now()
+		u, err := GetCephUser(ctx, c, uid)
+		if err != nil {
+			return
+		}
+		o.mu.Lock()
+		o.store(uid, u, read)
+		o.mu.Unlock()
+	}
+}
+
+// list records that the supplied user ids were listed at the supplied time.
+// Users that were read since are kept as they were read.
+func (o *Observer) list(ids []string, listed time.Time) {
+	exists := make(map[string]bool, len(ids))
+	for _, uid := range ids {
+		exists[uid] = true
+		if _, ok := o.users[uid]; !ok {
+			o.users[uid] = &snapshotUser{}
+		}
+	}
+	for uid, su := range o.users {
+		if !exists[uid] && su.read.Before(listed) {
+			delete(o.users, uid)
+		}
+	}
+	o.listed = listed
+}
+
+// due returns the ids of the users to read when refreshing at the supplied
+// time: those that were observed recently and listed, least recently read
+// first, at most maxReads of them. Users that were not observed for a while
+// are forgotten.
+func (o *Observer) due(now time.Time) []string {
+	due := []string{}
+	for uid, t := range o.observed {
+		if now.Sub(t) > observedFor*o.interval {
+			delete(o.observed, uid)
+			continue
+		}
+		if _, ok := o.users[uid]; ok {
+			due = append(due, uid)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		a, b := o.users[due[i]].read, o.users[due[j]].read
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return due[i] < due[j]
+	})
+	if len(due) > o.maxReads {
+		due = due[:o.maxReads]
+	}
+	return due
+}
+
+// Observers hands out an Observer per ProviderConfig. A new Observer is used
+// when the spec of a ProviderConfig changes, as it may point at another
+// radosgw. Its status changes, e.g. its conditions, do not matter.
+type Observers struct {
+	interval time.Duration
+
+	mu        sync.Mutex
+	observers map[types.UID]*versionedObserver
+}
+
+type versionedObserver struct {
+	*Observer
+	generation int64
+}
+
+// NewObservers returns Observers whose snapshots are refreshed when they are
+// older than the supplied interval.
+func NewObservers(interval time.Duration) *Observers {
+	return &Observers{interval: interval, observers: map[types.UID]*versionedObserver{}}
+}
+
+// Get returns the Observer of the supplied ProviderConfig.
+func (o *Observers) Get(pc *apisv1alpha1.ProviderConfig) *Observer {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if vo, ok := o.observers[pc.GetUID()]; ok && vo.generation == pc.GetGeneration() {
+		return vo.Observer
+	}
+	vo := &versionedObserver{Observer: NewObserver(o.interval), generation: pc.GetGeneration()}
+	o.observers[pc.GetUID()] = vo
+	return vo.Observer
+}
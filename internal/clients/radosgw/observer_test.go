@@ -0,0 +1,219 @@
+package radosgw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/google/go-cmp/cmp"
+)
+
+// countingClient serves the users it was created with, counting how often
+// they were listed and read.
+type countingClient struct {
+	Client
+
+	mu       sync.Mutex
+	users    map[string]UserInfo
+	listErr  error
+	getErrs  map[string]error
+	lists    int
+	userGets int
+}
+
+// fail reads of the supplied user with the supplied error.
+func (c *countingClient) fail(uid string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.getErrs = map[string]error{uid: err}
+}
+
+func (c *countingClient) ListUsers(_ context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lists++
+	ids := []string{}
+	for id := range c.users {
+		ids = append(ids, id)
+	}
+	return ids, c.listErr
+}
+
+func (c *countingClient) GetUserInfo(_ context.Context, uid string) (UserInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.userGets++
+	if err := c.getErrs[uid]; err != nil {
+		return UserInfo{}, err
+	}
+	u, ok := c.users[uid]
+	if !ok {
+		return UserInfo{}, &StatusError{StatusCode: http.StatusNotFound, Code: string(radosgw_admin.ErrNoSuchUser)}
+	}
+	return u, nil
+}
+
+func TestObserver(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	// observe observes the supplied user and waits for the refresh it may
+	// have triggered.
+	observe := func(t *testing.T, o *Observer, c Client, uid string) *UserInfo {
+		t.Helper()
+		u, err := o.User(ctx, c, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			o.mu.Lock()
+			refreshing := o.refreshing
+			o.mu.Unlock()
+			if !refreshing {
+				return u
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	type want struct {
+		lists    int
+		userGets int
+	}
+
+	cases := map[string]struct {
+		reason   string
+		users    []string
+		listErr  error
+		maxReads int
+		observe  func(t *testing.T, o *Observer, c *countingClient, advance func(time.Duration))
+		want     want
+	}{
+		"Snapshot": {
+			reason: "Users should be read once when there is no snapshot yet, and once to take it.",
+			observe: func(t *testing.T, o *Observer, c *countingClient, _ func(time.Duration)) {
+				for i := 0; i < 5; i++ {
+					if u := observe(t, o, c, "user"); u == nil || u.ID != "user" {
+						t.Errorf("User(...): want user, got %+v", u)
+					}
+				}
+			},
+			want: want{lists: 1, userGets: 2},
+		},
+		"Missing": {
+			reason: "Users that were not listed should not exist without being read.",
+			observe: func(t *testing.T, o *Observer, c *countingClient, _ func(time.Duration)) {
+				for i := 0; i < 5; i++ {
+					if u := observe(t, o, c, "other"); u != nil {
+						t.Errorf("User(...): want no user, got %+v", u)
+					}
+				}
+			},
+			want: want{lists: 1, userGets: 1},
+		},
+		"Changed": {
+			reason: "Users that were changed should be read on demand.",
+			observe: func(t *testing.T, o *Observer, c *countingClient, _ func(time.Duration)) {
+				observe(t, o, c, "user")
+				o.Changed("user")
+				observe(t, o, c, "user")
+				observe(t, o, c, "user")
+			},
+			want: want{lists: 1, userGets: 3},
+		},
+		"Refreshed": {
+			reason: "The snapshot should be taken again once it is older than the interval.",
+			observe: func(t *testing.T, o *Observer, c *countingClient, advance func(time.Duration)) {
+				observe(t, o, c, "user")
+				advance(time.Minute)
+				observe(t, o, c, "user")
+			},
+			want: want{lists: 2, userGets: 3},
+		},
+		"Forgotten": {
+			reason: "Users that were not observed for a while should not be read when refreshing.",
+			observe: func(t *testing.T, o *Observer, c *countingClient, advance func(time.Duration)) {
+				observe(t, o, c, "user")
+				advance(observedFor*time.Minute + time.Second)
+				observe(t, o, c, "other")
+			},
+			want: want{lists: 2, userGets: 3},
+		},
+		"RefreshFailed": {
+			reason:  "Users read on demand should be reused while the snapshot cannot be refreshed.",
+			listErr: errBoom,
+			observe: func(t *testing.T, o *Observer, c *countingClient, _ func(time.Duration)) {
+				observe(t, o, c, "user")
+				observe(t, o, c, "user")
+			},
+			want: want{lists: 1, userGets: 1},
+		},
+		"RefreshIncomplete": {
+			reason: "Users read by a refresh should be kept when it fails to read the others.",
+			users:  []string{"user", "other"},
+			observe: func(t *testing.T, o *Observer, c *countingClient, advance func(time.Duration)) {
+				observe(t, o, c, "user")
+				advance(10 * time.Second)
+				observe(t, o, c, "other")
+				c.fail("other", &StatusError{StatusCode: http.StatusServiceUnavailable})
+				// This refresh reads 'user', then fails to read 'other'.
+				advance(time.Minute)
+				observe(t, o, c, "other")
+				// What that refresh read is still recent enough, so 'user'
+				// is not read on demand. This refresh fails on 'other', which
+				// now was read longest ago.
+				advance(2 * time.Minute)
+				if u := observe(t, o, c, "user"); u == nil || u.ID != "user" {
+					t.Errorf("User(...): want user, got %+v", u)
+				}
+			},
+			want: want{lists: 3, userGets: 6},
+		},
+		"Bounded": {
+			reason:   "A refresh should read no more than its maximum of users, those read least recently first.",
+			users:    []string{"user", "other"},
+			maxReads: 1,
+			observe: func(t *testing.T, o *Observer, c *countingClient, advance func(time.Duration)) {
+				observe(t, o, c, "user")
+				advance(10 * time.Second)
+				observe(t, o, c, "other")
+				// This refresh reads 'user', which was read longest ago.
+				advance(time.Minute)
+				observe(t, o, c, "user")
+				// This refresh reads 'other', which now was.
+				advance(time.Minute)
+				observe(t, o, c, "user")
+			},
+			want: want{lists: 3, userGets: 5},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &countingClient{users: map[string]UserInfo{}, listErr: tc.listErr}
+			if tc.users == nil {
+				tc.users = []string{"user"}
+			}
+			for _, uid := range tc.users {
+				c.users[uid] = UserInfo{User: radosgw_admin.User{ID: uid}}
+			}
+			now := time.Now()
+			o := NewObserver(time.Minute)
+			o.now = func() time.Time { return now }
+			if tc.maxReads > 0 {
+				o.maxReads = tc.maxReads
+			}
+
+			tc.observe(t, o, c, func(d time.Duration) { now = now.Add(d) })
+
+			got := want{lists: c.lists, userGets: c.userGets}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\n-want calls, +got calls:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	vault "github.com/hashicorp/vault/api"
+	k8s_auth "github.com/hashicorp/vault/api/auth/kubernetes"
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/utils"
+)
+
+const (
+	errUnknownAuthMethod = "unknown vault auth method"
+	errMissingAuthConfig = "missing configuration for vault auth method"
+	errNoKubeClient      = "vault auth method requires access to the Kubernetes API"
+	errSetupK8sAuth      = "failed to setup kubernetes auth for vault"
+	errLogin             = "failed to authenticate to vault"
+	errNoAuthInfo        = "no auth info was returned after login"
+	errGetSecret         = "cannot get secret"
+	errMissingSecretKey  = "secret does not contain key"
+	errReadToken         = "cannot read token file"
+	errServiceAccount    = "cannot determine service account of the provider"
+	errRequestToken      = "cannot request service account token"
+
+	defaultTokenExpirationSeconds = int64(600)
+)
+
+// login authenticates the supplied client using the auth method of the
+// supplied VaultConfig and returns the auth secret of the login, if any. The
+// kube client is only used by methods that read from the Kubernetes API and may
+// be nil otherwise.
+func login(ctx context.Context, c *vault.Client, kube client.Client, config v1alpha1.VaultConfig) (*vault.Secret, error) {
+	auth := config.Auth
+	if auth == nil {
+		auth = &v1alpha1.VaultAuth{Method: v1alpha1.VaultAuthKubernetes}
+	}
+
+	switch auth.Method {
+	case v1alpha1.VaultAuthKubernetes, "":
+		opts := []k8s_auth.LoginOption{k8s_auth.WithServiceAccountTokenPath(serviceAccountTokenPath())}
+		if auth.MountPath != "" {
+			opts = append(opts, k8s_auth.WithMountPath(auth.MountPath))
+		}
+		k8sAuth, err := k8s_auth.NewKubernetesAuth(config.ServiceAccountName, opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, errSetupK8sAuth)
+		}
+		authInfo, err := c.Auth().Login(ctx, k8sAuth)
+		if err != nil {
+			return nil, errors.Wrap(err, errLogin)
+		}
+		if authInfo == nil {
+			return nil, errors.New(errNoAuthInfo)
+		}
+		return authInfo, nil
+
+	case v1alpha1.VaultAuthAppRole:
+		if auth.AppRole == nil {
+			return nil, errors.Errorf("%s: %s", errMissingAuthConfig, auth.Method)
+		}
+		if kube == nil {
+			return nil, errors.Errorf("%s: %s", errNoKubeClient, auth.Method)
+		}
+		roleID, err := secretValue(ctx, kube, auth.AppRole.RoleIDSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		secretID, err := secretValue(ctx, kube, auth.AppRole.SecretIDSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return loginWith(ctx, c, mountPath(auth.MountPath, "approle"), map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": secretID,
+		})
+
+	case v1alpha1.VaultAuthJWT:
+		if auth.JWT == nil {
+			return nil, errors.Errorf("%s: %s", errMissingAuthConfig, auth.Method)
+		}
+		jwt, err := jwtToken(ctx, kube, *auth.JWT)
+		if err != nil {
+			return nil, err
+		}
+		return loginWith(ctx, c, mountPath(auth.MountPath, "jwt"), map[string]interface{}{
+			"role": auth.JWT.Role,
+			"jwt":  jwt,
+		})
+
+	case v1alpha1.VaultAuthTokenFile:
+		if auth.TokenFile == nil {
+			return nil, errors.Errorf("%s: %s", errMissingAuthConfig, auth.Method)
+		}
+		token, err := readToken(auth.TokenFile.Path)
+		if err != nil {
+			return nil, err
+		}
+		// The token is renewed by whoever writes the file.
+		c.SetToken(token)
+		return nil, nil
+	}
+
+	return nil, errors.Errorf("%s: %s", errUnknownAuthMethod, auth.Method)
+}
+
+// loginWith logs in at auth/<mount>/login and uses the returned token.
+func loginWith(ctx context.Context, c *vault.Client, mount string, data map[string]interface{}) (*vault.Secret, error) {
+	secret, err := c.Logical().WriteWithContext(ctx, "auth/"+mount+"/login", data)
+	if err != nil {
+		return nil, errors.Wrap(err, errLogin)
+	}
+	if secret == nil || secret.Auth == nil {
+		return nil, errors.New(errNoAuthInfo)
+	}
+	c.SetToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
+func mountPath(mount, fallback string) string {
+	if mount == "" {
+		return fallback
+	}
+	return strings.Trim(mount, "/")
+}
+
+func serviceAccountTokenPath() string {
+	return utils.Getenv("SA_TOKEN_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/token")
+}
+
+func secretValue(ctx context.Context, kube client.Client, ref xpv1.SecretKeySelector) (string, error) {
+	s := &corev1.Secret{}
+	if err := kube.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+		return "", errors.Wrapf(err, "%s %s/%s", errGetSecret, ref.Namespace, ref.Name)
+	}
+	v, ok := s.Data[ref.Key]
+	if !ok {
+		return "", errors.Errorf("%s %s/%s: %s", errMissingSecretKey, ref.Namespace, ref.Name, ref.Key)
+	}
+	return strings.TrimSpace(string(v)), nil
+}
+
+func readToken(path string) (string, error) {
+	b, err := os.ReadFile(path) //nolint:gosec // The path is configured by the administrator.
+	if err != nil {
+		return "", errors.Wrapf(err, "%s %s", errReadToken, path)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// jwtToken returns the service account token to log in with. Tokens with a
+// custom audience are requested for the service account of the provider,
+// which is identified from its own token.
+func jwtToken(ctx context.Context, kube client.Client, config v1alpha1.VaultJWTAuth) (string, error) {
+	if config.Audience == "" {
+		path := config.TokenPath
+		if path == "" {
+			path = serviceAccountTokenPath()
+		}
+		return readToken(path)
+	}
+
+	if kube == nil {
+		return "", errors.Errorf("%s: %s", errNoKubeClient, v1alpha1.VaultAuthJWT)
+	}
+	own, err := readToken(serviceAccountTokenPath())
+	if err != nil {
+		return "", err
+	}
+	namespace, name, err := serviceAccountFromToken(own)
+	if err != nil {
+		return "", errors.Wrap(err, errServiceAccount)
+	}
+
+	expiration := defaultTokenExpirationSeconds
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	tr := &authenticationv1.TokenRequest{Spec: authenticationv1.TokenRequestSpec{
+		Audiences:         []string{config.Audience},
+		ExpirationSeconds: &expiration,
+	}}
+	if err := kube.SubResource("token").Create(ctx, sa, tr); err != nil {
+		return "", errors.Wrap(err, errRequestToken)
+	}
+	return tr.Status.Token, nil
+}
+
+// serviceAccountFromToken returns the namespace and name of the service account
+// the supplied token was issued to. The token is not verified.
+func serviceAccountFromToken(token string) (string, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", "", errors.New("malformed token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", errors.Wrap(err, "malformed token payload")
+	}
+	claims := struct {
+		Subject string `json:"sub"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", "", errors.Wrap(err, "malformed token claims")
+	}
+	// Service account tokens are issued to system:serviceaccount:<ns>:<name>.
+	sub := strings.Split(claims.Subject, ":")
+	if len(sub) != 4 || sub[0] != "system" || sub[1] != "serviceaccount" {
+		return "", "", errors.Errorf("token subject %q is not a service account", claims.Subject)
+	}
+	return sub[2], sub[3], nil
+}
@@ -0,0 +1,51 @@
+package vault
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServiceAccountFromToken(t *testing.T) {
+	token := func(claims string) string {
+		return "header." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+	}
+
+	type want struct {
+		namespace string
+		name      string
+		err       bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		token  string
+		want   want
+	}{
+		"ServiceAccount": {
+			reason: "The namespace and name should be taken from the subject.",
+			token:  token(`{"sub":"system:serviceaccount:crossplane-system:provider-radosgw"}`),
+			want:   want{namespace: "crossplane-system", name: "provider-radosgw"},
+		},
+		"NotAServiceAccount": {
+			reason: "Tokens not issued to a service account should be rejected.",
+			token:  token(`{"sub":"user@example.com"}`),
+			want:   want{err: true},
+		},
+		"Malformed": {
+			reason: "Tokens that are not a JWT should be rejected.",
+			token:  "token",
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			namespace, name, err := serviceAccountFromToken(tc.token)
+			if diff := cmp.Diff(tc.want, want{namespace: namespace, name: name, err: err != nil}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nserviceAccountFromToken(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+const errCacheKey = "cannot compute cache key for vault config"
+
+// A ClientCache hands out logged in Vault clients. It logs in once per
+// VaultConfig and renews the token of each client in the background. Clients
+// whose token can no longer be renewed are logged in again on their next use.
+type ClientCache struct {
+	kube client.Client
+	log  logging.Logger
+
+	mu sync.Mutex
+	// clients holds the client of each VaultConfig. Each has a lock of its
+	// own that is held while logging in, so that a Vault that is slow to
+	// answer only holds up the configs that log in to it.
+	clients map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	mu     sync.Mutex
+	cached *cachedClient
+}
+
+type cachedClient struct {
+	client *vault.Client
+	// renewed is false for tokens that are not owned by the provider, such as
+	// tokens read from a file, which are read again on every use.
+	renewed bool
+	expired chan struct{}
+}
+
+func (c *cachedClient) valid() bool {
+	select {
+	case <-c.expired:
+		return false
+	default:
+		return c.renewed
+	}
+}
+
+// NewClientCache returns an empty ClientCache. The kube client is passed to
+// auth methods that read from the Kubernetes API.
+func NewClientCache(kube client.Client, log logging.Logger) *ClientCache {
+	return &ClientCache{
+		kube:    kube,
+		log:     log,
+		clients: map[string]*cacheEntry{},
+	}
+}
+
+// Get returns a logged in client for the supplied VaultConfig.
+func (c *ClientCache) Get(ctx context.Context, config v1alpha1.VaultConfig) (*vault.Client, error) {
+	key, err := cacheKey(config)
+	if err != nil {
+		return nil, errors.Wrap(err, errCacheKey)
+	}
+
+	e := c.entry(key)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cached != nil && e.cached.valid() {
+		return e.cached.client, nil
+	}
+
+	vc, secret, err := newVaultClient(ctx, c.kube, config)
+	if err != nil {
+		e.cached = nil
+		return nil, err
+	}
+
+	cc := &cachedClient{client: vc, renewed: secret != nil, expired: make(chan struct{})}
+	e.cached = cc
+	if cc.renewed {
+		go c.renew(config.Address, cc, secret)
+	}
+	return vc, nil
+}
+
+// entry returns the entry of the supplied cache key, adding it if necessary.
+func (c *ClientCache) entry(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.clients[key]
+	if !ok {
+		e = &cacheEntry{}
+		c.clients[key] = e
+	}
+	return e
+}
+
+// renew keeps the token of the supplied client alive until it can no longer
+// be renewed, at which point the client is marked expired.
+func (c *ClientCache) renew(address string, cc *cachedClient, secret *vault.Secret) {
+	defer close(cc.expired)
+
+	w, err := cc.client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		c.log.Info("Cannot renew vault token", "address", address, "error", err)
+		return
+	}
+	go w.Start()
+	defer w.Stop()
+
+	for {
+		select {
+		case err := <-w.DoneCh():
+			if err != nil {
+				c.log.Info("Vault token renewal failed, logging in again on next use", "address", address, "error", err)
+				return
+			}
+			c.log.Debug("Vault token reached its max TTL, logging in again on next use", "address", address)
+			return
+		case <-w.RenewCh():
+			c.log.Debug("Renewed vault token", "address", address)
+		}
+	}
+}
+
+// cacheKey identifies a VaultConfig. Configs that log in the same way to the
+// same server share a client.
+func cacheKey(config v1alpha1.VaultConfig) (string, error) {
+	key := struct {
+		Address            string
+		ServiceAccountName string
+		Auth               *v1alpha1.VaultAuth
+		Namespace          string
+		TLS                *v1alpha1.VaultTLSConfig
+	}{config.Address, config.ServiceAccountName, config.Auth, config.Namespace, config.TLS}
+	b, err := json.Marshal(key)
+	return string(b), err
+}
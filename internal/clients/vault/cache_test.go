@@ -0,0 +1,158 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+// fakeVault serves JWT logins that issue non-renewable tokens with the supplied
+// lease duration, counting the logins.
+func fakeVault(t *testing.T, leaseSeconds int) (*httptest.Server, *int32) {
+	t.Helper()
+	logins := new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/jwt/login" {
+			http.NotFound(w, r)
+			return
+		}
+		n := atomic.AddInt32(logins, 1)
+		fmt.Fprintf(w, `{"auth":{"client_token":"token-%d","renewable":false,"lease_duration":%d}}`, n, leaseSeconds)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, logins
+}
+
+func jwtConfig(t *testing.T, address, role string) v1alpha1.VaultConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("jwt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return v1alpha1.VaultConfig{
+		Address: address,
+		Auth: &v1alpha1.VaultAuth{
+			Method: v1alpha1.VaultAuthJWT,
+			JWT:    &v1alpha1.VaultJWTAuth{Role: role, TokenPath: path},
+		},
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+
+	cases := map[string]struct {
+		reason string
+		roles  []string
+		want   int32
+	}{
+		"SameConfig": {
+			reason: "Clients for the same config should share a single login.",
+			roles:  []string{"ceph", "ceph", "ceph"},
+			want:   1,
+		},
+		"DifferentConfig": {
+			reason: "Clients for different configs should log in separately.",
+			roles:  []string{"ceph", "admin", "ceph"},
+			want:   2,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, logins := fakeVault(t, 3600)
+			configs := map[string]v1alpha1.VaultConfig{}
+			c := NewClientCache(nil, logging.NewNopLogger())
+			for _, role := range tc.roles {
+				if _, ok := configs[role]; !ok {
+					configs[role] = jwtConfig(t, srv.URL, role)
+				}
+				if _, err := c.Get(context.Background(), configs[role]); err != nil {
+					t.Fatalf("\n%s\nGet(...): unexpected error: %s", tc.reason, err)
+				}
+			}
+			if diff := cmp.Diff(tc.want, atomic.LoadInt32(logins)); diff != "" {
+				t.Errorf("\n%s\nGet(...): -want logins, +got logins:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestClientCacheExpiry(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+
+	srv, logins := fakeVault(t, 1)
+	config := jwtConfig(t, srv.URL, "ceph")
+	c := NewClientCache(nil, logging.NewNopLogger())
+
+	first, err := c.Get(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Get(...): unexpected error: %s", err)
+	}
+
+	key, _ := cacheKey(config)
+	select {
+	case <-c.clients[key].cached.expired:
+	case <-time.After(10 * time.Second):
+		t.Fatal("token was never marked expired")
+	}
+
+	second, err := c.Get(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Get(...): unexpected error: %s", err)
+	}
+	if diff := cmp.Diff("token-2", second.Token()); diff != "" {
+		t.Errorf("Get(...): expected a new login after expiry: -want token, +got token:\n%s\n", diff)
+	}
+	if first == second {
+		t.Errorf("Get(...): expected a new client after expiry")
+	}
+	if diff := cmp.Diff(int32(2), atomic.LoadInt32(logins)); diff != "" {
+		t.Errorf("Get(...): -want logins, +got logins:\n%s\n", diff)
+	}
+}
+
+func TestClientCacheSlowLogin(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+
+	// slow does not answer logins until it is released.
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		fmt.Fprint(w, `{"auth":{"client_token":"slow","renewable":false,"lease_duration":3600}}`)
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast, _ := fakeVault(t, 3600)
+	slowConfig, fastConfig := jwtConfig(t, slow.URL, "ceph"), jwtConfig(t, fast.URL, "ceph")
+
+	c := NewClientCache(nil, logging.NewNopLogger())
+	go func() { _, _ = c.Get(context.Background(), slowConfig) }()
+	<-started
+
+	done := make(chan error)
+	go func() {
+		_, err := c.Get(context.Background(), fastConfig)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Get(...): unexpected error: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Get(...): a slow login to one Vault held up the login to another")
+	}
+}
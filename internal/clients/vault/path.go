@@ -0,0 +1,106 @@
+package vault
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/utils"
+)
+
+// LabelKeyCluster is the ProviderConfig label that names the Ceph cluster in
+// secret paths. ProviderConfigs without it are named after the cluster,
+// optionally prefixed with 'ceph-'.
+const LabelKeyCluster = "radosgw.crossplane.io/cluster"
+
+// DefaultSecretPathTemplate is the layout credentials are written to when the
+// VaultConfig does not specify one.
+const DefaultSecretPathTemplate = "{{ .SecretPath }}/{{ .Cluster }}/users/{{ with .Tenant }}{{ . }}/{{ end }}{{ .UID }}"
+
+const (
+	errParseSecretPath   = "cannot parse secret path template"
+	errRenderSecretPath  = "cannot render secret path template"
+	errInvalidSecretPath = "secret path must not be empty or contain '.' or '..' segments"
+)
+
+// SecretPathData is available to secret path templates.
+type SecretPathData struct {
+	// SecretPath is the secretPath of the VaultConfig.
+	SecretPath string
+	// ProviderConfig is the name of the ProviderConfig of the CephUser.
+	ProviderConfig string
+	// Cluster is the name of the Ceph cluster of the ProviderConfig.
+	Cluster string
+	// Tenant is the tenant of the CephUser, if any.
+	Tenant string
+	// UID is the uid of the CephUser.
+	UID string
+	// Name is the name of the CephUser.
+	Name string
+	// Labels are the labels of the CephUser.
+	Labels map[string]string
+}
+
+// ParseSecretPathTemplate parses the supplied secret path template. An empty
+// template is the DefaultSecretPathTemplate.
+func ParseSecretPathTemplate(tmpl string) (*template.Template, error) {
+	if tmpl == "" {
+		tmpl = DefaultSecretPathTemplate
+	}
+	t, err := template.New("secretPath").Option("missingkey=error").Parse(tmpl)
+	return t, errors.Wrap(err, errParseSecretPath)
+}
+
+// BuildCephUserSecretPath renders the secret path of the credentials of the
+// supplied CephUser.
+func BuildCephUserSecretPath(pc apisv1alpha1.ProviderConfig, cr *v1alpha1.CephUser) (string, error) {
+	config := cr.Spec.ForProvider.VaultCredentialsStore
+	t, err := ParseSecretPathTemplate(config.SecretPathTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	p := cr.Spec.ForProvider
+	data := SecretPathData{
+		SecretPath:     config.SecretPath,
+		ProviderConfig: pc.Name,
+		Cluster:        ClusterName(pc),
+		UID:            utils.StringValue(p.UID, ""),
+		Tenant:         utils.StringValue(p.Tenant, ""),
+		Name:           cr.Name,
+		Labels:         cr.GetLabels(),
+	}
+
+	b := &bytes.Buffer{}
+	if err := t.Execute(b, data); err != nil {
+		return "", errors.Wrap(err, errRenderSecretPath)
+	}
+	return checkSecretPath(b.String())
+}
+
+// ClusterName returns the name of the Ceph cluster of the supplied
+// ProviderConfig.
+func ClusterName(pc apisv1alpha1.ProviderConfig) string {
+	if c := pc.GetLabels()[LabelKeyCluster]; c != "" {
+		return c
+	}
+	return strings.TrimPrefix(pc.Name, "ceph-")
+}
+
+// checkSecretPath rejects paths that are empty or would escape the layout of
+// the template.
+func checkSecretPath(p string) (string, error) {
+	if strings.Trim(p, "/") == "" {
+		return "", errors.Errorf("%s: %q", errInvalidSecretPath, p)
+	}
+	for _, s := range strings.Split(p, "/") {
+		if s == "." || s == ".." {
+			return "", errors.Errorf("%s: %q", errInvalidSecretPath, p)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+func TestBuildCephUserSecretPath(t *testing.T) {
+	uid := "user"
+	tenant := "team"
+
+	cephUser := func(tmpl string, tenant *string) *v1alpha1.CephUser {
+		return &v1alpha1.CephUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "cr", Labels: map[string]string{"team": "storage"}},
+			Spec: v1alpha1.CephUserSpec{ForProvider: v1alpha1.CephUserParameters{
+				UID:    &uid,
+				Tenant: tenant,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{
+					SecretPath:         "crossplane",
+					SecretPathTemplate: tmpl,
+				},
+			}},
+		}
+	}
+	pc := func(name string, labels map[string]string) apisv1alpha1.ProviderConfig {
+		return apisv1alpha1.ProviderConfig{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	type args struct {
+		pc apisv1alpha1.ProviderConfig
+		cr *v1alpha1.CephUser
+	}
+
+	type want struct {
+		path string
+		err  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Default": {
+			reason: "The default template should reproduce the historic layout.",
+			args:   args{pc: pc("ceph-cl01", nil), cr: cephUser("", nil)},
+			want:   want{path: "crossplane/cl01/users/user"},
+		},
+		"DefaultTenant": {
+			reason: "The default template should put tenants between the cluster and uid.",
+			args:   args{pc: pc("ceph-cl01", nil), cr: cephUser("", &tenant)},
+			want:   want{path: "crossplane/cl01/users/team/user"},
+		},
+		"ClusterLabel": {
+			reason: "The cluster label of the ProviderConfig should take precedence over its name.",
+			args:   args{pc: pc("storage", map[string]string{LabelKeyCluster: "cl02"}), cr: cephUser("", nil)},
+			want:   want{path: "crossplane/cl02/users/user"},
+		},
+		"Template": {
+			reason: "Custom templates should have access to the labels and names.",
+			args: args{
+				pc: pc("storage", nil),
+				cr: cephUser(`{{ index .Labels "team" }}/{{ .ProviderConfig }}/{{ .Name }}/{{ .UID }}`, nil),
+			},
+			want: want{path: "storage/storage/cr/user"},
+		},
+		"UnknownField": {
+			reason: "Templates referring to unknown fields should fail to render.",
+			args:   args{pc: pc("storage", nil), cr: cephUser("{{ .Team }}", nil)},
+			want:   want{err: true},
+		},
+		"Traversal": {
+			reason: "Rendered paths should not contain '..' segments.",
+			args:   args{pc: pc("storage", nil), cr: cephUser("{{ .SecretPath }}/../{{ .UID }}", nil)},
+			want:   want{err: true},
+		},
+		"Empty": {
+			reason: "Rendered paths should not be empty.",
+			args:   args{pc: pc("storage", nil), cr: cephUser(`{{ index .Labels "owner" }}`, nil)},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := BuildCephUserSecretPath(tc.args.pc, tc.args.cr)
+			if diff := cmp.Diff(tc.want, want{path: got, err: err != nil}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nBuildCephUserSecretPath(...): -want, +got:\n%s\n%v", tc.reason, diff, err)
+			}
+		})
+	}
+}
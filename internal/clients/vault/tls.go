@@ -0,0 +1,69 @@
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+const (
+	errConfigureTLS     = "cannot configure TLS for vault"
+	errLoadClientCert   = "cannot load client certificate"
+	errNoTLSTransport   = "vault client does not use an HTTP transport"
+	errTLSNeedsKubeAPI  = "TLS secrets require access to the Kubernetes API"
+	errGetClientCertKey = "cannot get client certificate secret"
+)
+
+// configureTLS applies the supplied TLS settings to the supplied client
+// config. Secrets are read through the kube client, which may be nil when the
+// settings do not reference any.
+func configureTLS(ctx context.Context, c *vault.Config, kube client.Client, config v1alpha1.VaultTLSConfig) error {
+	if kube == nil && (config.CABundleSecretRef != nil || config.ClientCertSecretRef != nil) {
+		return errors.New(errTLSNeedsKubeAPI)
+	}
+
+	bundle := config.CABundle
+	if ref := config.CABundleSecretRef; ref != nil {
+		ca, err := secretValue(ctx, kube, *ref)
+		if err != nil {
+			return err
+		}
+		bundle += "\n" + ca
+	}
+
+	t := &vault.TLSConfig{TLSServerName: config.ServerName}
+	if strings.TrimSpace(bundle) != "" {
+		t.CACertBytes = []byte(bundle)
+	}
+	if err := c.ConfigureTLS(t); err != nil {
+		return err
+	}
+
+	ref := config.ClientCertSecretRef
+	if ref == nil {
+		return nil
+	}
+	s := &corev1.Secret{}
+	if err := kube.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+		return errors.Wrapf(err, "%s %s/%s", errGetClientCertKey, ref.Namespace, ref.Name)
+	}
+	cert, err := tls.X509KeyPair(s.Data[corev1.TLSCertKey], s.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return errors.Wrapf(err, "%s %s/%s", errLoadClientCert, ref.Namespace, ref.Name)
+	}
+	transport, ok := c.HttpClient.Transport.(*http.Transport)
+	if !ok {
+		return errors.New(errNoTLSTransport)
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	return nil
+}
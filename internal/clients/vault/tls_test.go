@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+)
+
+func TestNewVaultClientTLS(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_MAX_RETRIES", "0")
+
+	namespaces := make(chan string, 1)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespaces <- r.Header.Get("X-Vault-Namespace")
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"token","renewable":false,"lease_duration":60}}`))
+	}))
+	defer srv.Close()
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	type want struct {
+		err       bool
+		namespace string
+	}
+
+	cases := map[string]struct {
+		reason string
+		tls    *v1alpha1.VaultTLSConfig
+		want   want
+	}{
+		"CABundle": {
+			reason: "Vault should be verified against the supplied CA bundle.",
+			tls:    &v1alpha1.VaultTLSConfig{CABundle: ca},
+			want:   want{namespace: "team"},
+		},
+		"ServerName": {
+			reason: "Vault should be verified against the supplied server name.",
+			tls:    &v1alpha1.VaultTLSConfig{CABundle: ca, ServerName: "vault.internal"},
+			want:   want{err: true},
+		},
+		"SystemRoots": {
+			reason: "Vault should not be trusted without a CA bundle for its internal CA.",
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := jwtConfig(t, srv.URL, "ceph")
+			config.Namespace = "team"
+			config.TLS = tc.tls
+
+			_, err := NewVaultClient(context.Background(), nil, config)
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Fatalf("\n%s\nNewVaultClient(...): -want error, +got error:\n%s\n%v", tc.reason, diff, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.namespace, <-namespaces); diff != "" {
+				t.Errorf("\n%s\nNewVaultClient(...): -want namespace, +got namespace:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
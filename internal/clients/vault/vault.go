@@ -3,85 +3,182 @@ package vault
 import (
 	"context"
 	"fmt"
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
-	v1alpha12 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
 	"github.com/daanvinken/provider-radosgw/internal/utils"
 	vault "github.com/hashicorp/vault/api"
-	k8s_auth "github.com/hashicorp/vault/api/auth/kubernetes"
 	"github.com/pkg/errors"
+	"net/http"
 	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strconv"
 	"strings"
 )
 
-func NewVaultClient(config v1alpha1.VaultConfig) (*vault.Client, error) {
+// NewVaultClient returns a Vault client that is logged in using the auth
+// method of the supplied VaultConfig. The kube client is used by auth methods
+// that read from the Kubernetes API and may be nil when none is configured.
+func NewVaultClient(ctx context.Context, kube client.Client, config v1alpha1.VaultConfig) (*vault.Client, error) {
+	client, _, err := newVaultClient(ctx, kube, config)
+	return client, err
+}
+
+// newVaultClient returns a logged in Vault client along with the auth secret
+// of its login. The secret is nil for tokens the provider does not own.
+func newVaultClient(ctx context.Context, kube client.Client, config v1alpha1.VaultConfig) (*vault.Client, *vault.Secret, error) {
 	clientConfig := vault.DefaultConfig()
 
 	clientConfig.Address = config.Address
+	if config.TLS != nil {
+		if err := configureTLS(ctx, clientConfig, kube, *config.TLS); err != nil {
+			return nil, nil, errors.Wrap(err, errConfigureTLS)
+		}
+	}
 
 	client, err := vault.NewClient(clientConfig)
 	if err != nil {
-		return nil, fmt.Errorf("unable to initialize Vault client: %w", err)
+		return nil, nil, fmt.Errorf("unable to initialize Vault client: %w", err)
+	}
+	if config.Namespace != "" {
+		client.SetNamespace(config.Namespace)
 	}
 
 	if os.Getenv("VAULT_TOKEN") != "" && os.Getenv("VAULT_ADDR") != "" {
 		err = client.SetAddress(os.Getenv("VAULT_ADDR"))
 		if err != nil {
-			return &vault.Client{}, err
-		}
-	} else {
-		k8sAuth, err := k8s_auth.NewKubernetesAuth(config.ServiceAccountName,
-			k8s_auth.WithServiceAccountTokenPath(
-				utils.Getenv("SA_TOKEN_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/token")))
-
-		if err != nil {
-			return client, errors.Wrap(err, "failed to setup kubernetes auth for vault")
-		}
-		authInfo, err := client.Auth().Login(context.Background(), k8sAuth)
-		if err != nil {
-			return client, errors.Wrap(err, "failed to authenticate to vault")
-		}
-
-		if authInfo == nil {
-			return client, fmt.Errorf("no auth info was returned after login")
+			return &vault.Client{}, nil, err
 		}
+		return client, nil, nil
 	}
 
-	return client, err
+	secret, err := login(ctx, client, kube, config)
+	return client, secret, err
 }
 
-func NewVaultClientForCephAdmins() (*vault.Client, error) {
-	// This method is for in the early stage crossplane setup where we do not have access to VaultConfig yet
+func NewVaultClientForCephAdmins(ctx context.Context, kube client.Client) (*vault.Client, error) {
+	return NewVaultClient(ctx, kube, AdminVaultConfig())
+}
+
+// AdminVaultConfig returns the VaultConfig of the client that reads the Ceph
+// admin credentials, as configured through the environment.
+func AdminVaultConfig() v1alpha1.VaultConfig {
+	// This is for in the early stage crossplane setup where we do not have access to VaultConfig yet
 	// (which is part of the providerconfig)
-	vaultConfig := v1alpha1.VaultConfig{
+	return v1alpha1.VaultConfig{
 		ServiceAccountName: utils.Getenv("VAULT_CEPH_ADMIN_ROLE", "crossplane-ceph-admin"),
 		Address:            utils.Getenv("VAULT_CEPH_ADMIN_ADDR", "http://localhost:8200"),
+		Auth:               adminAuth(),
+		Namespace:          os.Getenv("VAULT_CEPH_ADMIN_NAMESPACE"),
+		TLS:                adminTLS(),
 	}
-	return NewVaultClient(vaultConfig)
 }
 
-func NewVaultClientWithPanic(config v1alpha1.VaultConfig) *vault.Client {
-	client, err := NewVaultClient(config)
-	if err != nil {
-		panic(err)
+// adminTLS returns the TLS settings of the admin client as configured through
+// the environment. VAULT_CEPH_ADMIN_CA_BUNDLE holds PEM encoded certificates
+// and VAULT_CEPH_ADMIN_CLIENT_CERT_SECRET names a kubernetes.io/tls Secret as
+// '<namespace>/<name>'.
+func adminTLS() *v1alpha1.VaultTLSConfig {
+	t := &v1alpha1.VaultTLSConfig{
+		CABundle:   os.Getenv("VAULT_CEPH_ADMIN_CA_BUNDLE"),
+		ServerName: os.Getenv("VAULT_CEPH_ADMIN_TLS_SERVER_NAME"),
+	}
+	if ref, ok := secretRefFromEnv("VAULT_CEPH_ADMIN_CLIENT_CERT_SECRET"); ok {
+		t.ClientCertSecretRef = &ref
+	}
+	if *t == (v1alpha1.VaultTLSConfig{}) {
+		return nil
+	}
+	return t
+}
+
+// secretRefFromEnv parses a Secret reference given as '<namespace>/<name>'
+// from the supplied environment variable.
+func secretRefFromEnv(key string) (xpv1.SecretReference, bool) {
+	v := os.Getenv(key)
+	namespace, name, _ := strings.Cut(v, "/")
+	return xpv1.SecretReference{Namespace: namespace, Name: name}, v != ""
+}
+
+// adminAuth returns the auth method of the admin client as configured through
+// the environment. AppRole IDs are read from the 'role_id' and 'secret_id'
+// keys of the Secret named by VAULT_CEPH_ADMIN_APPROLE_SECRET, given as
+// '<namespace>/<name>'.
+func adminAuth() *v1alpha1.VaultAuth {
+	auth := &v1alpha1.VaultAuth{
+		Method:    v1alpha1.VaultAuthMethod(utils.Getenv("VAULT_CEPH_ADMIN_AUTH_METHOD", string(v1alpha1.VaultAuthKubernetes))),
+		MountPath: os.Getenv("VAULT_CEPH_ADMIN_AUTH_MOUNT"),
 	}
-	return client
+	switch auth.Method {
+	case v1alpha1.VaultAuthAppRole:
+		ref, _ := secretRefFromEnv("VAULT_CEPH_ADMIN_APPROLE_SECRET")
+		auth.AppRole = &v1alpha1.VaultAppRoleAuth{
+			RoleIDSecretRef:   xpv1.SecretKeySelector{SecretReference: ref, Key: "role_id"},
+			SecretIDSecretRef: xpv1.SecretKeySelector{SecretReference: ref, Key: "secret_id"},
+		}
+	case v1alpha1.VaultAuthJWT:
+		auth.JWT = &v1alpha1.VaultJWTAuth{
+			Role:      utils.Getenv("VAULT_CEPH_ADMIN_ROLE", "crossplane-ceph-admin"),
+			TokenPath: os.Getenv("VAULT_CEPH_ADMIN_JWT_PATH"),
+			Audience:  os.Getenv("VAULT_CEPH_ADMIN_JWT_AUDIENCE"),
+		}
+	case v1alpha1.VaultAuthTokenFile:
+		auth.TokenFile = &v1alpha1.VaultTokenFileAuth{Path: os.Getenv("VAULT_CEPH_ADMIN_TOKEN_FILE")}
+	}
+	return auth
 }
 
-func WriteSecretsToVault(client *vault.Client, vaultConfig v1alpha1.VaultConfig, key *string, data *map[string]interface{}) error {
+// WriteSecretsToVault writes the supplied data to the secret at the supplied
+// key. It returns the version that was written, or 0 for KV v1 which does not
+// version secrets. With check-and-set the secret is only written if it is
+// still at the supplied version, i.e. the one the caller wrote last, or does
+// not exist if that is 0.
+func WriteSecretsToVault(client *vault.Client, vaultConfig v1alpha1.VaultConfig, key *string, data *map[string]interface{}, version int) (int, error) {
 	if vaultConfig.KVVersion == "1" {
 		err := client.KVv1(vaultConfig.MountPath).Put(context.TODO(), *key, *data)
 		if err != nil {
-			return errors.Wrapf(err, "failed to write to vault kv1 at '%s'", vaultConfig.MountPath)
+			return 0, errors.Wrapf(err, "failed to write to vault kv1 at '%s'", vaultConfig.MountPath)
 		}
 	} else if vaultConfig.KVVersion == "2" {
-		_, err := client.KVv2(vaultConfig.MountPath).Put(context.TODO(), *key, *data)
+		opts := []vault.KVOption{}
+		if vaultConfig.CheckAndSet {
+			opts = append(opts, vault.WithCheckAndSet(version))
+		}
+		s, err := client.KVv2(vaultConfig.MountPath).Put(context.TODO(), *key, *data, opts...)
+		if vaultConfig.CheckAndSet && isCheckAndSetMismatch(err) {
+			return 0, errors.Wrapf(err, "secret at '%s' in vault kv2 at '%s' was changed since version %d, which was written last", *key, vaultConfig.MountPath, version)
+		}
 		if err != nil {
-			return errors.Wrapf(err, "failed to write to vault kv2 at '%s'", vaultConfig.MountPath)
+			return 0, errors.Wrapf(err, "failed to write to vault kv2 at '%s'", vaultConfig.MountPath)
+		}
+		if s.VersionMetadata != nil {
+			return s.VersionMetadata.Version, nil
 		}
 	} else {
-		return fmt.Errorf("unsupported KV version: %d", vaultConfig.KVVersion)
+		return 0, fmt.Errorf("unsupported KV version: %s", vaultConfig.KVVersion)
 	}
-	return nil
+	return 0, nil
+}
+
+// DeletedVersion returns the current version of the secret at the supplied key
+// if that version was deleted or destroyed, or 0 if it was not or there is no
+// such secret. Deleting a KV v2 secret keeps its metadata and with it the
+// version a check-and-set write must be based on to recreate the secret.
+func DeletedVersion(client *vault.Client, vaultConfig v1alpha1.VaultConfig, key string) (int, error) {
+	if vaultConfig.KVVersion != "2" {
+		return 0, nil
+	}
+	md, err := client.KVv2(vaultConfig.MountPath).GetMetadata(context.TODO(), key)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read metadata from vault kv2 at '%s'", vaultConfig.MountPath)
+	}
+	v, ok := md.Versions[strconv.Itoa(md.CurrentVersion)]
+	if !ok || (v.DeletionTime.IsZero() && !v.Destroyed) {
+		return 0, nil
+	}
+	return md.CurrentVersion, nil
 }
 
 func RemoveSecretFromVault(client *vault.Client, vaultConfig v1alpha1.VaultConfig, key *string) error {
@@ -90,6 +187,12 @@ func RemoveSecretFromVault(client *vault.Client, vaultConfig v1alpha1.VaultConfi
 		if err != nil {
 			return errors.Wrapf(err, "failed to delete from vault kv1 at '%s'", vaultConfig.MountPath)
 		}
+	} else if vaultConfig.KVVersion == "2" && vaultConfig.KVDeletionPolicy == v1alpha1.KVDeletionPolicyDestroy {
+		// Deleting the metadata permanently destroys every version.
+		err := client.KVv2(vaultConfig.MountPath).DeleteMetadata(context.TODO(), *key)
+		if err != nil {
+			return errors.Wrapf(err, "failed to destroy in vault kv2 at '%s'", vaultConfig.MountPath)
+		}
 	} else if vaultConfig.KVVersion == "2" {
 		err := client.KVv2(vaultConfig.MountPath).Delete(context.TODO(), *key)
 		if err != nil {
@@ -101,11 +204,47 @@ func RemoveSecretFromVault(client *vault.Client, vaultConfig v1alpha1.VaultConfi
 	return nil
 }
 
+// WriteCustomMetadata sets the supplied custom metadata on the secret at the
+// supplied key, leaving its other metadata untouched. Only KV v2 supports
+// metadata, so this does nothing for other versions.
+func WriteCustomMetadata(client *vault.Client, vaultConfig v1alpha1.VaultConfig, key string, metadata map[string]string) error {
+	if vaultConfig.KVVersion != "2" {
+		return nil
+	}
+	m := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		m[k] = v
+	}
+	err := client.KVv2(vaultConfig.MountPath).PatchMetadata(context.TODO(), key, vault.KVMetadataPatchInput{CustomMetadata: m})
+	return errors.Wrapf(err, "failed to write metadata to vault kv2 at '%s'", vaultConfig.MountPath)
+}
+
+// isCheckAndSetMismatch returns whether the supplied error indicates that a
+// check-and-set write was refused, because the secret was not at the version
+// it was based on.
+func isCheckAndSetMismatch(err error) bool {
+	re := &vault.ResponseError{}
+	if !errors.As(err, &re) || re.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, e := range re.Errors {
+		if strings.Contains(e, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadSecretsFromVault reads the data of the secret at the supplied key. It
+// returns nil if there is no such secret.
 func ReadSecretsFromVault(client *vault.Client, vaultConfig v1alpha1.VaultConfig, key *string) (map[string]interface{}, error) {
 	var secretData map[string]interface{}
 
 	if vaultConfig.KVVersion == "1" {
 		data, err := client.KVv1(vaultConfig.MountPath).Get(context.TODO(), *key)
+		if errors.Is(err, vault.ErrSecretNotFound) {
+			return nil, nil
+		}
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to read from vault kv1 at '%s'", vaultConfig.MountPath)
 		}
@@ -113,12 +252,17 @@ func ReadSecretsFromVault(client *vault.Client, vaultConfig v1alpha1.VaultConfig
 			secretData = data.Data
 		}
 	} else if vaultConfig.KVVersion == "2" {
+		// The KV v2 client already unwraps the data of the secret from the
+		// response.
 		data, err := client.KVv2(vaultConfig.MountPath).Get(context.TODO(), *key)
+		if errors.Is(err, vault.ErrSecretNotFound) {
+			return nil, nil
+		}
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to read from vault kv2 at '%s'", vaultConfig.MountPath)
 		}
-		if data != nil && data.Data != nil {
-			secretData = data.Data["data"].(map[string]interface{})
+		if data != nil {
+			secretData = data.Data
 		}
 	} else {
 		return nil, fmt.Errorf("unsupported KV version: %s", vaultConfig.KVVersion)
@@ -126,13 +270,3 @@ func ReadSecretsFromVault(client *vault.Client, vaultConfig v1alpha1.VaultConfig
 
 	return secretData, nil
 }
-
-func BuildCephUserSecretPath(pc v1alpha12.ProviderConfig, cr *v1alpha1.CephUser) (string, error) {
-	prefix := "ceph-"
-	if !strings.HasPrefix(pc.Name, prefix) {
-		return "", errors.New("provider config name does not start with 'ceph-'")
-	}
-	cephClusterName := pc.Name[len(prefix):]
-	secretPath := cr.Spec.ForProvider.VaultCredentialsStore.SecretPath + "/" + cephClusterName + "/users/" + *cr.Spec.ForProvider.UID
-	return secretPath, nil
-}
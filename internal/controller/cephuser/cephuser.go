@@ -24,21 +24,26 @@ import (
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/ratelimiter"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
 	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/credentials"
 	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
 	"github.com/daanvinken/provider-radosgw/internal/clients/vault"
+	"github.com/daanvinken/provider-radosgw/internal/utils"
 	vault_sdk "github.com/hashicorp/vault/api"
 	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"os"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-	"strings"
+	"time"
 )
 
 const (
@@ -50,18 +55,33 @@ const (
 	errNewClient              = "cannot create new radosgw client"
 	errGetCephUser            = "Failed to retrieve cephuser"
 	errCreateCephUser         = "Failed to create cephuser"
+	errAdoptCephUser          = "Failed to add access key to existing cephuser"
+	errAdoptKeyedCephUser     = "cephuser already exists on radosgw with access keys it was not created with"
 	errDeleteCephUser         = "Failed to delete cephuser"
-	errVaultCleanup           = "Failed to remove credentials from vault_sdk"
+	errRotateKey              = "Failed to add new access key to cephuser"
+	errModifyCephUser         = "Failed to modify cephuser"
+	errSetUserQuota           = "Failed to set cephuser quota"
+	errStoreCredentials       = "Failed to store cephuser credentials"
+	errRenderCredentials      = "Failed to render cephuser credentials"
+	errReadCredentials        = "Failed to read stored cephuser credentials"
+	errCredentialsCleanup     = "Failed to remove cephuser credentials"
 	errFetchSecretAdmin       = "unable to extract secret data for radosgw admin"
 	errVaultClientCreate      = "failed to create vault_sdk client for storing ceph credentials"
 	errListBuckets            = "error listing user's buckets"
 	errUserStillHasBuckets    = "ceph user still owns buckets"
 
 	inUseFinalizer = "cephuser-in-use.ceph.radosgw.crossplane.io"
+
+	// adminCredentialsMaxAge is how long radosgw clients, and the admin
+	// credentials they were created with, are reused before the credentials
+	// are read from Vault again.
+	adminCredentialsMaxAge = 10 * time.Minute
 )
 
-// Setup adds a controller that reconciles CephUser managed resources.
-func Setup(mgr ctrl.Manager, o controller.Options) error {
+// Setup adds a controller that reconciles CephUser managed resources. Requests
+// to radosgw are subject to the supplied guards. Credentials are read from and
+// written to Vault with the supplied Vault clients.
+func Setup(mgr ctrl.Manager, o controller.Options, guards *radosgw.Guards, vaultClients *vault.ClientCache) error {
 	name := managed.ControllerName(v1alpha1.CephUserGroupKind)
 
 	cps := []managed.ConnectionPublisher{managed.NewAPISecretPublisher(mgr.GetClient(), mgr.GetScheme())}
@@ -70,31 +90,33 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 		fmt.Println("Using local dev mode as 'VAULT_TOKEN' and 'VAULT_ADDR' are set.")
 	}
 
-	vaultAdminClient, err := vault.NewVaultClientForCephAdmins()
-	if err != nil {
-		panic(errors.Wrap(err, errCreateAdminVaultClient))
-	}
-
+	rq := newRequeuer(nil, o.PollInterval)
 	r := managed.NewReconciler(mgr,
 		resource.ManagedKind(v1alpha1.CephUserGroupVersionKind),
 		managed.WithExternalConnecter(&connector{
 			kube:               mgr.GetClient(),
 			usage:              resource.NewProviderConfigUsageTracker(mgr.GetClient(), &apisv1alpha1.ProviderConfigUsage{}),
-			newRadosgwClientFn: radosgw.NewRadosgwClient,
-			newVaultClientFn:   vault.NewVaultClientWithPanic,
-			vaultAdminClient:   vaultAdminClient,
+			newRadosgwClientFn: radosgw.NewClient,
+			rgwClients:         radosgw.NewClientCache(adminCredentialsMaxAge),
+			observers:          radosgw.NewObservers(o.PollInterval),
+			guards:             guards,
+			vaultClientFn:      vaultClients.Get,
+			adminVaultConfig:   vault.AdminVaultConfig(),
+			credentialsDir:     utils.Getenv("CREDENTIALS_FILE_DIR", "/var/lib/provider-radosgw/credentials"),
+			requeue:            rq,
 			log:                o.Logger.WithValues("controller", name)}),
 		managed.WithLogger(o.Logger.WithValues("controller", name)),
 		managed.WithPollInterval(o.PollInterval),
 		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
 		managed.WithConnectionPublishers(cps...))
+	rq.Reconciler = r
 
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o.ForControllerRuntime()).
 		WithEventFilter(resource.DesiredStateChanged()).
 		For(&v1alpha1.CephUser{}).
-		Complete(ratelimiter.NewReconciler(name, r, o.GlobalRateLimiter))
+		Complete(ratelimiter.NewReconciler(name, rq, o.GlobalRateLimiter))
 }
 
 // A connector is expected to produce an ExternalClient when its Connect method
@@ -102,10 +124,15 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 type connector struct {
 	kube               client.Client
 	usage              resource.Tracker
-	newRadosgwClientFn func(host string, credentials radosgw.Credentials) *radosgw_admin.API
-	newVaultClientFn   func(config v1alpha1.VaultConfig) *vault_sdk.Client
+	newRadosgwClientFn func(endpoints []string, credentials radosgw.Credentials) (radosgw.Client, error)
+	rgwClients         *radosgw.ClientCache
+	observers          *radosgw.Observers
+	guards             *radosgw.Guards
+	vaultClientFn      func(ctx context.Context, config v1alpha1.VaultConfig) (*vault_sdk.Client, error)
 	log                logging.Logger
-	vaultAdminClient   *vault_sdk.Client
+	adminVaultConfig   v1alpha1.VaultConfig
+	credentialsDir     string
+	requeue            *requeuer
 }
 
 // Connect typically produces an ExternalClient by:
@@ -131,26 +158,90 @@ func (c *connector) Connect(ctx context.Context, mg resource.Managed) (managed.E
 		return nil, errors.Wrap(err, errGetPC)
 	}
 
-	radosgwCredentials, err := GetAdminCredentials(c.vaultAdminClient, pc)
+	rgwClient, err := c.rgwClients.Get(ctx, pc, func(ctx context.Context) (radosgw.Client, error) {
+		return c.newRadosgwClient(ctx, pc)
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, errFetchSecretAdmin)
+		return nil, err
+	}
+	rgwClient = c.guards.Client(pc, rgwClient)
+
+	stores, err := c.credentialStores(ctx, cr, pc)
+	if err != nil {
+		return nil, errors.Wrap(err, errVaultClientCreate)
 	}
 
 	return &external{
-		rgwClient:   c.newRadosgwClientFn(pc.Spec.HostName, radosgwCredentials),
-		vaultClient: c.newVaultClientFn(*cr.Spec.ForProvider.VaultCredentialsStore),
-		kubeClient:  c.kube,
-		log:         c.log,
+		rgwClient:     rgwClient,
+		rgwClients:    c.rgwClients,
+		observer:      c.observers.Get(pc),
+		stores:        stores,
+		pc:            pc,
+		kubeClient:    c.kube,
+		defaultTenant: radosgw.DefaultTenant(pc, cr),
+		requeue:       c.requeue,
+		log:           c.log,
 	}, err
 }
 
+// newRadosgwClient returns a client for the radosgw of the supplied
+// ProviderConfig, using the admin credentials read from Vault.
+func (c *connector) newRadosgwClient(ctx context.Context, pc *apisv1alpha1.ProviderConfig) (radosgw.Client, error) {
+	vaultAdminClient, err := c.vaultClientFn(ctx, c.adminVaultConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, errCreateAdminVaultClient)
+	}
+
+	radosgwCredentials, err := GetAdminCredentials(vaultAdminClient, pc)
+	if err != nil {
+		return nil, errors.Wrap(err, errFetchSecretAdmin)
+	}
+
+	rgwClient, err := c.newRadosgwClientFn(radosgw.Endpoints(pc), radosgwCredentials)
+	return rgwClient, errors.Wrap(err, errNewClient)
+}
+
+// credentialStores returns the stores the credentials of the supplied CephUser
+// are written to.
+func (c *connector) credentialStores(ctx context.Context, cr *v1alpha1.CephUser, pc *apisv1alpha1.ProviderConfig) ([]credentials.Store, error) {
+	p := cr.Spec.ForProvider
+	stores := []credentials.Store{}
+	if p.VaultCredentialsStore != nil {
+		vc, err := c.vaultClientFn(ctx, *p.VaultCredentialsStore)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, credentials.NewVaultStore(vc, *p.VaultCredentialsStore, pc, c.log))
+	}
+	if p.SecretCredentialsStore != nil {
+		stores = append(stores, credentials.NewSecretStore(c.kube, *p.SecretCredentialsStore))
+	}
+	if p.FileCredentialsStore != nil {
+		stores = append(stores, credentials.NewFileStore(c.kube, c.credentialsDir, *p.FileCredentialsStore))
+	}
+	return stores, nil
+}
+
 // An ExternalClient observes, then either creates, updates, or deletes an
 // external resource to ensure it reflects the managed resource's desired state.
 type external struct {
-	rgwClient   *radosgw_admin.API
-	vaultClient *vault_sdk.Client
-	kubeClient  client.Client
-	log         logging.Logger
+	rgwClient     radosgw.Client
+	rgwClients    *radosgw.ClientCache
+	observer      *radosgw.Observer
+	stores        []credentials.Store
+	pc            *apisv1alpha1.ProviderConfig
+	kubeClient    client.Client
+	defaultTenant *string
+	requeue       *requeuer
+	log           logging.Logger
+
+	// rendered are the credentials Observe rendered for the CephUser, and
+	// outdated the stores it found not to hold them, for Update to write.
+	// rotate is whether Observe found the key the CephUser recorded writing
+	// removed from radosgw, for Update to replace.
+	rendered map[string]string
+	outdated []credentials.Store
+	rotate   bool
 }
 
 func (c *external) Observe(ctx context.Context, mg resource.Managed) (managed.ExternalObservation, error) {
@@ -166,12 +257,40 @@ func (c *external) Observe(ctx context.Context, mg resource.Managed) (managed.Ex
 	ctxC, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	cephUserExists, err := radosgw.CephUserExists(ctxC, c.rgwClient, *cr.Spec.ForProvider.UID)
+	// Users that do not specify a tenant end up in the default tenant of the
+	// ProviderConfig. This is persisted like any other late-initialized field.
+	tenantDefaulted := false
+	if cr.Spec.ForProvider.Tenant == nil && c.defaultTenant != nil {
+		cr.Spec.ForProvider.Tenant = c.defaultTenant
+		tenantDefaulted = true
+	}
+
+	// Only a user radosgw reports missing is created. Any other error leaves
+	// the state of the user unknown. Users are observed from a snapshot of
+	// all users of the ProviderConfig, unless they were just changed.
+	cephUser, err := c.observer.User(ctxC, c.rgwClient, radosgw.UserID(cr.Spec.ForProvider))
 	if err != nil {
-		c.log.Info(errors.Wrap(err, errGetCephUser).Error())
+		err = c.record(cr, err, errGetCephUser)
+		cr.SetConditions(radosgwUnavailable(err))
+		return managed.ExternalObservation{}, err
 	}
 
-	if cephUserExists {
+	if cephUser != nil {
+		lateInitialized := radosgw.LateInitializeCephUser(&cr.Spec.ForProvider, *cephUser) || tenantDefaulted
+
+		// The stored credentials follow changes to the credentials
+		// template, are written again when they went missing, and are
+		// replaced when their key was removed from radosgw.
+		if !meta.WasDeleted(cr) {
+			if err := c.observeCredentials(ctx, cr, *cephUser); err != nil {
+				return managed.ExternalObservation{}, err
+			}
+		}
+
+		cr.Status.AtProvider.UID = radosgw.UserID(cr.Spec.ForProvider)
+		cr.Status.AtProvider.Tenant = utils.StringValue(cr.Spec.ForProvider.Tenant, "")
+		cr.SetConditions(xpv1.Available())
+
 		return managed.ExternalObservation{
 			// Return false when the external resource does not exist. This lets
 			// the managed resource reconciler know that it needs to call Create to
@@ -181,11 +300,15 @@ func (c *external) Observe(ctx context.Context, mg resource.Managed) (managed.Ex
 			// Return false when the external resource exists, but it not up to date
 			// with the desired managed resource state. This lets the managed
 			// resource reconciler know that it needs to call Update.
-			ResourceUpToDate: true,
+			ResourceUpToDate: radosgw.IsCephUserUpToDate(cr.Spec.ForProvider, *cephUser) && len(c.outdated) == 0 && !c.rotate,
+
+			// Let the managed resource reconciler know that it needs to persist
+			// any spec fields we filled in from what radosgw reports.
+			ResourceLateInitialized: lateInitialized,
 
 			// Return any details that may be required to connect to the external
 			// resource. These will be stored as the connection secret.
-			ConnectionDetails: managed.ConnectionDetails{},
+			ConnectionDetails: connectionDetails(c.rendered),
 		}, nil
 	}
 
@@ -209,42 +332,53 @@ func (c *external) Create(ctx context.Context, mg resource.Managed) (managed.Ext
 	fmt.Printf("Creating: %+v\n", cr.Name)
 
 	user := radosgw.GenerateCephUserInput(cr)
+	c.observer.Changed(user.ID)
 	_, err := c.rgwClient.CreateUser(ctx, *user)
-	if resource.Ignore(isAlreadyExists, err) != nil {
+	if errors.Is(err, radosgw_admin.ErrUserExists) {
+		// The user was created before, e.g. by hand. Adopt it by adding the
+		// generated key to it, so that the credentials stored below are
+		// ones radosgw accepts, but only if it has no keys: a user with
+		// keys the CephUser did not create, an admin for instance, belongs
+		// to someone else.
+		existing, err := c.rgwClient.GetUserInfo(ctx, user.ID)
+		if err != nil {
+			return managed.ExternalCreation{}, c.record(cr, err, errGetCephUser)
+		}
+		if len(existing.Keys) > 0 {
+			return managed.ExternalCreation{}, errors.New(errAdoptKeyedCephUser)
+		}
+		if err := c.addKey(ctx, user); err != nil {
+			c.log.Info("Failed to adopt existing cephUser on radosgw", "cephUser_uid", cr.Spec.ForProvider.UID, "error", err.Error())
+			return managed.ExternalCreation{}, c.record(cr, err, errAdoptCephUser)
+		}
+	} else if resource.Ignore(isAlreadyExists, err) != nil {
 		c.log.Info("Failed to create cephUser on radosgw", "cephUser_uid", cr.Spec.ForProvider.UID, "error", err.Error())
-		return managed.ExternalCreation{}, errors.Wrap(err, errCreateCephUser)
-
-	}
-
-	quota := radosgw.GenerateCephUserQuotaInput(cr)
-	err = c.rgwClient.SetUserQuota(ctx, *quota)
-	if err != nil {
-		return managed.ExternalCreation{}, errors.Wrap(err, "failed to set userquota during creation")
-	}
+		return managed.ExternalCreation{}, c.record(cr, err, errCreateCephUser)
 
-	credentialsData := map[string]interface{}{
-		"access_key": user.Keys[0].AccessKey,
-		"secret_key": user.Keys[0].SecretKey,
 	}
 
-	pc := &apisv1alpha1.ProviderConfig{}
-	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: cr.GetProviderConfigReference().Name}, pc); err != nil {
-		return managed.ExternalCreation{}, errors.Wrap(err, errGetPC)
+	// radosgw does not accept all attributes on creation, so set the remaining
+	// ones right away rather than waiting for the next Update.
+	if radosgw.HasExtendedAttributes(cr) {
+		if err := c.rgwClient.ModifyUserAttributes(ctx, user.ID, radosgw.GenerateCephUserAttributes(cr)); err != nil {
+			return managed.ExternalCreation{}, c.record(cr, err, errModifyCephUser)
+		}
 	}
 
-	secretPath, err := vault.BuildCephUserSecretPath(*pc, cr)
-
+	quota := radosgw.GenerateCephUserQuotaInput(cr)
+	err = c.rgwClient.SetUserQuota(ctx, *quota)
 	if err != nil {
-		c.log.Info(fmt.Sprintf("Failed to build secret path for storing CephUser credentials: '%v+'", err))
-		return managed.ExternalCreation{}, err
+		return managed.ExternalCreation{}, c.record(cr, err, errSetUserQuota)
 	}
 
-	err = vault.WriteSecretsToVault(c.vaultClient, *cr.Spec.ForProvider.VaultCredentialsStore, &secretPath, &credentialsData)
+	credentialsData, err := credentials.Render(cr.Spec.ForProvider.CredentialsTemplate,
+		credentials.NewTemplateData(cr, c.pc, user.Keys[0].AccessKey, user.Keys[0].SecretKey))
 	if err != nil {
-		//TODO remove user from radosgw again to fix state. Actually use defer with context.
-		return managed.ExternalCreation{}, err
+		return managed.ExternalCreation{}, errors.Wrap(err, errStoreCredentials)
 	}
 
+	// Updating the CephUser resets its status to what is stored, so add the
+	// finalizer before the stores record where they wrote the credentials.
 	if controllerutil.AddFinalizer(cr, inUseFinalizer) {
 		err := c.kubeClient.Update(ctx, cr)
 		if err != nil {
@@ -252,13 +386,19 @@ func (c *external) Create(ctx context.Context, mg resource.Managed) (managed.Ext
 		}
 	}
 
+	//TODO remove user from radosgw again to fix state if the credentials
+	// cannot be stored. Actually use defer with context.
+	if err := c.writeCredentials(ctx, cr, user.Keys[0].AccessKey, credentialsData, c.stores); err != nil {
+		return managed.ExternalCreation{}, err
+	}
+
 	cr.Status.SetConditions(xpv1.Available())
 
 	if err := c.kubeClient.Status().Update(ctx, cr); err != nil {
 		c.log.Info("Failed to update cephUser", "backend name", "cephUser_uid", cr.Spec.ForProvider.UID)
 	}
 
-	return managed.ExternalCreation{}, nil
+	return managed.ExternalCreation{ConnectionDetails: connectionDetails(credentialsData)}, nil
 }
 
 func (c *external) Update(ctx context.Context, mg resource.Managed) (managed.ExternalUpdate, error) {
@@ -270,10 +410,33 @@ func (c *external) Update(ctx context.Context, mg resource.Managed) (managed.Ext
 	// These fmt statements should be removed in the real implementation.
 	fmt.Printf("Updating: %+v\n", cr.Name)
 
+	uid := radosgw.UserID(cr.Spec.ForProvider)
+	c.observer.Changed(uid)
+	if err := c.rgwClient.ModifyUserAttributes(ctx, uid, radosgw.GenerateCephUserAttributes(cr)); err != nil {
+		c.log.Info("Failed to modify cephUser on radosgw", "cephUser_uid", uid, "error", err.Error())
+		return managed.ExternalUpdate{}, c.record(cr, err, errModifyCephUser)
+	}
+
+	if err := c.rgwClient.SetUserQuota(ctx, *radosgw.GenerateCephUserQuotaInput(cr)); err != nil {
+		c.log.Info("Failed to set cephUser quota on radosgw", "cephUser_uid", uid, "error", err.Error())
+		return managed.ExternalUpdate{}, c.record(cr, err, errSetUserQuota)
+	}
+
+	switch {
+	case c.rotate:
+		if err := c.rotateKey(ctx, cr); err != nil {
+			return managed.ExternalUpdate{}, err
+		}
+	case len(c.outdated) > 0:
+		if err := c.writeCredentials(ctx, cr, cr.Status.AtProvider.Credentials.AccessKeyID, c.rendered, c.outdated); err != nil {
+			return managed.ExternalUpdate{}, err
+		}
+	}
+
 	return managed.ExternalUpdate{
 		// Optionally return any details that may be required to connect to the
 		// external resource. These will be stored as the connection secret.
-		ConnectionDetails: managed.ConnectionDetails{},
+		ConnectionDetails: connectionDetails(c.rendered),
 	}, nil
 }
 
@@ -286,18 +449,10 @@ func (c *external) Delete(ctx context.Context, mg resource.Managed) error {
 	// These fmt statements should be removed in the real implementation.
 	fmt.Printf("Deleting: %+v\n", cr.Name)
 
-	//TODO can't we just add the clustername to context or connector
-	pc := &apisv1alpha1.ProviderConfig{}
-	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: cr.GetProviderConfigReference().Name}, pc); err != nil {
-		return errors.Wrap(err, errGetPC)
-	}
-
-	secretPath, err := vault.BuildCephUserSecretPath(*pc, cr)
-
 	hasBuckets, err := cephUserHasBuckets(c.rgwClient, cr)
 	if err != nil {
 		c.log.Info("Failed to verify if user still has buckets during deletion", "cephUser_uid", cr.Spec.ForProvider.UID, "error", err.Error())
-		return errors.Wrap(err, errDeleteCephUser)
+		return c.record(cr, err, errDeleteCephUser)
 	}
 
 	if !hasBuckets {
@@ -313,35 +468,162 @@ func (c *external) Delete(ctx context.Context, mg resource.Managed) error {
 	}
 
 	user := radosgw.GenerateCephUserInput(cr)
+	c.observer.Changed(user.ID)
+	// A user that is already gone needs no removing.
 	err = c.rgwClient.RemoveUser(ctx, *user)
-	if err != nil {
+	if resource.Ignore(radosgw.IsNotFound, err) != nil {
 		c.log.Info("Failed to remove cephUser on radosgw", "cephUser_uid", cr.Spec.ForProvider.UID, "error", err.Error())
-		return errors.Wrap(err, errDeleteCephUser)
+		return c.record(cr, err, errDeleteCephUser)
 
 	}
 
-	err = vault.RemoveSecretFromVault(c.vaultClient, *cr.Spec.ForProvider.VaultCredentialsStore, &secretPath)
+	for _, store := range c.stores {
+		if err := store.Delete(ctx, cr); err != nil {
+			c.log.Info("Failed to remove cephUser credentials", "cephUser_uid", cr.Spec.ForProvider.UID, "error", err.Error())
+			return errors.Wrap(err, errCredentialsCleanup)
+		}
+	}
+	return nil
+}
+
+// observeCredentials renders the credentials of the supplied CephUser from the
+// key it recorded writing last, and finds the stores that do not hold them,
+// e.g. because its credentials template changed or they were removed from
+// Vault. A key that the user no longer has, e.g. because it was revoked, is to
+// be rotated instead. Nothing is observed while that key is unknown, e.g. for
+// CephUsers created before keys were recorded.
+func (c *external) observeCredentials(ctx context.Context, cr *v1alpha1.CephUser, user radosgw.UserInfo) error {
+	c.rendered, c.outdated, c.rotate = nil, nil, false
+	if cr.Status.AtProvider.Credentials == nil || cr.Status.AtProvider.Credentials.AccessKeyID == "" {
+		return nil
+	}
+	key, ok := recordedKey(cr, user)
+	if !ok {
+		c.rotate = true
+		return nil
+	}
+	data, err := credentials.Render(cr.Spec.ForProvider.CredentialsTemplate, credentials.NewTemplateData(cr, c.pc, key.AccessKey, key.SecretKey))
 	if err != nil {
-		c.log.Info("Failed to remove credentials from Vault", "cephUser_uid", cr.Spec.ForProvider.UID, "error", err.Error())
-		return errors.Wrap(err, errVaultCleanup)
+		return errors.Wrap(err, errRenderCredentials)
+	}
+	c.rendered = data
+	for _, store := range c.stores {
+		stored, err := store.Read(ctx, cr)
+		if err != nil {
+			return errors.Wrap(err, errReadCredentials)
+		}
+		if !reflect.DeepEqual(stored, data) {
+			c.outdated = append(c.outdated, store)
+		}
 	}
 	return nil
 }
 
-// isAlreadyExists helper function to test for an already existing user
-func isAlreadyExists(err error) bool {
-	// TODO can we check for direct client error types
-	if err == nil {
-		return false
+// recordedKey returns the key of the supplied user the supplied CephUser
+// recorded writing to its stores last, if the user still has it.
+func recordedKey(cr *v1alpha1.CephUser, user radosgw.UserInfo) (radosgw_admin.UserKeySpec, bool) {
+	c := cr.Status.AtProvider.Credentials
+	if c == nil || c.AccessKeyID == "" {
+		return radosgw_admin.UserKeySpec{}, false
 	}
-	if strings.HasPrefix(err.Error(), "KeyExists") {
-		return true
+	for _, k := range user.Keys {
+		if k.AccessKey == c.AccessKeyID {
+			return k, true
+		}
 	}
-	return false
+	return radosgw_admin.UserKeySpec{}, false
+}
+
+// rotateKey adds a new generated key to the user of the supplied CephUser, and
+// writes the credentials rendered from it to every store. The key it replaces
+// is no longer one of the user's, so there is nothing to remove.
+func (c *external) rotateKey(ctx context.Context, cr *v1alpha1.CephUser) error {
+	user := radosgw.GenerateCephUserInput(cr)
+	if err := c.addKey(ctx, user); err != nil {
+		c.log.Info("Failed to rotate cephUser access key on radosgw", "cephUser_uid", cr.Spec.ForProvider.UID, "error", err.Error())
+		return c.record(cr, err, errRotateKey)
+	}
+	// Record the new key right away, so that if it cannot be written, it is
+	// written again rather than replaced by yet another key. The status is
+	// persisted even if Update fails.
+	cr.Status.AtProvider.Credentials.AccessKeyID = user.Keys[0].AccessKey
+	data, err := credentials.Render(cr.Spec.ForProvider.CredentialsTemplate,
+		credentials.NewTemplateData(cr, c.pc, user.Keys[0].AccessKey, user.Keys[0].SecretKey))
+	if err != nil {
+		return errors.Wrap(err, errRenderCredentials)
+	}
+	if err := c.writeCredentials(ctx, cr, user.Keys[0].AccessKey, data, c.stores); err != nil {
+		return err
+	}
+	c.rendered = data
+	return nil
+}
+
+// writeCredentials writes the supplied credentials, rendered from the supplied
+// access key, to the supplied stores, and records having done so in the status
+// of the supplied CephUser.
+func (c *external) writeCredentials(ctx context.Context, cr *v1alpha1.CephUser, accessKey string, data map[string]string, stores []credentials.Store) error {
+	for _, store := range stores {
+		if err := store.Write(ctx, cr, data); err != nil {
+			c.log.Info("Failed to store cephUser credentials", "cephUser_uid", cr.Spec.ForProvider.UID, "error", err.Error())
+			return errors.Wrap(err, errStoreCredentials)
+		}
+	}
+
+	if cr.Status.AtProvider.Credentials == nil {
+		cr.Status.AtProvider.Credentials = &v1alpha1.CredentialsObservation{}
+	}
+	now := metav1.Now()
+	cr.Status.AtProvider.Credentials.AccessKeyID = accessKey
+	cr.Status.AtProvider.Credentials.LastWrittenTime = &now
+	return nil
+}
+
+// connectionDetails returns the supplied credentials as connection details.
+func connectionDetails(data map[string]string) managed.ConnectionDetails {
+	conn := managed.ConnectionDetails{}
+	for k, v := range data {
+		conn[k] = []byte(v)
+	}
+	return conn
+}
+
+// record why radosgw failed a request for the supplied CephUser, and return
+// the error describing why. The client is not reused once radosgw rejected its
+// credentials, so that they are read from Vault again, e.g. after a rotation.
+// Credentials that radosgw accepted but that lack a capability are read again
+// only once the client reaches its maximum age: reading them sooner would not
+// grant the capability.
+func (c *external) record(cr *v1alpha1.CephUser, err error, msg string) error {
+	if c.rgwClients != nil && radosgw.IsUnauthorized(err) && !radosgw.IsAccessDenied(err) {
+		c.rgwClients.Invalidate(c.pc.GetUID())
+	}
+	return c.requeue.record(cr.GetName(), err, msg)
+}
+
+// addKey adds the generated access key of the supplied user to the user as it
+// exists in radosgw.
+func (c *external) addKey(ctx context.Context, user *radosgw_admin.User) error {
+	generate := false
+	_, err := c.rgwClient.CreateKey(ctx, radosgw_admin.UserKeySpec{
+		UID:         user.ID,
+		AccessKey:   user.Keys[0].AccessKey,
+		SecretKey:   user.Keys[0].SecretKey,
+		KeyType:     "s3",
+		GenerateKey: &generate,
+	})
+	return err
+}
+
+// isAlreadyExists returns true if the supplied error indicates that the access
+// key of the user was created before. Other conflicts, e.g. an email that
+// belongs to another user, are not.
+func isAlreadyExists(err error) bool {
+	return errors.Is(err, radosgw_admin.ErrKeyExists)
 }
 
-func cephUserHasBuckets(radosgwClient *radosgw_admin.API, cephUser *v1alpha1.CephUser) (bool, error) {
-	buckets, err := radosgwClient.ListUsersBuckets(context.TODO(), *cephUser.Spec.ForProvider.UID)
+func cephUserHasBuckets(radosgwClient radosgw.Client, cephUser *v1alpha1.CephUser) (bool, error) {
+	buckets, err := radosgwClient.ListUsersBuckets(context.TODO(), radosgw.UserID(cephUser.Spec.ForProvider))
 	if err != nil {
 		return false, errors.Wrap(err, errListBuckets)
 	}
@@ -18,13 +18,32 @@ package cephuser
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	vault_sdk "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/credentials"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw/fake"
 )
 
 // Unlike many Kubernetes projects Crossplane does not use third party testing
@@ -35,9 +54,178 @@ import (
 // https://github.com/golang/go/wiki/TestComments
 // https://github.com/crossplane/crossplane/blob/master/CONTRIBUTING.md#contributing-code
 
+var errUnavailable = &radosgw.StatusError{StatusCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable"}
+
+// rgw returns an in-memory radosgw with the supplied users. Their keys are
+// fixed so what the fake reports is predictable.
+func rgw(t *testing.T, uids ...string) *fake.Client {
+	t.Helper()
+	c := fake.NewClient()
+	for _, uid := range uids {
+		u := radosgw_admin.User{ID: uid, DisplayName: uid, Keys: []radosgw_admin.UserKeySpec{{AccessKey: "AK-" + uid, SecretKey: "SK"}}}
+		if _, err := c.CreateUser(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// withoutKeys removes the keys of the supplied user of the supplied radosgw.
+func withoutKeys(t *testing.T, c *fake.Client, uid string) *fake.Client {
+	t.Helper()
+	u, err := c.GetUserInfo(context.Background(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range u.Keys {
+		if err := c.RemoveKey(context.Background(), radosgw_admin.UserKeySpec{UID: uid, AccessKey: k.AccessKey, KeyType: "s3"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// withErrors makes the supplied radosgw fail the supplied methods.
+func withErrors(c *fake.Client, errs map[string]error) *fake.Client {
+	c.Errors = errs
+	return c
+}
+
+type cephUserModifier func(*v1alpha1.CephUser)
+
+func withDisplayName(name string) cephUserModifier {
+	return func(cr *v1alpha1.CephUser) { cr.Spec.ForProvider.DisplayedName = &name }
+}
+
+func withOpMask(mask string) cephUserModifier {
+	return func(cr *v1alpha1.CephUser) { cr.Spec.ForProvider.OpMask = &mask }
+}
+
+func withMaxObjects(n int64) cephUserModifier {
+	return func(cr *v1alpha1.CephUser) { cr.Spec.ForProvider.UserQuotaMaxObjects = &n }
+}
+
+func withTenant(tenant string) cephUserModifier {
+	return func(cr *v1alpha1.CephUser) { cr.Spec.ForProvider.Tenant = &tenant }
+}
+
+func withCredentialsTemplate(tmpl map[string]string) cephUserModifier {
+	return func(cr *v1alpha1.CephUser) { cr.Spec.ForProvider.CredentialsTemplate = tmpl }
+}
+
+// withWrittenKey records that the credentials of the supplied access key were
+// written to the stores of the CephUser.
+func withWrittenKey(accessKey string) cephUserModifier {
+	return func(cr *v1alpha1.CephUser) {
+		cr.Status.AtProvider.Credentials = &v1alpha1.CredentialsObservation{AccessKeyID: accessKey}
+	}
+}
+
+func cephUser(m ...cephUserModifier) *v1alpha1.CephUser {
+	uid := "user"
+	cr := &v1alpha1.CephUser{Spec: v1alpha1.CephUserSpec{ForProvider: v1alpha1.CephUserParameters{UID: &uid}}}
+	cr.SetName("user")
+	for _, f := range m {
+		f(cr)
+	}
+	return cr
+}
+
+type userModifier func(*radosgw.UserInfo)
+
+func withUserOpMask(mask string) userModifier {
+	return func(u *radosgw.UserInfo) { u.OpMask = mask }
+}
+
+func withUserQuota(enabled bool, maxObjects int64) userModifier {
+	return func(u *radosgw.UserInfo) {
+		u.UserQuota.Enabled = &enabled
+		u.UserQuota.MaxObjects = &maxObjects
+	}
+}
+
+func withUserDisplayName(name string) userModifier {
+	return func(u *radosgw.UserInfo) { u.DisplayName = name }
+}
+
+// userInfo returns what the in-memory radosgw reports for a user created by
+// rgw, or by a CephUser with no parameters but its uid.
+func userInfo(uid string, m ...userModifier) radosgw.UserInfo {
+	zero, maxBuckets, disabled := 0, 1000, false
+	unlimited := func() radosgw_admin.QuotaSpec {
+		size, kb, objects := int64(-1), 0, int64(-1)
+		return radosgw_admin.QuotaSpec{Enabled: &disabled, MaxSize: &size, MaxSizeKb: &kb, MaxObjects: &objects}
+	}
+	u := radosgw.UserInfo{User: radosgw_admin.User{
+		ID:          uid,
+		DisplayName: uid,
+		Suspended:   &zero,
+		MaxBuckets:  &maxBuckets,
+		Subusers:    []radosgw_admin.SubuserSpec{},
+		Keys:        []radosgw_admin.UserKeySpec{{User: uid, AccessKey: "AK-" + uid, SecretKey: "SK"}},
+		SwiftKeys:   []radosgw_admin.SwiftKeySpec{},
+		Caps:        []radosgw_admin.UserCapSpec{},
+		OpMask:      "read, write, delete",
+		BucketQuota: unlimited(),
+		UserQuota:   unlimited(),
+		Type:        "rgw",
+	}}
+	for _, f := range m {
+		f(&u)
+	}
+	return u
+}
+
+// users returns every user of the supplied radosgw.
+func users(t *testing.T, c *fake.Client) map[string]radosgw.UserInfo {
+	t.Helper()
+	out := map[string]radosgw.UserInfo{}
+	for _, uid := range c.Users() {
+		u, err := c.GetUserInfo(context.Background(), uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[uid] = u
+	}
+	return out
+}
+
+// A memoryStore keeps the credentials written to it.
+type memoryStore struct {
+	data map[string]string
+}
+
+func (s *memoryStore) Write(_ context.Context, _ *v1alpha1.CephUser, data map[string]string) error {
+	s.data = data
+	return nil
+}
+
+func (s *memoryStore) Read(_ context.Context, _ *v1alpha1.CephUser) (map[string]string, error) {
+	return s.data, nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, _ *v1alpha1.CephUser) error {
+	s.data = nil
+	return nil
+}
+
+// keyOf returns the user whose key the supplied credentials are, if any.
+func keyOf(users map[string]radosgw.UserInfo, data map[string]string) string {
+	for uid, u := range users {
+		for _, k := range u.Keys {
+			if k.AccessKey == data[credentials.KeyAccessKey] && k.SecretKey == data[credentials.KeySecretKey] {
+				return uid
+			}
+		}
+	}
+	return ""
+}
+
 func TestObserve(t *testing.T) {
 	type fields struct {
-		service interface{}
+		rgw           *fake.Client
+		defaultTenant *string
+		stored        map[string]string
 	}
 
 	type args struct {
@@ -50,18 +238,158 @@ func TestObserve(t *testing.T) {
 		err error
 	}
 
+	tenant := "tenant"
+
 	cases := map[string]struct {
 		reason string
 		fields fields
 		args   args
 		want   want
 	}{
-		// TODO: Add test cases.
+		"NotFound": {
+			reason: "A user radosgw reports missing should be created.",
+			fields: fields{rgw: rgw(t)},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want:   want{o: managed.ExternalObservation{ResourceExists: false}},
+		},
+		"Unavailable": {
+			reason: "A failing radosgw should not be mistaken for a missing user.",
+			fields: fields{rgw: withErrors(rgw(t, "user"), map[string]error{fake.MethodGetUserInfo: errUnavailable})},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want:   want{err: errors.Wrap(errUnavailable, errGetCephUser+" (Unavailable)")},
+		},
+		"Unauthorized": {
+			reason: "Rejected admin credentials should not be mistaken for a missing user.",
+			fields: fields{rgw: withErrors(rgw(t), map[string]error{
+				fake.MethodGetUserInfo: &radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "AccessDenied"},
+			})},
+			args: args{ctx: context.Background(), mg: cephUser()},
+			want: want{
+				err: errors.Wrap(&radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "AccessDenied"}, errGetCephUser+" (Unauthorized)"),
+			},
+		},
+		"LateInitialized": {
+			reason: "Parameters that are not set should be filled in with what radosgw reports.",
+			fields: fields{rgw: rgw(t, "user")},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:          true,
+				ResourceUpToDate:        true,
+				ResourceLateInitialized: true,
+				ConnectionDetails:       managed.ConnectionDetails{},
+			}},
+		},
+		"UpToDate": {
+			reason: "A user whose every parameter matches what radosgw reports is up to date.",
+			fields: fields{rgw: rgw(t, "user")},
+			args: args{ctx: context.Background(), mg: func() resource.Managed {
+				cr := cephUser()
+				radosgw.LateInitializeCephUser(&cr.Spec.ForProvider, userInfo("user"))
+				return cr
+			}()},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:    true,
+				ResourceUpToDate:  true,
+				ConnectionDetails: managed.ConnectionDetails{},
+			}},
+		},
+		"OpMaskOutdated": {
+			reason: "A user whose op-mask differs from what radosgw reports needs an update.",
+			fields: fields{rgw: rgw(t, "user")},
+			args:   args{ctx: context.Background(), mg: cephUser(withOpMask("read"))},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:          true,
+				ResourceUpToDate:        false,
+				ResourceLateInitialized: true,
+				ConnectionDetails:       managed.ConnectionDetails{},
+			}},
+		},
+		"OpMaskEquivalent": {
+			reason: "An op-mask radosgw reports differently but means the same is up to date.",
+			fields: fields{rgw: rgw(t, "user")},
+			args:   args{ctx: context.Background(), mg: cephUser(withOpMask("*"))},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:          true,
+				ResourceUpToDate:        true,
+				ResourceLateInitialized: true,
+				ConnectionDetails:       managed.ConnectionDetails{},
+			}},
+		},
+		"DefaultTenant": {
+			reason: "A user without a tenant should be looked up in the default tenant of its ProviderConfig.",
+			fields: fields{rgw: rgw(t, "tenant$user"), defaultTenant: &tenant},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:          true,
+				ResourceUpToDate:        true,
+				ResourceLateInitialized: true,
+				ConnectionDetails:       managed.ConnectionDetails{},
+			}},
+		},
+		"OtherTenant": {
+			reason: "A user should not be found in a tenant other than its own.",
+			fields: fields{rgw: rgw(t, "user"), defaultTenant: &tenant},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want:   want{o: managed.ExternalObservation{ResourceExists: false}},
+		},
+		"CredentialsUpToDate": {
+			reason: "Stored credentials rendered from the recorded key should be up to date, and be the connection details.",
+			fields: fields{rgw: rgw(t, "user"), stored: map[string]string{credentials.KeyAccessKey: "AK-user", credentials.KeySecretKey: "SK"}},
+			args:   args{ctx: context.Background(), mg: cephUser(withWrittenKey("AK-user"))},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:          true,
+				ResourceUpToDate:        true,
+				ResourceLateInitialized: true,
+				ConnectionDetails:       managed.ConnectionDetails{credentials.KeyAccessKey: []byte("AK-user"), credentials.KeySecretKey: []byte("SK")},
+			}},
+		},
+		"TemplateChanged": {
+			reason: "Stored credentials that were rendered from another template should need an update.",
+			fields: fields{rgw: rgw(t, "user"), stored: map[string]string{credentials.KeyAccessKey: "AK-user", credentials.KeySecretKey: "SK"}},
+			args: args{ctx: context.Background(), mg: cephUser(
+				withWrittenKey("AK-user"),
+				withCredentialsTemplate(map[string]string{"AWS_ACCESS_KEY_ID": "{{ .AccessKey }}"}),
+			)},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:          true,
+				ResourceUpToDate:        false,
+				ResourceLateInitialized: true,
+				ConnectionDetails:       managed.ConnectionDetails{"AWS_ACCESS_KEY_ID": []byte("AK-user")},
+			}},
+		},
+		"KeyRemoved": {
+			reason: "A user that no longer has the key that was written should need an update.",
+			fields: fields{rgw: rgw(t, "user"), stored: map[string]string{credentials.KeyAccessKey: "AK-revoked", credentials.KeySecretKey: "SK"}},
+			args:   args{ctx: context.Background(), mg: cephUser(withWrittenKey("AK-revoked"))},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:          true,
+				ResourceUpToDate:        false,
+				ResourceLateInitialized: true,
+				ConnectionDetails:       managed.ConnectionDetails{},
+			}},
+		},
+		"CredentialsMissing": {
+			reason: "Credentials that were removed from a store should need an update.",
+			fields: fields{rgw: rgw(t, "user")},
+			args:   args{ctx: context.Background(), mg: cephUser(withWrittenKey("AK-user"))},
+			want: want{o: managed.ExternalObservation{
+				ResourceExists:          true,
+				ResourceUpToDate:        false,
+				ResourceLateInitialized: true,
+				ConnectionDetails:       managed.ConnectionDetails{credentials.KeyAccessKey: []byte("AK-user"), credentials.KeySecretKey: []byte("SK")},
+			}},
+		},
 	}
 
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			e := external{service: tc.fields.service}
+			e := external{
+				rgwClient:     tc.fields.rgw,
+				stores:        []credentials.Store{&memoryStore{data: tc.fields.stored}},
+				pc:            &apisv1alpha1.ProviderConfig{},
+				defaultTenant: tc.fields.defaultTenant,
+				log:           logging.NewNopLogger(),
+			}
 			got, err := e.Observe(tc.args.ctx, tc.args.mg)
 			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
 				t.Errorf("\n%s\ne.Observe(...): -want error, +got error:\n%s\n", tc.reason, diff)
@@ -72,3 +400,452 @@ func TestObserve(t *testing.T) {
 		})
 	}
 }
+
+func TestCreate(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	type fields struct {
+		rgw  *fake.Client
+		kube client.Client
+	}
+
+	type args struct {
+		ctx context.Context
+		mg  resource.Managed
+	}
+
+	type want struct {
+		users map[string]radosgw.UserInfo
+		// storedKeyOf is the user whose key the stored credentials are.
+		storedKeyOf string
+		err         error
+	}
+
+	cases := map[string]struct {
+		reason string
+		fields fields
+		args   args
+		want   want
+	}{
+		"Created": {
+			reason: "A user should be created with a quota enabled.",
+			fields: fields{rgw: rgw(t), kube: test.NewMockClient()},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{
+				users: map[string]radosgw.UserInfo{
+					"user": userInfo("user", withUserQuota(true, -1)),
+				},
+				storedKeyOf: "user",
+			},
+		},
+		"CreatedInTenant": {
+			reason: "A user of a tenant should be created as 'tenant$uid'.",
+			fields: fields{rgw: rgw(t), kube: test.NewMockClient()},
+			args:   args{ctx: context.Background(), mg: cephUser(withTenant("tenant"))},
+			want: want{
+				users: map[string]radosgw.UserInfo{
+					"tenant$user": userInfo("tenant$user", withUserDisplayName("user"), withUserQuota(true, -1)),
+				},
+				storedKeyOf: "tenant$user",
+			},
+		},
+		"ExtendedAttributes": {
+			reason: "Attributes radosgw does not accept on creation should be set right after.",
+			fields: fields{rgw: rgw(t), kube: test.NewMockClient()},
+			args:   args{ctx: context.Background(), mg: cephUser(withOpMask("read,write"), withMaxObjects(10))},
+			want: want{
+				users: map[string]radosgw.UserInfo{
+					"user": userInfo("user", withUserOpMask("read, write"), withUserQuota(true, 10)),
+				},
+				storedKeyOf: "user",
+			},
+		},
+		"AlreadyExists": {
+			reason: "A user that already exists without keys should be adopted with credentials radosgw accepts.",
+			fields: fields{rgw: withoutKeys(t, rgw(t, "user"), "user"), kube: test.NewMockClient()},
+			args:   args{ctx: context.Background(), mg: cephUser(withMaxObjects(10))},
+			want: want{
+				users: map[string]radosgw.UserInfo{
+					"user": userInfo("user", withUserQuota(true, 10)),
+				},
+				storedKeyOf: "user",
+			},
+		},
+		"AlreadyExistsWithKeys": {
+			reason: "A user that already exists with keys the CephUser did not create should not be adopted.",
+			fields: fields{rgw: rgw(t, "user"), kube: test.NewMockClient()},
+			args:   args{ctx: context.Background(), mg: cephUser(withMaxObjects(10))},
+			want: want{
+				users: map[string]radosgw.UserInfo{"user": userInfo("user")},
+				err:   errors.New(errAdoptKeyedCephUser),
+			},
+		},
+		"CreateFailed": {
+			reason: "Errors creating the user should be returned with their class.",
+			fields: fields{rgw: withErrors(rgw(t), map[string]error{fake.MethodCreateUser: errUnavailable}), kube: test.NewMockClient()},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{
+				users: map[string]radosgw.UserInfo{},
+				err:   errors.Wrap(errUnavailable, errCreateCephUser+" (Unavailable)"),
+			},
+		},
+		"QuotaFailed": {
+			reason: "Errors setting the quota should be returned with their class.",
+			fields: fields{rgw: withErrors(rgw(t), map[string]error{fake.MethodSetUserQuota: errUnavailable}), kube: test.NewMockClient()},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{
+				users: map[string]radosgw.UserInfo{"user": userInfo("user")},
+				err:   errors.Wrap(errUnavailable, errSetUserQuota+" (Unavailable)"),
+			},
+		},
+		"FinalizerFailed": {
+			reason: "Errors adding the in-use finalizer should be returned.",
+			fields: fields{rgw: rgw(t), kube: &test.MockClient{MockUpdate: test.NewMockUpdateFn(errBoom)}},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{
+				users: map[string]radosgw.UserInfo{"user": userInfo("user", withUserQuota(true, -1))},
+				err:   errBoom,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			store := &memoryStore{}
+			e := external{
+				rgwClient:  tc.fields.rgw,
+				stores:     []credentials.Store{store},
+				kubeClient: tc.fields.kube,
+				pc:         &apisv1alpha1.ProviderConfig{},
+				log:        logging.NewNopLogger(),
+			}
+			_, err := e.Create(tc.args.ctx, tc.args.mg)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\ne.Create(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.storedKeyOf, keyOf(users(t, tc.fields.rgw), store.data)); diff != "" {
+				t.Errorf("\n%s\ne.Create(...): -want owner of stored key, +got owner of stored key:\n%s\n", tc.reason, diff)
+			}
+			// Created users get random keys.
+			if diff := cmp.Diff(tc.want.users, users(t, tc.fields.rgw), cmpopts.IgnoreFields(radosgw_admin.User{}, "Keys")); diff != "" {
+				t.Errorf("\n%s\ne.Create(...): -want users, +got users:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	type fields struct {
+		rgw *fake.Client
+		// rendered are the credentials Observe rendered, and outdated
+		// whether it found the store not to hold them.
+		rendered map[string]string
+		outdated bool
+	}
+
+	type args struct {
+		ctx context.Context
+		mg  resource.Managed
+	}
+
+	type want struct {
+		users  map[string]radosgw.UserInfo
+		stored map[string]string
+		conn   managed.ConnectionDetails
+		err    error
+	}
+
+	cases := map[string]struct {
+		reason string
+		fields fields
+		args   args
+		want   want
+	}{
+		"Updated": {
+			reason: "The attributes and quota of the user should be set to its parameters.",
+			fields: fields{rgw: rgw(t, "user")},
+			args:   args{ctx: context.Background(), mg: cephUser(withDisplayName("User"), withOpMask("read"), withMaxObjects(10))},
+			want: want{
+				users: map[string]radosgw.UserInfo{
+					"user": userInfo("user", withUserDisplayName("User"), withUserOpMask("read"), withUserQuota(true, 10)),
+				},
+				conn: managed.ConnectionDetails{},
+			},
+		},
+		"CredentialsWritten": {
+			reason: "Credentials the store does not hold should be written to it, and be the connection details.",
+			fields: fields{rgw: rgw(t, "user"), rendered: map[string]string{"AWS_ACCESS_KEY_ID": "AK-user"}, outdated: true},
+			args:   args{ctx: context.Background(), mg: cephUser(withWrittenKey("AK-user"))},
+			want: want{
+				users:  map[string]radosgw.UserInfo{"user": userInfo("user", withUserQuota(true, -1))},
+				stored: map[string]string{"AWS_ACCESS_KEY_ID": "AK-user"},
+				conn:   managed.ConnectionDetails{"AWS_ACCESS_KEY_ID": []byte("AK-user")},
+			},
+		},
+		"CredentialsUpToDate": {
+			reason: "Credentials the store holds should not be written again, but be the connection details.",
+			fields: fields{rgw: rgw(t, "user"), rendered: map[string]string{"AWS_ACCESS_KEY_ID": "AK-user"}},
+			args:   args{ctx: context.Background(), mg: cephUser(withWrittenKey("AK-user"))},
+			want: want{
+				users: map[string]radosgw.UserInfo{"user": userInfo("user", withUserQuota(true, -1))},
+				conn:  managed.ConnectionDetails{"AWS_ACCESS_KEY_ID": []byte("AK-user")},
+			},
+		},
+		"NotFound": {
+			reason: "Updating a user that disappeared should fail as not found.",
+			fields: fields{rgw: rgw(t)},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{
+				users: map[string]radosgw.UserInfo{},
+				err:   errors.Wrap(&radosgw.StatusError{StatusCode: http.StatusNotFound, Code: "NoSuchUser"}, errModifyCephUser+" (NotFound)"),
+			},
+		},
+		"QuotaFailed": {
+			reason: "Errors setting the quota should be returned with their class.",
+			fields: fields{rgw: withErrors(rgw(t, "user"), map[string]error{fake.MethodSetUserQuota: errUnavailable})},
+			args:   args{ctx: context.Background(), mg: cephUser(withOpMask("read"))},
+			want: want{
+				users: map[string]radosgw.UserInfo{"user": userInfo("user", withUserOpMask("read"))},
+				err:   errors.Wrap(errUnavailable, errSetUserQuota+" (Unavailable)"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			store := &memoryStore{}
+			e := external{rgwClient: tc.fields.rgw, stores: []credentials.Store{store}, rendered: tc.fields.rendered, log: logging.NewNopLogger()}
+			if tc.fields.outdated {
+				e.outdated = e.stores
+			}
+			got, err := e.Update(tc.args.ctx, tc.args.mg)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\ne.Update(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.stored, store.data); diff != "" {
+				t.Errorf("\n%s\ne.Update(...): -want stored credentials, +got stored credentials:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.conn, got.ConnectionDetails); diff != "" {
+				t.Errorf("\n%s\ne.Update(...): -want connection details, +got connection details:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.users, users(t, tc.fields.rgw)); diff != "" {
+				t.Errorf("\n%s\ne.Update(...): -want users, +got users:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestUpdateRotateKey(t *testing.T) {
+	c := rgw(t, "user")
+	store := &memoryStore{data: map[string]string{credentials.KeyAccessKey: "AK-revoked", credentials.KeySecretKey: "SK"}}
+	e := external{rgwClient: c, stores: []credentials.Store{store}, pc: &apisv1alpha1.ProviderConfig{}, rotate: true, log: logging.NewNopLogger()}
+	cr := cephUser(withWrittenKey("AK-revoked"))
+
+	got, err := e.Update(context.Background(), cr)
+	if err != nil {
+		t.Fatalf("e.Update(...): %v", err)
+	}
+
+	reason := "A key that was removed from the user should be replaced by a new one that is stored and recorded."
+	u := users(t, c)["user"]
+	if diff := cmp.Diff(2, len(u.Keys)); diff != "" {
+		t.Errorf("\n%s\ne.Update(...): -want keys, +got keys:\n%s\n", reason, diff)
+	}
+	if diff := cmp.Diff("user", keyOf(users(t, c), store.data)); diff != "" {
+		t.Errorf("\n%s\ne.Update(...): -want owner of stored key, +got owner of stored key:\n%s\n", reason, diff)
+	}
+	if diff := cmp.Diff(store.data[credentials.KeyAccessKey], cr.Status.AtProvider.Credentials.AccessKeyID); diff != "" {
+		t.Errorf("\n%s\ne.Update(...): -want recorded key, +got recorded key:\n%s\n", reason, diff)
+	}
+	if diff := cmp.Diff(connectionDetails(store.data), got.ConnectionDetails); diff != "" {
+		t.Errorf("\n%s\ne.Update(...): -want connection details, +got connection details:\n%s\n", reason, diff)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	type fields struct {
+		rgw     *fake.Client
+		buckets map[string]string
+	}
+
+	type args struct {
+		ctx context.Context
+		mg  resource.Managed
+	}
+
+	type want struct {
+		users []string
+		err   error
+	}
+
+	cases := map[string]struct {
+		reason string
+		fields fields
+		args   args
+		want   want
+	}{
+		"Deleted": {
+			reason: "A user without buckets should be removed.",
+			fields: fields{rgw: rgw(t, "user", "other")},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want:   want{users: []string{"other"}},
+		},
+		"AlreadyGone": {
+			reason: "A user that is already gone should count as removed.",
+			fields: fields{rgw: withErrors(rgw(t, "user"), map[string]error{
+				fake.MethodRemoveUser: &radosgw.StatusError{StatusCode: http.StatusNotFound, Code: "NoSuchUser"},
+			})},
+			args: args{ctx: context.Background(), mg: cephUser()},
+			want: want{users: []string{"user"}},
+		},
+		"HasBuckets": {
+			reason: "A user that still owns buckets should not be removed.",
+			fields: fields{rgw: rgw(t, "user"), buckets: map[string]string{"bucket": "user"}},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want:   want{users: []string{"user"}, err: fmt.Errorf(errUserStillHasBuckets)},
+		},
+		"ListBucketsFailed": {
+			reason: "A user should not be removed if radosgw fails to tell whether it owns buckets.",
+			fields: fields{rgw: withErrors(rgw(t, "user"), map[string]error{fake.MethodListUsersBuckets: errUnavailable})},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{
+				users: []string{"user"},
+				err:   errors.Wrap(errors.Wrap(errUnavailable, errListBuckets), errDeleteCephUser+" (Unavailable)"),
+			},
+		},
+		"RemoveFailed": {
+			reason: "Errors removing the user should be returned with their class.",
+			fields: fields{rgw: withErrors(rgw(t, "user"), map[string]error{fake.MethodRemoveUser: errUnavailable})},
+			args:   args{ctx: context.Background(), mg: cephUser()},
+			want: want{
+				users: []string{"user"},
+				err:   errors.Wrap(errUnavailable, errDeleteCephUser+" (Unavailable)"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			for bucket, owner := range tc.fields.buckets {
+				tc.fields.rgw.AddBucket(owner, bucket)
+			}
+			e := external{rgwClient: tc.fields.rgw, kubeClient: test.NewMockClient(), log: logging.NewNopLogger()}
+			err := e.Delete(tc.args.ctx, tc.args.mg)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\ne.Delete(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.users, tc.fields.rgw.Users()); diff != "" {
+				t.Errorf("\n%s\ne.Delete(...): -want users, +got users:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConnect(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	// adminVault serves the radosgw admin credentials of every ProviderConfig.
+	adminVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"access_key": "AK", "secret_key": "SK"}})
+	}))
+	defer adminVault.Close()
+	vaultClient := func(context.Context, v1alpha1.VaultConfig) (*vault_sdk.Client, error) {
+		cfg := vault_sdk.DefaultConfig()
+		cfg.Address = adminVault.URL
+		return vault_sdk.NewClient(cfg)
+	}
+
+	type fields struct {
+		vaultClientFn func(ctx context.Context, config v1alpha1.VaultConfig) (*vault_sdk.Client, error)
+		host          string
+	}
+
+	cases := map[string]struct {
+		reason string
+		fields fields
+		want   error
+	}{
+		"VaultUnavailable": {
+			reason: "Failing to log in to Vault should be returned rather than panic.",
+			fields: fields{
+				vaultClientFn: func(context.Context, v1alpha1.VaultConfig) (*vault_sdk.Client, error) { return nil, errBoom },
+				host:          "http://rgw.example.com",
+			},
+			want: errors.Wrap(errBoom, errCreateAdminVaultClient),
+		},
+		"InvalidHost": {
+			reason: "A ProviderConfig with an invalid host should fail only its own resources.",
+			fields: fields{vaultClientFn: vaultClient, host: "rgw.example.com"},
+			want:   errors.Wrap(errors.New(`radosgw host must be an http or https URL: "rgw.example.com"`), errNewClient),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &connector{
+				kube: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj client.Object) error {
+						obj.(*apisv1alpha1.ProviderConfig).Spec.HostName = tc.fields.host
+						return nil
+					},
+				},
+				usage:              resource.TrackerFn(func(context.Context, resource.Managed) error { return nil }),
+				newRadosgwClientFn: radosgw.NewClient,
+				rgwClients:         radosgw.NewClientCache(time.Minute),
+				vaultClientFn:      tc.fields.vaultClientFn,
+			}
+			cr := &v1alpha1.CephUser{Spec: v1alpha1.CephUserSpec{ResourceSpec: xpv1.ResourceSpec{ProviderConfigReference: &xpv1.Reference{Name: "ceph-cl01"}}}}
+
+			_, err := c.Connect(context.Background(), cr)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nc.Connect(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   bool
+	}{
+		"Rejected": {
+			reason: "The client should be created again once radosgw rejected its credentials.",
+			err:    &radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "InvalidAccessKeyId"},
+			want:   true,
+		},
+		"AccessDenied": {
+			reason: "The client should be reused when its credentials lack a capability.",
+			err:    &radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "AccessDenied"},
+		},
+		"Unavailable": {
+			reason: "The client should be reused when radosgw is unavailable.",
+			err:    errUnavailable,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			pc := &apisv1alpha1.ProviderConfig{ObjectMeta: metav1.ObjectMeta{UID: "pc"}}
+			created := 0
+			newClient := func(context.Context) (radosgw.Client, error) {
+				created++
+				return fake.NewClient(), nil
+			}
+			e := external{rgwClients: radosgw.NewClientCache(time.Minute), pc: pc}
+			if _, err := e.rgwClients.Get(context.Background(), pc, newClient); err != nil {
+				t.Fatal(err)
+			}
+
+			_ = e.record(cephUser(), tc.err, errGetCephUser)
+
+			if _, err := e.rgwClients.Get(context.Background(), pc, newClient); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, created > 1); diff != "" {
+				t.Errorf("\n%s\ne.record(...): -want client created again, +got client created again:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
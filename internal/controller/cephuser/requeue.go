@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephuser
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+// throttledRequeueAfter is how long to wait before retrying a CephUser after
+// radosgw asked to slow down. Backing off exponentially from a second would
+// only add to the load of a cluster that is already struggling.
+const throttledRequeueAfter = 30 * time.Second
+
+// A requeuer requeues CephUsers whose reconcile failed because of radosgw
+// depending on why it failed. The managed reconciler requeues every failure
+// with an exponential backoff, which suits transient errors but retries
+// throttled requests too eagerly and rejected credentials pointlessly.
+type requeuer struct {
+	reconcile.Reconciler
+
+	unauthorizedRequeueAfter time.Duration
+
+	mu      sync.Mutex
+	reasons map[string]radosgw.Reason
+}
+
+func newRequeuer(r reconcile.Reconciler, pollInterval time.Duration) *requeuer {
+	return &requeuer{
+		Reconciler:               r,
+		unauthorizedRequeueAfter: pollInterval,
+		reasons:                  map[string]radosgw.Reason{},
+	}
+}
+
+// Reconcile the supplied request, adjusting when it is requeued if radosgw
+// failed it.
+func (r *requeuer) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	res, err := r.Reconciler.Reconcile(ctx, req)
+
+	r.mu.Lock()
+	reason := r.reasons[req.Name]
+	delete(r.reasons, req.Name)
+	r.mu.Unlock()
+
+	if !res.Requeue {
+		return res, err
+	}
+	switch reason {
+	case radosgw.ReasonThrottled:
+		return reconcile.Result{RequeueAfter: throttledRequeueAfter}, err
+	case radosgw.ReasonUnauthorized:
+		return reconcile.Result{RequeueAfter: r.unauthorizedRequeueAfter}, err
+	}
+	return res, err
+}
+
+// record why radosgw failed a request for the named CephUser, and return the
+// error describing why.
+func (r *requeuer) record(name string, err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	reason := radosgw.Classify(err)
+	if r != nil {
+		r.mu.Lock()
+		r.reasons[name] = reason
+		r.mu.Unlock()
+	}
+	return errors.Wrapf(err, "%s (%s)", msg, reason)
+}
+
+// radosgwUnavailable returns a Ready condition indicating that the state of a
+// CephUser is unknown, because radosgw failed to answer why.
+func radosgwUnavailable(err error) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               xpv1.TypeReady,
+		Status:             corev1.ConditionUnknown,
+		LastTransitionTime: metav1.Now(),
+		Reason:             xpv1.ConditionReason(radosgw.Classify(err)),
+		Message:            err.Error(),
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephuser
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+func TestRequeuer(t *testing.T) {
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "user"}}
+
+	cases := map[string]struct {
+		reason string
+		result reconcile.Result
+		err    error
+		want   reconcile.Result
+	}{
+		"Throttled": {
+			reason: "Throttled requests should be retried after a fixed delay.",
+			result: reconcile.Result{Requeue: true},
+			err:    &radosgw.StatusError{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"},
+			want:   reconcile.Result{RequeueAfter: throttledRequeueAfter},
+		},
+		"Unauthorized": {
+			reason: "Rejected credentials should be retried at the poll interval.",
+			result: reconcile.Result{Requeue: true},
+			err:    &radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "AccessDenied"},
+			want:   reconcile.Result{RequeueAfter: time.Minute},
+		},
+		"Unavailable": {
+			reason: "Transient errors should keep the exponential backoff.",
+			result: reconcile.Result{Requeue: true},
+			err:    &radosgw.StatusError{StatusCode: http.StatusInternalServerError},
+			want:   reconcile.Result{Requeue: true},
+		},
+		"NotRequeued": {
+			reason: "Results that are not requeued should be left alone.",
+			result: reconcile.Result{RequeueAfter: time.Hour},
+			err:    &radosgw.StatusError{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown"},
+			want:   reconcile.Result{RequeueAfter: time.Hour},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var r *requeuer
+			r = newRequeuer(reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) {
+				_ = r.record(req.Name, errors.Wrap(tc.err, "wrapped"), "failed")
+				return tc.result, nil
+			}), time.Minute)
+
+			got, _ := r.Reconcile(context.Background(), req)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nr.Reconcile(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+			if len(r.reasons) != 0 {
+				t.Errorf("\n%s\nr.Reconcile(...): reasons should be forgotten once handled", tc.reason)
+			}
+		})
+	}
+}
@@ -17,19 +17,26 @@ limitations under the License.
 package config
 
 import (
+	"time"
+
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/ratelimiter"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/providerconfig"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+	"github.com/daanvinken/provider-radosgw/internal/clients/vault"
 )
 
 // Setup adds a controller that reconciles ProviderConfigs by accounting for
-// their current usage.
-func Setup(mgr ctrl.Manager, o controller.Options) error {
+// their current usage, checking the health of their radosgw every poll
+// interval, and reporting the circuit the supplied guards break. The admin
+// credentials are read with the supplied Vault clients.
+func Setup(mgr ctrl.Manager, o controller.Options, guards *radosgw.Guards, vaultClients *vault.ClientCache) error {
 	name := providerconfig.ControllerName(v1alpha1.ProviderConfigGroupKind)
 
 	of := resource.ProviderConfigKinds{
@@ -41,10 +48,23 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 		providerconfig.WithLogger(o.Logger.WithValues("controller", name)),
 		providerconfig.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))))
 
+	h := &healthChecker{
+		kube:               mgr.GetClient(),
+		usage:              r,
+		interval:           o.PollInterval,
+		vaultClientFn:      vaultClients.Get,
+		adminVaultConfig:   vault.AdminVaultConfig(),
+		newRadosgwClientFn: radosgw.NewClient,
+		guards:             guards,
+		now:                time.Now,
+		log:                o.Logger.WithValues("controller", name),
+		checked:            map[types.UID]check{},
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o.ForControllerRuntime()).
 		For(&v1alpha1.ProviderConfig{}).
 		Watches(&v1alpha1.ProviderConfigUsage{}, &resource.EnqueueRequestForProviderConfig{}).
-		Complete(ratelimiter.NewReconciler(name, r, o.GlobalRateLimiter))
+		Complete(ratelimiter.NewReconciler(name, h, o.GlobalRateLimiter))
 }
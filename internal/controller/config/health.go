@@ -0,0 +1,209 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	vault_sdk "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cephv1alpha1 "github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+	"github.com/daanvinken/provider-radosgw/internal/controller/cephuser"
+)
+
+const (
+	errGetPC                  = "cannot get ProviderConfig"
+	errUpdateStatus           = "cannot update ProviderConfig status"
+	errCreateAdminVaultClient = "failed to initialize Vault client to retrieve Ceph admin credentials"
+	errGetCreds               = "cannot get Ceph admin credentials from Vault"
+	errNewClient              = "cannot create new radosgw client"
+	errGetInfo                = "cannot get cluster info from radosgw, which requires the info=read capability"
+)
+
+// healthCheckTimeout bounds how long a health check may take, so that a
+// radosgw that does not answer is reported as unreachable.
+const healthCheckTimeout = 30 * time.Second
+
+// circuitReportInterval is how often the circuit of a radosgw is reported
+// between health checks, so that a circuit opened or closed by requests of
+// CephUsers is reflected in the conditions of the ProviderConfig promptly.
+const circuitReportInterval = 10 * time.Second
+
+// A healthChecker reconciles ProviderConfigs by accounting for their usage,
+// then checking the health of their radosgw once per interval: whether its
+// admin credentials can be read and are accepted, and whether it answers the
+// Admin Ops API. The outcome is reported as conditions of the ProviderConfig,
+// as is the circuit of its radosgw, of which the healthChecker is the only
+// writer.
+type healthChecker struct {
+	kube               client.Client
+	usage              reconcile.Reconciler
+	interval           time.Duration
+	vaultClientFn      func(ctx context.Context, config cephv1alpha1.VaultConfig) (*vault_sdk.Client, error)
+	adminVaultConfig   cephv1alpha1.VaultConfig
+	newRadosgwClientFn func(endpoints []string, credentials radosgw.Credentials) (radosgw.Client, error)
+	guards             *radosgw.Guards
+	now                func() time.Time
+	log                logging.Logger
+
+	mu sync.Mutex
+	// checked is when the ProviderConfig with each UID was last checked, and
+	// at what generation. ProviderConfigs are checked again once their spec
+	// changed, rather than whenever their status is updated.
+	checked map[types.UID]check
+}
+
+type check struct {
+	at         time.Time
+	generation int64
+}
+
+// Reconcile accounts for the usage of a ProviderConfig, checks the health of
+// its radosgw when due, and reports its circuit when it changed.
+func (h *healthChecker) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	res, err := h.usage.Reconcile(ctx, req)
+	if err != nil {
+		return res, err
+	}
+
+	pc := &v1alpha1.ProviderConfig{}
+	if err := h.kube.Get(ctx, req.NamespacedName, pc); err != nil {
+		return res, errors.Wrap(client.IgnoreNotFound(err), errGetPC)
+	}
+	if pc.GetDeletionTimestamp() != nil {
+		return res, nil
+	}
+
+	wait := h.due(pc)
+	if wait > 0 {
+		if h.reportCircuit(pc) {
+			if err := h.kube.Status().Update(ctx, pc); err != nil {
+				return res, errors.Wrap(err, errUpdateStatus)
+			}
+		}
+		return requeueAfter(requeueAfter(res, wait), circuitReportInterval), nil
+	}
+
+	h.check(ctx, pc)
+	h.reportCircuit(pc)
+	if err := h.kube.Status().Update(ctx, pc); err != nil {
+		return res, errors.Wrap(err, errUpdateStatus)
+	}
+
+	h.mu.Lock()
+	h.checked[pc.GetUID()] = check{at: h.now(), generation: pc.GetGeneration()}
+	h.mu.Unlock()
+	return requeueAfter(requeueAfter(res, h.interval), circuitReportInterval), nil
+}
+
+// reportCircuit sets the CircuitClosed condition of the supplied ProviderConfig
+// from the breaker of its radosgw, and returns whether its status or reason
+// changed. Changes to only its message, such as the count of failures, are not
+// worth a status update of their own.
+func (h *healthChecker) reportCircuit(pc *v1alpha1.ProviderConfig) bool {
+	c := v1alpha1.CircuitClosed()
+	if open, msg := h.guards.Breaker(pc).Open(); open {
+		c = v1alpha1.CircuitOpen(msg)
+	}
+	was := pc.GetCondition(v1alpha1.TypeCircuitClosed)
+	pc.SetConditions(c)
+	return was.Status != c.Status || was.Reason != c.Reason
+}
+
+// due returns how long until the supplied ProviderConfig is due to be
+// checked, or zero if it is due now.
+func (h *healthChecker) due(pc *v1alpha1.ProviderConfig) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.checked[pc.GetUID()]
+	if !ok || c.generation != pc.GetGeneration() {
+		return 0
+	}
+	if wait := h.interval - h.now().Sub(c.at); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// check the health of the radosgw of the supplied ProviderConfig, and set its
+// conditions accordingly.
+func (h *healthChecker) check(ctx context.Context, pc *v1alpha1.ProviderConfig) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	// radosgw is not asked without admin credentials, so whether it answers
+	// is unknown.
+	vaultClient, err := h.vaultClientFn(ctx, h.adminVaultConfig)
+	if err != nil {
+		msg := errors.Wrap(err, errCreateAdminVaultClient).Error()
+		pc.SetConditions(v1alpha1.ReachabilityUnknown(msg), v1alpha1.MissingCredentials(msg))
+		return
+	}
+	creds, err := cephuser.GetAdminCredentials(vaultClient, pc)
+	if err != nil {
+		msg := errors.Wrap(err, errGetCreds).Error()
+		pc.SetConditions(v1alpha1.ReachabilityUnknown(msg), v1alpha1.MissingCredentials(msg))
+		return
+	}
+	rgw, err := h.newRadosgwClientFn(radosgw.Endpoints(pc), creds)
+	if err != nil {
+		msg := errors.Wrap(err, errNewClient).Error()
+		pc.SetConditions(v1alpha1.Unreachable(msg), v1alpha1.AuthenticationUnknown(msg))
+		return
+	}
+
+	info, err := rgw.GetInfo(ctx)
+	switch {
+	case err == nil:
+		pc.SetConditions(v1alpha1.Reachable(), v1alpha1.Authenticated())
+		pc.Status.FSID = info.FSID()
+		now := metav1.NewTime(h.now())
+		pc.Status.LastSuccessfulCheck = &now
+	case radosgw.IsAccessDenied(err):
+		// radosgw accepted the admin credentials, but they lack the
+		// info=read capability.
+		pc.SetConditions(v1alpha1.Reachable(), v1alpha1.MissingCapability(errors.Wrap(err, errGetInfo).Error()))
+	case radosgw.IsUnauthorized(err):
+		// radosgw answered, but refused the admin credentials.
+		pc.SetConditions(v1alpha1.Reachable(), v1alpha1.Unauthenticated(errors.Wrap(err, errGetInfo).Error()))
+	default:
+		// Whether the admin credentials are accepted is unknown until
+		// radosgw answers again.
+		msg := errors.Wrap(err, errGetInfo).Error()
+		pc.SetConditions(v1alpha1.Unreachable(msg), v1alpha1.AuthenticationUnknown(msg))
+	}
+	h.log.Debug("Checked health of radosgw", "providerconfig", pc.GetName(), "error", err)
+}
+
+// requeueAfter returns the supplied result, requeued after the supplied
+// duration at the latest.
+func requeueAfter(res reconcile.Result, after time.Duration) reconcile.Result {
+	if res.RequeueAfter == 0 || after < res.RequeueAfter {
+		res.RequeueAfter = after
+	}
+	return res
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	vault_sdk "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cephv1alpha1 "github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw/fake"
+)
+
+func TestHealthChecker(t *testing.T) {
+	errBoom := errors.New("boom")
+	now := time.Now()
+
+	// adminVault serves the radosgw admin credentials of every ProviderConfig.
+	adminVault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"access_key": "AK", "secret_key": "SK"}})
+	}))
+	defer adminVault.Close()
+	vaultClient := func(context.Context, cephv1alpha1.VaultConfig) (*vault_sdk.Client, error) {
+		cfg := vault_sdk.DefaultConfig()
+		cfg.Address = adminVault.URL
+		return vault_sdk.NewClient(cfg)
+	}
+
+	// rgw returns an in-memory radosgw whose GetInfo fails with the supplied
+	// error.
+	rgw := func(err error) func([]string, radosgw.Credentials) (radosgw.Client, error) {
+		return func([]string, radosgw.Credentials) (radosgw.Client, error) {
+			c := fake.NewClient()
+			if err != nil {
+				c.Errors[fake.MethodGetInfo] = err
+			}
+			return c, nil
+		}
+	}
+
+	// open returns guards under which the circuit of the radosgw of the
+	// ProviderConfig is open, and the message it is reported with.
+	open := func() (*radosgw.Guards, string) {
+		g := radosgw.NewGuards()
+		pc := &v1alpha1.ProviderConfig{}
+		pc.SetUID("pc")
+		c := fake.NewClient()
+		c.Errors[fake.MethodGetInfo] = &radosgw.StatusError{StatusCode: http.StatusServiceUnavailable}
+		_, _ = g.Client(pc, c).GetInfo(context.Background())
+		_, msg := g.Breaker(pc).Open()
+		return g, msg
+	}
+	openGuards, openMsg := open()
+
+	type fields struct {
+		vaultClientFn      func(ctx context.Context, config cephv1alpha1.VaultConfig) (*vault_sdk.Client, error)
+		newRadosgwClientFn func(endpoints []string, credentials radosgw.Credentials) (radosgw.Client, error)
+		guards             *radosgw.Guards
+		checked            map[types.UID]check
+	}
+
+	type want struct {
+		result reconcile.Result
+		status *v1alpha1.ProviderConfigStatus
+	}
+
+	cases := map[string]struct {
+		reason string
+		fields fields
+		want   want
+	}{
+		"Healthy": {
+			reason: "A radosgw that answers with the admin credentials should be reachable and authenticated.",
+			fields: fields{vaultClientFn: vaultClient, newRadosgwClientFn: rgw(nil), checked: map[types.UID]check{}},
+			want: want{
+				result: reconcile.Result{RequeueAfter: circuitReportInterval},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{v1alpha1.Reachable(), v1alpha1.Authenticated(), v1alpha1.CircuitClosed()}}},
+					FSID:                 fake.FSID,
+				},
+			},
+		},
+		"Rejected": {
+			reason: "A radosgw that rejects the admin credentials should be reachable but not authenticated.",
+			fields: fields{
+				vaultClientFn:      vaultClient,
+				newRadosgwClientFn: rgw(&radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "InvalidAccessKeyId"}),
+				checked:            map[types.UID]check{},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: circuitReportInterval},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{
+						v1alpha1.Reachable(),
+						v1alpha1.Unauthenticated(errors.Wrap(&radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "InvalidAccessKeyId"}, errGetInfo).Error()),
+						v1alpha1.CircuitClosed(),
+					}}},
+				},
+			},
+		},
+		"MissingCapability": {
+			reason: "A radosgw that denies the admin credentials the info=read capability should be reachable and authenticated, but report the missing capability.",
+			fields: fields{
+				vaultClientFn:      vaultClient,
+				newRadosgwClientFn: rgw(&radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "AccessDenied"}),
+				checked:            map[types.UID]check{},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: circuitReportInterval},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{
+						v1alpha1.Reachable(),
+						v1alpha1.MissingCapability(errors.Wrap(&radosgw.StatusError{StatusCode: http.StatusForbidden, Code: "AccessDenied"}, errGetInfo).Error()),
+						v1alpha1.CircuitClosed(),
+					}}},
+				},
+			},
+		},
+		"Unreachable": {
+			reason: "A radosgw that does not answer should be unreachable, and whether it accepts the admin credentials unknown.",
+			fields: fields{
+				vaultClientFn:      vaultClient,
+				newRadosgwClientFn: rgw(&net.OpError{Op: "dial", Err: errBoom}),
+				checked:            map[types.UID]check{},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: circuitReportInterval},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{
+						v1alpha1.Unreachable(errors.Wrap(&net.OpError{Op: "dial", Err: errBoom}, errGetInfo).Error()),
+						v1alpha1.AuthenticationUnknown(errors.Wrap(&net.OpError{Op: "dial", Err: errBoom}, errGetInfo).Error()),
+						v1alpha1.CircuitClosed(),
+					}}},
+				},
+			},
+		},
+		"MissingCredentials": {
+			reason: "Admin credentials that cannot be read should not be authenticated, nor tell whether radosgw is reachable.",
+			fields: fields{
+				vaultClientFn: func(context.Context, cephv1alpha1.VaultConfig) (*vault_sdk.Client, error) { return nil, errBoom },
+				checked:       map[types.UID]check{},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: circuitReportInterval},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{
+						v1alpha1.ReachabilityUnknown(errors.Wrap(errBoom, errCreateAdminVaultClient).Error()),
+						v1alpha1.MissingCredentials(errors.Wrap(errBoom, errCreateAdminVaultClient).Error()),
+						v1alpha1.CircuitClosed(),
+					}}},
+				},
+			},
+		},
+		"NotDue": {
+			reason: "A ProviderConfig that was checked less than an interval ago should not be checked again, but its circuit should be reported.",
+			fields: fields{checked: map[types.UID]check{"pc": {at: now.Add(-20 * time.Second), generation: 1}}},
+			want: want{
+				result: reconcile.Result{RequeueAfter: circuitReportInterval},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{v1alpha1.CircuitClosed()}}},
+				},
+			},
+		},
+		"NotDueAlmost": {
+			reason: "A ProviderConfig that is due to be checked sooner than its circuit is reported again should be requeued when it is due.",
+			fields: fields{checked: map[types.UID]check{"pc": {at: now.Add(-55 * time.Second), generation: 1}}},
+			want: want{
+				result: reconcile.Result{RequeueAfter: 5 * time.Second},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{v1alpha1.CircuitClosed()}}},
+				},
+			},
+		},
+		"CircuitOpen": {
+			reason: "A ProviderConfig whose radosgw failed requests of CephUsers should report its circuit is open.",
+			fields: fields{
+				vaultClientFn:      vaultClient,
+				newRadosgwClientFn: rgw(nil),
+				guards:             openGuards,
+				checked:            map[types.UID]check{},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: circuitReportInterval},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{
+						v1alpha1.Reachable(),
+						v1alpha1.Authenticated(),
+						v1alpha1.CircuitOpen(openMsg),
+					}}},
+					FSID: fake.FSID,
+				},
+			},
+		},
+		"SpecChanged": {
+			reason: "A ProviderConfig whose spec changed since it was checked should be checked again.",
+			fields: fields{
+				vaultClientFn:      vaultClient,
+				newRadosgwClientFn: rgw(nil),
+				checked:            map[types.UID]check{"pc": {at: now.Add(-20 * time.Second), generation: 0}},
+			},
+			want: want{
+				result: reconcile.Result{RequeueAfter: circuitReportInterval},
+				status: &v1alpha1.ProviderConfigStatus{
+					ProviderConfigStatus: xpv1.ProviderConfigStatus{ConditionedStatus: xpv1.ConditionedStatus{Conditions: []xpv1.Condition{v1alpha1.Reachable(), v1alpha1.Authenticated(), v1alpha1.CircuitClosed()}}},
+					FSID:                 fake.FSID,
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var status *v1alpha1.ProviderConfigStatus
+			guards := tc.fields.guards
+			if guards == nil {
+				guards = radosgw.NewGuards()
+			}
+			h := &healthChecker{
+				kube: &test.MockClient{
+					MockGet: func(_ context.Context, _ client.ObjectKey, obj client.Object) error {
+						pc := obj.(*v1alpha1.ProviderConfig)
+						pc.SetUID("pc")
+						pc.SetGeneration(1)
+						return nil
+					},
+					MockStatusUpdate: func(_ context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+						status = obj.(*v1alpha1.ProviderConfig).Status.DeepCopy()
+						return nil
+					},
+				},
+				usage:              reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) { return reconcile.Result{}, nil }),
+				interval:           time.Minute,
+				vaultClientFn:      tc.fields.vaultClientFn,
+				newRadosgwClientFn: tc.fields.newRadosgwClientFn,
+				guards:             guards,
+				now:                func() time.Time { return now },
+				log:                logging.NewNopLogger(),
+				checked:            tc.fields.checked,
+			}
+
+			got, err := h.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "ceph-cl01"}})
+			if err != nil {
+				t.Fatalf("\n%s\nh.Reconcile(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.result, got); diff != "" {
+				t.Errorf("\n%s\nh.Reconcile(...): -want result, +got result:\n%s\n", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.status, status, test.EquateConditions(), cmpopts.IgnoreFields(v1alpha1.ProviderConfigStatus{}, "LastSuccessfulCheck")); diff != "" {
+				t.Errorf("\n%s\nh.Reconcile(...): -want status, +got status:\n%s\n", tc.reason, diff)
+			}
+			if tc.want.status != nil && tc.want.status.FSID != "" && status.LastSuccessfulCheck == nil {
+				t.Errorf("\n%s\nh.Reconcile(...): want last successful check, got none", tc.reason)
+			}
+		})
+	}
+}
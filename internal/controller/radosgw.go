@@ -19,19 +19,42 @@ package controller
 import (
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
 	"github.com/daanvinken/provider-radosgw/internal/controller/cephuser"
+	"github.com/pkg/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+	"github.com/daanvinken/provider-radosgw/internal/clients/vault"
 	"github.com/daanvinken/provider-radosgw/internal/controller/config"
 )
 
+const errNewVaultKubeClient = "cannot create Kubernetes client for Vault logins"
+
 // Setup creates all radosgw controllers with the supplied logger and adds them to
 // the supplied manager.
 func Setup(mgr ctrl.Manager, o controller.Options) error {
-	for _, setup := range []func(ctrl.Manager, controller.Options) error{
+	// The CephUser controller breaks the circuit of a radosgw, which the
+	// ProviderConfig controller reports.
+	guards := radosgw.NewGuards()
+
+	// Both controllers read the admin credentials from Vault, and share the
+	// clients they log in with. The cache of the manager is not started yet,
+	// and would watch every Secret of the cluster, so Vault logins read from
+	// the API server directly. Vault clients log in when they are first
+	// needed, so the provider starts while Vault is down. Failed logins
+	// surface on the resources that needed them and are retried when those
+	// are requeued.
+	kube, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return errors.Wrap(err, errNewVaultKubeClient)
+	}
+	vaultClients := vault.NewClientCache(kube, o.Logger.WithValues("component", "vault"))
+
+	for _, setup := range []func(ctrl.Manager, controller.Options, *radosgw.Guards, *vault.ClientCache) error{
 		config.Setup,
 		cephuser.Setup,
 	} {
-		if err := setup(mgr, o); err != nil {
+		if err := setup(mgr, o, guards, vaultClients); err != nil {
 			return err
 		}
 	}
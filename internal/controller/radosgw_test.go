@@ -0,0 +1,643 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/controller"
+	"github.com/crossplane/crossplane-runtime/pkg/feature"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/ratelimiter"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/daanvinken/provider-radosgw/apis"
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw/fake"
+	radosgwwebhook "github.com/daanvinken/provider-radosgw/internal/webhook"
+)
+
+// The tests in this file run the controllers against the API server and etcd
+// binaries of controller-runtime's envtest, a fake radosgw and a stand-in for
+// a Vault dev server. They are skipped unless KUBEBUILDER_ASSETS points at the
+// binaries, which 'make test-envtest' takes care of.
+
+const (
+	providerConfigName = "ceph-envtest"
+
+	adminAccessKey = "ADMIN"
+	adminSecretKey = "secret"
+
+	// The admin credentials are read from this KV v1 mount and path.
+	adminMount = "k8s-cl03"
+	adminPath  = "crossplane/ceph/admin-credentials/" + providerConfigName
+
+	// CephUser credentials are written to this KV v2 mount, at
+	// 'users/envtest/users/<uid>'.
+	userMount = "secret"
+
+	// The managed reconciler does not trust that a user is gone until this
+	// long after it was created, so deleting one takes at least as long.
+	creationGracePeriod = 30 * time.Second
+
+	timeout  = time.Minute
+	interval = 100 * time.Millisecond
+)
+
+var (
+	kube    client.Client
+	rgw     *fake.Client
+	vaultKV *vaultServer
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		os.Exit(m.Run())
+	}
+
+	stop, err := start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot start envtest: %v\n", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// start starts the API server, radosgw, Vault and the controllers, and returns
+// a function that stops them again.
+func start() (func(), error) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		return nil, err
+	}
+	if err := apis.AddToScheme(s); err != nil {
+		return nil, err
+	}
+
+	// Registering the convertible CephUser types in the scheme points the
+	// conversion webhook of its CRD at the webhook server of the manager.
+	env := &envtest.Environment{
+		Scheme:                s,
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "package", "crds")},
+		CRDInstallOptions:     envtest.CRDInstallOptions{Scheme: s},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	rgw = fake.NewClient()
+	if err := rgw.AddAdmin("admin", adminAccessKey, adminSecretKey); err != nil {
+		return nil, err
+	}
+	rgwServer := httptest.NewServer(fake.NewServer(rgw))
+
+	vaultKV = newVaultServer()
+	vaultKV.kv1[adminMount+"/"+adminPath] = map[string]interface{}{"access_key": adminAccessKey, "secret_key": adminSecretKey}
+	vaultServer := httptest.NewServer(vaultKV)
+
+	// Vault clients skip logging in when both are set, like against a Vault
+	// dev server.
+	os.Setenv("VAULT_ADDR", vaultServer.URL) //nolint:errcheck
+	os.Setenv("VAULT_TOKEN", "root")         //nolint:errcheck
+
+	wo := env.WebhookInstallOptions
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             s,
+		MetricsBindAddress: "0",
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Host:    wo.LocalServingHost,
+			Port:    wo.LocalServingPort,
+			CertDir: wo.LocalServingCertDir,
+		}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	o := controller.Options{
+		Logger:                  logging.NewNopLogger(),
+		MaxConcurrentReconciles: 1,
+		PollInterval:            time.Second,
+		GlobalRateLimiter:       ratelimiter.NewGlobal(100),
+		Features:                &feature.Flags{},
+	}
+	if err := Setup(mgr, o); err != nil {
+		return nil, err
+	}
+	if err := radosgwwebhook.Setup(mgr); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- mgr.Start(ctx) }()
+
+	kube, err = client.New(cfg, client.Options{Scheme: s})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	pc := &apisv1alpha1.ProviderConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: providerConfigName},
+		Spec: apisv1alpha1.ProviderConfigSpec{
+			HostName: rgwServer.URL,
+		},
+	}
+	if err := kube.Create(ctx, pc); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return func() {
+		cancel()
+		<-done
+		rgwServer.Close()
+		vaultServer.Close()
+		env.Stop() //nolint:errcheck
+	}, nil
+}
+
+// requireEnvtest skips the calling test unless envtest was started.
+func requireEnvtest(t *testing.T) {
+	t.Helper()
+	if kube == nil {
+		t.Skip("KUBEBUILDER_ASSETS is not set, run 'make test-envtest' to run the envtest suite")
+	}
+}
+
+// eventually polls the supplied condition until it returns true, failing the
+// test if it does not in time.
+func eventually(t *testing.T, reason string, condition func(ctx context.Context) (bool, error)) {
+	t.Helper()
+	if err := wait.PollUntilContextTimeout(context.Background(), interval, timeout, true, condition); err != nil {
+		t.Fatalf("%s: %v", reason, err)
+	}
+}
+
+func newCephUser(name string) *v1alpha1.CephUser {
+	uid := name
+	maxObjects := int64(100)
+	return &v1alpha1.CephUser{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1alpha1.CephUserSpec{
+			ResourceSpec: xpv1.ResourceSpec{
+				ProviderConfigReference: &xpv1.Reference{Name: providerConfigName},
+			},
+			ForProvider: v1alpha1.CephUserParameters{
+				UID:                 &uid,
+				DisplayedName:       &uid,
+				UserQuotaMaxObjects: &maxObjects,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{
+					KVVersion:          "2",
+					Address:            "http://vault.invalid",
+					Name:               "vault",
+					ServiceAccountName: "provider-radosgw",
+					MountPath:          userMount,
+					SecretPath:         "users",
+				},
+			},
+		},
+	}
+}
+
+// userSecretPath is where the credentials of the named CephUser are written.
+func userSecretPath(name string) string {
+	return userMount + "/users/envtest/users/" + name
+}
+
+func getCephUser(ctx context.Context, name string) (*v1alpha1.CephUser, error) {
+	cr := &v1alpha1.CephUser{}
+	return cr, kube.Get(ctx, types.NamespacedName{Name: name}, cr)
+}
+
+// createCephUser creates a CephUser and waits for it to become ready.
+func createCephUser(t *testing.T, name string) *v1alpha1.CephUser {
+	t.Helper()
+	if err := kube.Create(context.Background(), newCephUser(name)); err != nil {
+		t.Fatal(err)
+	}
+	var cr *v1alpha1.CephUser
+	eventually(t, "CephUser did not become ready", func(ctx context.Context) (bool, error) {
+		var err error
+		cr, err = getCephUser(ctx, name)
+		return err == nil && cr.GetCondition(xpv1.TypeReady).Status == corev1.ConditionTrue, err
+	})
+	return cr
+}
+
+// deleteCephUser deletes a CephUser and waits for it to be gone.
+func deleteCephUser(t *testing.T, name string) {
+	t.Helper()
+	cr, err := getCephUser(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kube.Delete(context.Background(), cr); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "CephUser was not deleted", func(ctx context.Context) (bool, error) {
+		_, err := getCephUser(ctx, name)
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+func TestCephUserCreate(t *testing.T) {
+	requireEnvtest(t)
+	const name = "create"
+
+	cr := createCephUser(t, name)
+	t.Cleanup(func() { deleteCephUser(t, name) })
+
+	if !meta.FinalizerExists(cr, "cephuser-in-use.ceph.radosgw.crossplane.io") {
+		t.Errorf("CephUser should have the in-use finalizer, got %v", cr.GetFinalizers())
+	}
+	u, err := rgw.GetUserInfo(context.Background(), name)
+	if err != nil {
+		t.Fatalf("radosgw should have the user: %v", err)
+	}
+	if len(u.Keys) == 0 {
+		t.Fatalf("radosgw user should have a key")
+	}
+
+	data := vaultKV.get(userSecretPath(name))
+	if data["access_key"] != u.Keys[0].AccessKey || data["secret_key"] != u.Keys[0].SecretKey {
+		t.Errorf("Vault should have the keys of the user, got %v", data)
+	}
+	c := cr.Status.AtProvider.Credentials
+	if c == nil || c.AccessKeyID != u.Keys[0].AccessKey || c.Vault == nil || c.Vault.Path != "users/envtest/users/"+name {
+		t.Errorf("CephUser status should record the written credentials, got %+v", c)
+	}
+}
+
+func TestCephUserUpdateQuota(t *testing.T) {
+	requireEnvtest(t)
+	const name = "update-quota"
+
+	createCephUser(t, name)
+	t.Cleanup(func() { deleteCephUser(t, name) })
+
+	cr, err := getCephUser(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxObjects := int64(500)
+	cr.Spec.ForProvider.UserQuotaMaxObjects = &maxObjects
+	if err := kube.Update(context.Background(), cr); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "radosgw user quota was not updated", func(ctx context.Context) (bool, error) {
+		q, err := rgw.GetUserQuota(ctx, name)
+		return err == nil && q.MaxObjects != nil && *q.MaxObjects == maxObjects, err
+	})
+}
+
+// Credentials that were removed from Vault must be written again.
+func TestCephUserVaultRepair(t *testing.T) {
+	requireEnvtest(t)
+	const name = "vault-repair"
+
+	cr := createCephUser(t, name)
+	t.Cleanup(func() { deleteCephUser(t, name) })
+	written := cr.Status.AtProvider.Credentials.AccessKeyID
+
+	vaultKV.remove(userSecretPath(name))
+
+	eventually(t, "Vault credentials were not written again", func(context.Context) (bool, error) {
+		data := vaultKV.get(userSecretPath(name))
+		return data != nil && data["access_key"] == written, nil
+	})
+}
+
+// A key that was removed from radosgw, e.g. because it was revoked, must be
+// replaced by a new one that is written to Vault and recorded.
+func TestCephUserKeyRotation(t *testing.T) {
+	requireEnvtest(t)
+	const name = "key-rotation"
+
+	cr := createCephUser(t, name)
+	t.Cleanup(func() { deleteCephUser(t, name) })
+	revoked := cr.Status.AtProvider.Credentials.AccessKeyID
+
+	if err := rgw.RemoveKey(context.Background(), radosgw_admin.UserKeySpec{UID: name, AccessKey: revoked, KeyType: "s3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "CephUser key was not rotated", func(ctx context.Context) (bool, error) {
+		cr, err := getCephUser(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		c := cr.Status.AtProvider.Credentials
+		if c == nil || c.AccessKeyID == revoked {
+			return false, nil
+		}
+		u, err := rgw.GetUserInfo(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		data := vaultKV.get(userSecretPath(name))
+		for _, k := range u.Keys {
+			if k.AccessKey == c.AccessKeyID {
+				return data["access_key"] == k.AccessKey && data["secret_key"] == k.SecretKey, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+func TestProviderConfigHealth(t *testing.T) {
+	requireEnvtest(t)
+
+	eventually(t, "ProviderConfig health was not reported", func(ctx context.Context) (bool, error) {
+		pc := &apisv1alpha1.ProviderConfig{}
+		if err := kube.Get(ctx, types.NamespacedName{Name: providerConfigName}, pc); err != nil {
+			return false, err
+		}
+		return pc.GetCondition(apisv1alpha1.TypeReachable).Status == corev1.ConditionTrue &&
+			pc.GetCondition(apisv1alpha1.TypeAuthenticated).Status == corev1.ConditionTrue &&
+			pc.Status.FSID == fake.FSID && pc.Status.LastSuccessfulCheck != nil, nil
+	})
+}
+
+// The in-use finalizer must only be removed, and the user only be deleted,
+// once the user owns no buckets anymore.
+func TestCephUserDeleteWithBuckets(t *testing.T) {
+	requireEnvtest(t)
+	const name = "delete-with-buckets"
+
+	createCephUser(t, name)
+	rgw.AddBucket(name, name)
+
+	cr, err := getCephUser(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kube.Delete(context.Background(), cr); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "CephUser deletion was not blocked by its buckets", func(ctx context.Context) (bool, error) {
+		cr, err := getCephUser(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		c := cr.GetCondition(xpv1.TypeSynced)
+		return c.Status == corev1.ConditionFalse && strings.Contains(c.Message, "ceph user still owns buckets"), nil
+	})
+	cr, err = getCephUser(context.Background(), name)
+	if err != nil {
+		t.Fatalf("CephUser should not be deleted while its user owns buckets: %v", err)
+	}
+	if !meta.FinalizerExists(cr, "cephuser-in-use.ceph.radosgw.crossplane.io") {
+		t.Errorf("CephUser should keep the in-use finalizer while its user owns buckets, got %v", cr.GetFinalizers())
+	}
+	if _, err := rgw.GetUserInfo(context.Background(), name); err != nil {
+		t.Errorf("radosgw user should not be removed while it owns buckets: %v", err)
+	}
+	if vaultKV.get(userSecretPath(name)) == nil {
+		t.Errorf("Vault credentials should not be removed while the user owns buckets")
+	}
+
+	if err := rgw.RemoveBucket(context.Background(), name, false); err != nil {
+		t.Fatal(err)
+	}
+	// Touch the CephUser rather than waiting for its backoff to expire, which
+	// grows while the managed reconciler waits for the creation grace period
+	// to pass once the user is gone.
+	time.Sleep(time.Until(meta.GetExternalCreateSucceeded(cr).Add(creationGracePeriod)))
+	cr, err = getCephUser(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.AddAnnotations(cr, map[string]string{"envtest": "buckets-removed"})
+	if err := kube.Update(context.Background(), cr); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "CephUser was not deleted", func(ctx context.Context) (bool, error) {
+		_, err := getCephUser(ctx, name)
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if _, err := rgw.GetUserInfo(context.Background(), name); err == nil {
+		t.Errorf("radosgw user should be removed")
+	}
+	if data := vaultKV.get(userSecretPath(name)); data != nil {
+		t.Errorf("Vault credentials should be removed, got %v", data)
+	}
+}
+
+// A vaultServer stands in for a Vault dev server. It serves the KV v1 and v2
+// secrets engines as far as the provider uses them, and does not check tokens.
+type vaultServer struct {
+	mu  sync.Mutex
+	kv1 map[string]map[string]interface{}
+	kv2 map[string]*kv2Secret
+}
+
+type kv2Secret struct {
+	versions []map[string]interface{}
+	// deleted is true if the current version was deleted.
+	deleted bool
+	custom  map[string]interface{}
+}
+
+func newVaultServer() *vaultServer {
+	return &vaultServer{kv1: map[string]map[string]interface{}{}, kv2: map[string]*kv2Secret{}}
+}
+
+// get returns the current data of the KV v2 secret at the supplied path,
+// including its mount, or nil if there is none.
+func (v *vaultServer) get(path string) map[string]interface{} {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	mount, p, _ := strings.Cut(path, "/")
+	s, ok := v.kv2[mount+"/"+p]
+	if !ok || s.deleted {
+		return nil
+	}
+	return s.versions[len(s.versions)-1]
+}
+
+// remove deletes the current version of the KV v2 secret at the supplied path,
+// including its mount, like deleting it through the Vault API does.
+func (v *vaultServer) remove(path string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	mount, p, _ := strings.Cut(path, "/")
+	if s, ok := v.kv2[mount+"/"+p]; ok {
+		s.deleted = true
+	}
+}
+
+func (v *vaultServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	mount, p, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	if mount == adminMount {
+		v.serveKV1(w, r, mount+"/"+p)
+		return
+	}
+	switch kind, p, _ := strings.Cut(p, "/"); kind {
+	case "data":
+		v.serveKV2Data(w, r, mount+"/"+p)
+	case "metadata":
+		v.serveKV2Metadata(w, r, mount+"/"+p)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (v *vaultServer) serveKV1(w http.ResponseWriter, r *http.Request, path string) {
+	switch r.Method {
+	case http.MethodGet:
+		d, ok := v.kv1[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeData(w, d)
+	case http.MethodPut, http.MethodPost:
+		d := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.kv1[path] = d
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(v.kv1, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (v *vaultServer) serveKV2Data(w http.ResponseWriter, r *http.Request, path string) {
+	s, ok := v.kv2[path]
+	switch r.Method {
+	case http.MethodGet:
+		if !ok || s.deleted {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeData(w, map[string]interface{}{"data": s.versions[len(s.versions)-1], "metadata": s.version()})
+	case http.MethodPut, http.MethodPost:
+		body := struct {
+			Data map[string]interface{} `json:"data"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			s = &kv2Secret{}
+			v.kv2[path] = s
+		}
+		s.versions = append(s.versions, body.Data)
+		s.deleted = false
+		writeData(w, s.version())
+	case http.MethodDelete:
+		if ok {
+			s.deleted = true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (v *vaultServer) serveKV2Metadata(w http.ResponseWriter, r *http.Request, path string) {
+	s, ok := v.kv2[path]
+	switch r.Method {
+	case http.MethodGet:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeData(w, map[string]interface{}{"current_version": len(s.versions), "custom_metadata": s.custom})
+	case http.MethodPatch:
+		body := struct {
+			CustomMetadata map[string]interface{} `json:"custom_metadata"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if s.custom == nil {
+			s.custom = map[string]interface{}{}
+		}
+		for k, val := range body.CustomMetadata {
+			s.custom[k] = val
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(v.kv2, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// version returns the metadata of the current version of a KV v2 secret.
+func (s *kv2Secret) version() map[string]interface{} {
+	return map[string]interface{}{
+		"version":       len(s.versions),
+		"created_time":  time.Now().UTC().Format(time.RFC3339),
+		"deletion_time": "",
+		"destroyed":     false,
+	}
+}
+
+func writeData(w http.ResponseWriter, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data}) //nolint:errcheck
+}
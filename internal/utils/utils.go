@@ -25,3 +25,44 @@ func GenerateRandomSecret(length int) string {
 	}
 	return string(secret)
 }
+
+// StringValue returns the value the supplied pointer points to, or fallback if
+// it is nil.
+func StringValue(s *string, fallback string) string {
+	if s == nil {
+		return fallback
+	}
+	return *s
+}
+
+// LateInitializeString returns current if it is set, and a pointer to observed
+// otherwise. The returned bool is true if the value was late-initialized, or if
+// li was already true.
+func LateInitializeString(current *string, observed string, li bool) (*string, bool) {
+	if current != nil || observed == "" {
+		return current, li
+	}
+	return &observed, true
+}
+
+// LateInitializeInt returns current if it is set, and observed otherwise. The
+// returned bool is true if the value was late-initialized, or if li was
+// already true.
+func LateInitializeInt(current *int, observed *int, li bool) (*int, bool) {
+	if current != nil || observed == nil {
+		return current, li
+	}
+	v := *observed
+	return &v, true
+}
+
+// LateInitializeInt64 returns current if it is set, and observed otherwise. The
+// returned bool is true if the value was late-initialized, or if li was
+// already true.
+func LateInitializeInt64(current *int64, observed *int64, li bool) (*int64, bool) {
+	if current != nil || observed == nil {
+		return current, li
+	}
+	v := *observed
+	return &v, true
+}
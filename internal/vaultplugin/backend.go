@@ -0,0 +1,101 @@
+// Package vaultplugin implements a Vault secrets engine that issues short-lived
+// radosgw credentials. Each read of a role creates a user or subuser with its
+// own key, which is removed again when the lease expires or is revoked.
+package vaultplugin
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+const backendHelp = `
+The radosgw secrets engine issues short-lived S3 credentials for Ceph radosgw.
+
+After configuring the admin credentials of a cluster at 'config', roles
+describe the users or subusers to create. Reading 'creds/<role>' creates one
+along with a key, which is removed when the lease ends.
+`
+
+const errNotConfigured = "radosgw secrets engine is not configured"
+
+type backend struct {
+	*framework.Backend
+
+	newClientFn func(host string, creds radosgw.Credentials) (radosgw.Client, error)
+
+	lock   sync.RWMutex
+	client radosgw.Client
+}
+
+// Factory returns a configured instance of the radosgw secrets engine.
+func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
+	b := newBackend()
+	if err := b.Setup(ctx, conf); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func newBackend() *backend {
+	b := &backend{newClientFn: radosgw.NewRadosgwClient}
+	b.Backend = &framework.Backend{
+		Help:        strings.TrimSpace(backendHelp),
+		BackendType: logical.TypeLogical,
+		PathsSpecial: &logical.Paths{
+			SealWrapStorage: []string{configPath},
+		},
+		Paths: framework.PathAppend(
+			[]*framework.Path{pathConfig(b), pathCreds(b)},
+			pathRoles(b),
+		),
+		Secrets:    []*framework.Secret{secretCredentials(b)},
+		Invalidate: b.invalidate,
+	}
+	return b
+}
+
+func (b *backend) invalidate(_ context.Context, key string) {
+	if key == configPath {
+		b.reset()
+	}
+}
+
+// reset drops the cached admin client, e.g. after the config changed.
+func (b *backend) reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.client = nil
+}
+
+// getClient returns an admin client for the configured cluster.
+func (b *backend) getClient(ctx context.Context, s logical.Storage) (radosgw.Client, error) {
+	b.lock.RLock()
+	c := b.client
+	b.lock.RUnlock()
+	if c != nil {
+		return c, nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	cfg, err := getConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, errors.New(errNotConfigured)
+	}
+	b.client, err = b.newClientFn(cfg.Endpoint, radosgw.Credentials{AccessKey: cfg.AccessKey, SecretKey: cfg.SecretKey})
+	return b.client, err
+}
@@ -0,0 +1,350 @@
+package vaultplugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// fakeRGW implements the parts of the radosgw Admin Ops API the backend
+// uses, keeping users, subusers and their keys in memory.
+type fakeRGW struct {
+	mu       sync.Mutex
+	users    map[string]map[string]bool
+	keys     map[string][]radosgw_admin.UserKeySpec
+	quotas   map[string]string
+	requests []string
+}
+
+func newFakeRGW() *fakeRGW {
+	return &fakeRGW{
+		users:  map[string]map[string]bool{},
+		keys:   map[string][]radosgw_admin.UserKeySpec{},
+		quotas: map[string]string{},
+	}
+}
+
+func (f *fakeRGW) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+	uid, subuser := q.Get("uid"), q.Get("subuser")
+	_, isKey := q["key"]
+	_, isQuota := q["quota"]
+	f.requests = append(f.requests, r.Method+" "+uid+" "+subuser)
+
+	if _, ok := f.users[uid]; !ok && !(r.Method == http.MethodPut && !isKey && !isQuota && subuser == "") {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"Code": "NoSuchUser"})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPut && isQuota:
+		f.quotas[uid] = q.Get("max-size-kb") + "/" + q.Get("max-objects")
+	case r.Method == http.MethodPut && isKey:
+		f.keys[uid] = append(f.keys[uid], radosgw_admin.UserKeySpec{User: subuser, AccessKey: "AK-" + subuser, SecretKey: "SK-" + subuser})
+		_ = json.NewEncoder(w).Encode(f.keys[uid])
+	case r.Method == http.MethodPut && subuser != "":
+		f.users[uid][subuser] = true
+	case r.Method == http.MethodPut:
+		f.users[uid] = map[string]bool{}
+		f.keys[uid] = []radosgw_admin.UserKeySpec{{User: uid, AccessKey: "AK-" + uid, SecretKey: "SK-" + uid}}
+		_ = json.NewEncoder(w).Encode(radosgw_admin.User{ID: uid, Keys: f.keys[uid]})
+	case r.Method == http.MethodDelete && subuser != "":
+		if !f.users[uid][subuser] {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"Code": "NoSuchSubUser"})
+			return
+		}
+		delete(f.users[uid], subuser)
+		keys := f.keys[uid][:0]
+		for _, k := range f.keys[uid] {
+			if k.User != subuser {
+				keys = append(keys, k)
+			}
+		}
+		f.keys[uid] = keys
+	case r.Method == http.MethodDelete:
+		delete(f.users, uid)
+		delete(f.keys, uid)
+	}
+}
+
+// state returns the users and subusers that currently exist.
+func (f *fakeRGW) state() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := []string{}
+	for u, subusers := range f.users {
+		s = append(s, u)
+		for su := range subusers {
+			s = append(s, su)
+		}
+	}
+	sort.Strings(s)
+	return s
+}
+
+func testBackend(t *testing.T, rgw *fakeRGW) (*backend, logical.Storage) {
+	t.Helper()
+	srv := httptest.NewServer(rgw)
+	t.Cleanup(srv.Close)
+
+	cfg := logical.TestBackendConfig()
+	cfg.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, b.(*backend), cfg.StorageView, "config", map[string]interface{}{
+		"endpoint":   srv.URL,
+		"access_key": "admin",
+		"secret_key": "secret",
+	})
+	return b.(*backend), cfg.StorageView
+}
+
+func request(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+}
+
+func write(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) {
+	t.Helper()
+	resp, err := request(b, s, logical.UpdateOperation, path, data)
+	if err != nil || resp.IsError() {
+		t.Fatalf("write %s: %v %v", path, err, resp)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	b, s := testBackend(t, newFakeRGW())
+
+	resp, err := request(b, s, logical.ReadOperation, "config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp.Data["secret_key"]; ok {
+		t.Errorf("reading the config should not return the secret key")
+	}
+
+	resp, err = request(b, s, logical.UpdateOperation, "config", map[string]interface{}{"endpoint": "rgw.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Errorf("an endpoint without scheme should be rejected")
+	}
+}
+
+func TestRoleValidation(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		data   map[string]interface{}
+		want   string
+	}{
+		"User": {
+			reason: "A user role needs no further configuration.",
+			data:   map[string]interface{}{},
+		},
+		"Subuser": {
+			reason: "A subuser role with a parent should be accepted.",
+			data:   map[string]interface{}{"type": "subuser", "parent_uid": "app", "access": "read"},
+		},
+		"SubuserWithoutParent": {
+			reason: "Subusers cannot be created without a parent.",
+			data:   map[string]interface{}{"type": "subuser"},
+			want:   errMissingParentUID,
+		},
+		"UserWithParent": {
+			reason: "A parent is meaningless for user roles.",
+			data:   map[string]interface{}{"parent_uid": "app"},
+			want:   errUnexpectedParent,
+		},
+		"InvalidAccess": {
+			reason: "Only the access levels radosgw knows should be accepted.",
+			data:   map[string]interface{}{"type": "subuser", "parent_uid": "app", "access": "admin"},
+			want:   errInvalidAccess,
+		},
+		"InvalidQuota": {
+			reason: "Quotas below -1 should be rejected.",
+			data:   map[string]interface{}{"max_objects": -2},
+			want:   errNegativeQuota,
+		},
+		"TTLExceedsMax": {
+			reason: "The default lease cannot exceed the max lease.",
+			data:   map[string]interface{}{"ttl": "2h", "max_ttl": "1h"},
+			want:   errTTLExceedsMax,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b, s := testBackend(t, newFakeRGW())
+			resp, err := request(b, s, logical.CreateOperation, "roles/test", tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if resp.IsError() {
+				got = resp.Error().Error()
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\n-want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	type want struct {
+		uid    string
+		state  []string
+		quotas map[string]string
+	}
+
+	cases := map[string]struct {
+		reason string
+		role   map[string]interface{}
+		setup  func(f *fakeRGW)
+		want   want
+	}{
+		"User": {
+			reason: "Reading credentials of a user role should create a user with the role's quota.",
+			role:   map[string]interface{}{"tenant": "team", "max_size_kb": 1024, "max_objects": 10},
+			want: want{
+				uid:    "team$vault-test-",
+				state:  []string{"team$vault-test-"},
+				quotas: map[string]string{"team$vault-test-": "1024/10"},
+			},
+		},
+		"Subuser": {
+			reason: "Reading credentials of a subuser role should create a subuser of the parent with its own key.",
+			role:   map[string]interface{}{"type": "subuser", "parent_uid": "app", "uid_prefix": "ci"},
+			setup: func(f *fakeRGW) {
+				f.users["app"] = map[string]bool{}
+				f.keys["app"] = []radosgw_admin.UserKeySpec{{User: "app", AccessKey: "AK-app"}}
+			},
+			want: want{
+				uid:    "app:ci-",
+				state:  []string{"app", "app:ci-"},
+				quotas: map[string]string{},
+			},
+		},
+	}
+
+	// Users are suffixed with random characters, which are cut off before
+	// comparing.
+	trimSuffix := func(s string) string {
+		if i := strings.LastIndex(s, "-"); i >= 0 {
+			return s[:i+1]
+		}
+		return s
+	}
+	trim := cmp.Transformer("trim", trimSuffix)
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rgw := newFakeRGW()
+			if tc.setup != nil {
+				tc.setup(rgw)
+			}
+			b, s := testBackend(t, rgw)
+			write(t, b, s, "roles/test", tc.role)
+
+			resp, err := request(b, s, logical.ReadOperation, "creds/test", nil)
+			if err != nil || resp.IsError() {
+				t.Fatalf("\n%s\nunexpected error: %v %v", tc.reason, err, resp)
+			}
+			if resp.Data["access_key"] != "AK-"+resp.Data["uid"].(string) {
+				t.Errorf("\n%s\nreturned the key of another user: %v", tc.reason, resp.Data)
+			}
+
+			quotas := map[string]string{}
+			for u, q := range rgw.quotas {
+				quotas[trimSuffix(u)] = q
+			}
+			got := want{uid: resp.Data["uid"].(string), state: rgw.state(), quotas: quotas}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), trim); diff != "" {
+				t.Errorf("\n%s\n-want, +got:\n%s\n", tc.reason, diff)
+			}
+
+			// Revoking the lease should remove what reading created.
+			_, err = b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.RevokeOperation,
+				Storage:   s,
+				Secret:    resp.Secret,
+			})
+			if err != nil {
+				t.Fatalf("\n%s\nunexpected error revoking: %v", tc.reason, err)
+			}
+			wantState := []string{}
+			if tc.setup != nil {
+				wantState = []string{"app"}
+			}
+			if diff := cmp.Diff(wantState, rgw.state()); diff != "" {
+				t.Errorf("\n%s\nafter revoking -want, +got:\n%s\n", tc.reason, diff)
+			}
+
+			// Revoking again, e.g. after a retry, should succeed.
+			_, err = b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.RevokeOperation,
+				Storage:   s,
+				Secret:    resp.Secret,
+			})
+			if err != nil {
+				t.Errorf("\n%s\nrevoking twice should succeed: %v", tc.reason, err)
+			}
+		})
+	}
+}
+
+func TestRenew(t *testing.T) {
+	b, s := testBackend(t, newFakeRGW())
+	write(t, b, s, "roles/test", map[string]interface{}{"ttl": "1h", "max_ttl": "2h"})
+
+	resp, err := request(b, s, logical.ReadOperation, "creds/test", nil)
+	if err != nil || resp.IsError() {
+		t.Fatalf("unexpected error: %v %v", err, resp)
+	}
+	if resp.Secret.TTL != time.Hour || resp.Secret.MaxTTL != 2*time.Hour {
+		t.Errorf("credentials should be leased for the role's TTLs, got %s and %s", resp.Secret.TTL, resp.Secret.MaxTTL)
+	}
+
+	resp.Secret.IssueTime = time.Now()
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Secret:    resp.Secret,
+	}); err != nil {
+		t.Errorf("renewing should succeed while the role exists: %v", err)
+	}
+
+	if _, err := request(b, s, logical.DeleteOperation, "roles/test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Secret:    resp.Secret,
+	}); err == nil {
+		t.Errorf("renewing should fail once the role was deleted")
+	}
+}
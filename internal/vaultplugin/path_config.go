@@ -0,0 +1,132 @@
+package vaultplugin
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+const (
+	configPath = "config"
+
+	errInvalidEndpoint = "endpoint must be an http or https URL"
+	errMissingAdmin    = "access_key and secret_key are required"
+)
+
+// config holds the admin credentials of the cluster credentials are issued
+// for.
+type config struct {
+	Endpoint  string `json:"endpoint"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: configPath,
+		Fields: map[string]*framework.FieldSchema{
+			"endpoint": {
+				Type:        framework.TypeString,
+				Description: "The URL of the radosgw, e.g. 'https://rgw.example.com'.",
+				Required:    true,
+			},
+			"access_key": {
+				Type:        framework.TypeString,
+				Description: "The access key of a radosgw user with the 'users=*' capability.",
+				Required:    true,
+			},
+			"secret_key": {
+				Type:        framework.TypeString,
+				Description: "The secret key of the admin user.",
+				Required:    true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation:   &framework.PathOperation{Callback: b.pathConfigRead},
+			logical.CreateOperation: &framework.PathOperation{Callback: b.pathConfigWrite},
+			logical.UpdateOperation: &framework.PathOperation{Callback: b.pathConfigWrite},
+			logical.DeleteOperation: &framework.PathOperation{Callback: b.pathConfigDelete},
+		},
+		ExistenceCheck:  b.pathConfigExists,
+		HelpSynopsis:    "Configure the radosgw cluster credentials are issued for.",
+		HelpDescription: "The admin credentials are used to create and remove users and subusers. The secret key is never returned.",
+	}
+}
+
+func getConfig(ctx context.Context, s logical.Storage) (*config, error) {
+	entry, err := s.Get(ctx, configPath)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	cfg := &config{}
+	if err := entry.DecodeJSON(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (b *backend) pathConfigExists(ctx context.Context, req *logical.Request, _ *framework.FieldData) (bool, error) {
+	cfg, err := getConfig(ctx, req.Storage)
+	return cfg != nil, err
+}
+
+func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	cfg, err := getConfig(ctx, req.Storage)
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	return &logical.Response{Data: map[string]interface{}{
+		"endpoint":   cfg.Endpoint,
+		"access_key": cfg.AccessKey,
+	}}, nil
+}
+
+func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	cfg, err := getConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		cfg = &config{}
+	}
+	if v, ok := d.GetOk("endpoint"); ok {
+		cfg.Endpoint = v.(string)
+	}
+	if v, ok := d.GetOk("access_key"); ok {
+		cfg.AccessKey = v.(string)
+	}
+	if v, ok := d.GetOk("secret_key"); ok {
+		cfg.SecretKey = v.(string)
+	}
+
+	if u, err := url.Parse(cfg.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return logical.ErrorResponse(errInvalidEndpoint), nil
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return logical.ErrorResponse(errMissingAdmin), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(configPath, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, errors.Wrap(err, "cannot store config")
+	}
+	b.reset()
+	return nil, nil
+}
+
+func (b *backend) pathConfigDelete(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, configPath); err != nil {
+		return nil, err
+	}
+	b.reset()
+	return nil, nil
+}
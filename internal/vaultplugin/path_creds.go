@@ -0,0 +1,233 @@
+package vaultplugin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+const (
+	secretCredentialsType = "radosgw_credentials"
+
+	errUnknownRole   = "unknown role"
+	errCreateUser    = "cannot create user"
+	errSetQuota      = "cannot set user quota"
+	errCreateSubuser = "cannot create subuser"
+	errCreateKey     = "cannot create key for subuser"
+	errNoKey         = "radosgw did not return a key"
+	errRemoveUser    = "cannot remove user"
+	errRemoveSubuser = "cannot remove subuser"
+	errMissingLease  = "lease is missing internal data"
+)
+
+func pathCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "The role to issue credentials for.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{Callback: b.pathCredsRead},
+		},
+		HelpSynopsis:    "Issue credentials for a role.",
+		HelpDescription: "Creates a user or subuser with a new S3 key, which is removed when the lease ends.",
+	}
+}
+
+func secretCredentials(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: secretCredentialsType,
+		Fields: map[string]*framework.FieldSchema{
+			"access_key": {Type: framework.TypeString, Description: "The S3 access key."},
+			"secret_key": {Type: framework.TypeString, Description: "The S3 secret key."},
+			"uid":        {Type: framework.TypeString, Description: "The user or subuser the key belongs to."},
+		},
+		Renew:  b.secretCredentialsRenew,
+		Revoke: b.secretCredentialsRevoke,
+	}
+}
+
+func (b *backend) pathCredsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	r, err := getRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return logical.ErrorResponse("%s %q", errUnknownRole, name), nil
+	}
+
+	c, err := b.getClient(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix, err := randomSuffix()
+	if err != nil {
+		return nil, err
+	}
+	internal := map[string]interface{}{"role": name}
+
+	var key radosgw_admin.UserKeySpec
+	switch r.Type {
+	case roleTypeSubuser:
+		subuser := r.ParentUID + ":" + r.UIDPrefix + "-" + suffix
+		key, err = createSubuser(ctx, c, r, subuser)
+		internal["uid"] = r.ParentUID
+		internal["subuser"] = subuser
+	default:
+		uid := r.UIDPrefix + "-" + suffix
+		if r.Tenant != "" {
+			uid = r.Tenant + "$" + uid
+		}
+		key, err = createUser(ctx, c, r, uid, req.DisplayName)
+		internal["uid"] = uid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := b.Secret(secretCredentialsType).Response(map[string]interface{}{
+		"access_key": key.AccessKey,
+		"secret_key": key.SecretKey,
+		"uid":        key.User,
+	}, internal)
+	resp.Secret.TTL = r.TTL
+	resp.Secret.MaxTTL = r.MaxTTL
+	return resp, nil
+}
+
+func createUser(ctx context.Context, c radosgw.Client, r *role, uid, displayName string) (radosgw_admin.UserKeySpec, error) {
+	generate := true
+	if displayName == "" {
+		displayName = uid
+	}
+	u, err := c.CreateUser(ctx, radosgw_admin.User{
+		ID:          uid,
+		DisplayName: displayName,
+		MaxBuckets:  r.MaxBuckets,
+		UserCaps:    r.Caps,
+		GenerateKey: &generate,
+	})
+	if err != nil {
+		return radosgw_admin.UserKeySpec{}, errors.Wrap(err, errCreateUser)
+	}
+
+	enabled := true
+	maxSizeKB, maxObjects := r.MaxSizeKB, r.MaxObjects
+	err = c.SetUserQuota(ctx, radosgw_admin.QuotaSpec{
+		QuotaType:  "user",
+		UID:        uid,
+		Enabled:    &enabled,
+		MaxSizeKb:  &maxSizeKB,
+		MaxObjects: &maxObjects,
+	})
+	if err != nil {
+		// Do not leave a user behind that nobody holds a lease for.
+		_ = c.RemoveUser(ctx, radosgw_admin.User{ID: uid})
+		return radosgw_admin.UserKeySpec{}, errors.Wrap(err, errSetQuota)
+	}
+
+	if len(u.Keys) == 0 {
+		_ = c.RemoveUser(ctx, radosgw_admin.User{ID: uid})
+		return radosgw_admin.UserKeySpec{}, errors.New(errNoKey)
+	}
+	key := u.Keys[0]
+	if key.User == "" {
+		key.User = uid
+	}
+	return key, nil
+}
+
+func createSubuser(ctx context.Context, c radosgw.Client, r *role, subuser string) (radosgw_admin.UserKeySpec, error) {
+	parent := radosgw_admin.User{ID: r.ParentUID}
+	spec := radosgw_admin.SubuserSpec{Name: subuser, Access: radosgw_admin.SubuserAccess(r.Access)}
+	if err := c.CreateSubuser(ctx, parent, spec); err != nil {
+		return radosgw_admin.UserKeySpec{}, errors.Wrap(err, errCreateSubuser)
+	}
+
+	generate := true
+	keys, err := c.CreateKey(ctx, radosgw_admin.UserKeySpec{
+		UID:         r.ParentUID,
+		SubUser:     subuser,
+		KeyType:     "s3",
+		GenerateKey: &generate,
+	})
+	if err == nil {
+		// radosgw returns every key of the parent, including those of other
+		// subusers.
+		for _, k := range *keys {
+			if k.User == subuser {
+				return k, nil
+			}
+		}
+		err = errors.New(errNoKey)
+	}
+
+	purge := true
+	_ = c.RemoveSubuser(ctx, parent, radosgw_admin.SubuserSpec{Name: subuser, PurgeKeys: &purge})
+	return radosgw_admin.UserKeySpec{}, errors.Wrap(err, errCreateKey)
+}
+
+func (b *backend) secretCredentialsRenew(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	name, _ := req.Secret.InternalData["role"].(string)
+	r, err := getRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errors.Errorf("%s %q", errUnknownRole, name)
+	}
+
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL = r.TTL
+	resp.Secret.MaxTTL = r.MaxTTL
+	return resp, nil
+}
+
+func (b *backend) secretCredentialsRevoke(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	uid, _ := req.Secret.InternalData["uid"].(string)
+	if uid == "" {
+		return nil, errors.New(errMissingLease)
+	}
+
+	c, err := b.getClient(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users and subusers that are already gone were revoked before.
+	if subuser, _ := req.Secret.InternalData["subuser"].(string); subuser != "" {
+		purge := true
+		err := c.RemoveSubuser(ctx, radosgw_admin.User{ID: uid}, radosgw_admin.SubuserSpec{Name: subuser, PurgeKeys: &purge})
+		if resource.Ignore(radosgw.IsNotFound, err) != nil {
+			return nil, errors.Wrap(err, errRemoveSubuser)
+		}
+		return nil, nil
+	}
+
+	if err := c.RemoveUser(ctx, radosgw_admin.User{ID: uid}); resource.Ignore(radosgw.IsNotFound, err) != nil {
+		return nil, errors.Wrap(err, errRemoveUser)
+	}
+	return nil, nil
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
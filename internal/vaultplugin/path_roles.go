@@ -0,0 +1,265 @@
+package vaultplugin
+
+import (
+	"context"
+	"time"
+
+	radosgw_admin "github.com/ceph/go-ceph/rgw/admin"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+)
+
+const (
+	rolesPrefix = "roles/"
+
+	roleTypeUser    = "user"
+	roleTypeSubuser = "subuser"
+
+	errInvalidRoleType  = "type must be 'user' or 'subuser'"
+	errMissingParentUID = "parent_uid is required for subuser roles"
+	errUnexpectedParent = "parent_uid is only supported by subuser roles"
+	errInvalidAccess    = "access must be one of 'read', 'write', 'readwrite' or 'full'"
+	errNegativeQuota    = "quotas must be -1 (unlimited) or a non-negative number"
+	errTTLExceedsMax    = "ttl must not exceed max_ttl"
+)
+
+// role describes the users or subusers created for credentials. Quotas and
+// caps apply to every user created for the role.
+type role struct {
+	Type       string        `json:"type"`
+	Tenant     string        `json:"tenant,omitempty"`
+	UIDPrefix  string        `json:"uid_prefix,omitempty"`
+	ParentUID  string        `json:"parent_uid,omitempty"`
+	Access     string        `json:"access,omitempty"`
+	MaxBuckets *int          `json:"max_buckets,omitempty"`
+	MaxSizeKB  int           `json:"max_size_kb"`
+	MaxObjects int64         `json:"max_objects"`
+	Caps       string        `json:"caps,omitempty"`
+	TTL        time.Duration `json:"ttl"`
+	MaxTTL     time.Duration `json:"max_ttl"`
+}
+
+func pathRoles(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: rolesPrefix + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "The name of the role.",
+					Required:    true,
+				},
+				"type": {
+					Type:        framework.TypeString,
+					Description: "Whether to create a 'user' or a 'subuser' of parent_uid.",
+					Default:     roleTypeUser,
+				},
+				"tenant": {
+					Type:        framework.TypeString,
+					Description: "The tenant users are created in.",
+				},
+				"uid_prefix": {
+					Type:        framework.TypeString,
+					Description: "The prefix of the uid of created users or subusers. Defaults to 'vault-<role>'.",
+				},
+				"parent_uid": {
+					Type:        framework.TypeString,
+					Description: "The user subusers are created for, as 'tenant$uid' for tenanted users.",
+				},
+				"access": {
+					Type:        framework.TypeString,
+					Description: "The access of created subusers: 'read', 'write', 'readwrite' or 'full'.",
+					Default:     string(radosgw_admin.SubuserAccessFull),
+				},
+				"max_buckets": {
+					Type:        framework.TypeInt,
+					Description: "The max number of buckets of created users. Defaults to that of radosgw.",
+				},
+				"max_size_kb": {
+					Type:        framework.TypeInt,
+					Description: "The max total size of the objects of created users in KB, or -1 for unlimited.",
+					Default:     radosgw.QuotaUnlimited,
+				},
+				"max_objects": {
+					Type:        framework.TypeInt64,
+					Description: "The max number of objects of created users, or -1 for unlimited.",
+					Default:     int64(radosgw.QuotaUnlimited),
+				},
+				"caps": {
+					Type:        framework.TypeString,
+					Description: "The admin capabilities of created users, e.g. 'usage=read;buckets=read'.",
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "The default lease of credentials. Defaults to that of the mount.",
+				},
+				"max_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "The max lease of credentials. Defaults to that of the mount.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation:   &framework.PathOperation{Callback: b.pathRoleRead},
+				logical.CreateOperation: &framework.PathOperation{Callback: b.pathRoleWrite},
+				logical.UpdateOperation: &framework.PathOperation{Callback: b.pathRoleWrite},
+				logical.DeleteOperation: &framework.PathOperation{Callback: b.pathRoleDelete},
+			},
+			ExistenceCheck: b.pathRoleExists,
+			HelpSynopsis:   "Manage the roles credentials can be issued for.",
+		},
+		{
+			Pattern: rolesPrefix + "?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{Callback: b.pathRoleList},
+			},
+			HelpSynopsis: "List the roles credentials can be issued for.",
+		},
+	}
+}
+
+func getRole(ctx context.Context, s logical.Storage, name string) (*role, error) {
+	entry, err := s.Get(ctx, rolesPrefix+name)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	r := &role{}
+	if err := entry.DecodeJSON(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (b *backend) pathRoleExists(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	r, err := getRole(ctx, req.Storage, d.Get("name").(string))
+	return r != nil, err
+}
+
+func (b *backend) pathRoleList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List(ctx, rolesPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	r, err := getRole(ctx, req.Storage, d.Get("name").(string))
+	if err != nil || r == nil {
+		return nil, err
+	}
+	data := map[string]interface{}{
+		"type":        r.Type,
+		"tenant":      r.Tenant,
+		"uid_prefix":  r.UIDPrefix,
+		"parent_uid":  r.ParentUID,
+		"access":      r.Access,
+		"max_size_kb": r.MaxSizeKB,
+		"max_objects": r.MaxObjects,
+		"caps":        r.Caps,
+		"ttl":         int64(r.TTL.Seconds()),
+		"max_ttl":     int64(r.MaxTTL.Seconds()),
+	}
+	if r.MaxBuckets != nil {
+		data["max_buckets"] = *r.MaxBuckets
+	}
+	return &logical.Response{Data: data}, nil
+}
+
+func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	r, err := getRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		r = &role{
+			Type:       d.Get("type").(string),
+			Access:     d.Get("access").(string),
+			MaxSizeKB:  d.Get("max_size_kb").(int),
+			MaxObjects: d.Get("max_objects").(int64),
+		}
+	}
+
+	if v, ok := d.GetOk("type"); ok {
+		r.Type = v.(string)
+	}
+	if v, ok := d.GetOk("tenant"); ok {
+		r.Tenant = v.(string)
+	}
+	if v, ok := d.GetOk("uid_prefix"); ok {
+		r.UIDPrefix = v.(string)
+	}
+	if v, ok := d.GetOk("parent_uid"); ok {
+		r.ParentUID = v.(string)
+	}
+	if v, ok := d.GetOk("access"); ok {
+		r.Access = v.(string)
+	}
+	if v, ok := d.GetOk("max_buckets"); ok {
+		n := v.(int)
+		r.MaxBuckets = &n
+	}
+	if v, ok := d.GetOk("max_size_kb"); ok {
+		r.MaxSizeKB = v.(int)
+	}
+	if v, ok := d.GetOk("max_objects"); ok {
+		r.MaxObjects = v.(int64)
+	}
+	if v, ok := d.GetOk("caps"); ok {
+		r.Caps = v.(string)
+	}
+	if v, ok := d.GetOk("ttl"); ok {
+		r.TTL = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("max_ttl"); ok {
+		r.MaxTTL = time.Duration(v.(int)) * time.Second
+	}
+	if r.UIDPrefix == "" {
+		r.UIDPrefix = "vault-" + name
+	}
+
+	if msg := validateRole(r); msg != "" {
+		return logical.ErrorResponse(msg), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(rolesPrefix+name, r)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(ctx, entry)
+}
+
+func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, rolesPrefix+d.Get("name").(string))
+}
+
+// validateRole returns why the supplied role is invalid, if it is.
+func validateRole(r *role) string {
+	switch r.Type {
+	case roleTypeUser:
+		if r.ParentUID != "" {
+			return errUnexpectedParent
+		}
+	case roleTypeSubuser:
+		if r.ParentUID == "" {
+			return errMissingParentUID
+		}
+		switch radosgw_admin.SubuserAccess(r.Access) {
+		case radosgw_admin.SubuserAccessRead, radosgw_admin.SubuserAccessWrite,
+			radosgw_admin.SubuserAccessReadWrite, radosgw_admin.SubuserAccessFull:
+		default:
+			return errInvalidAccess
+		}
+	default:
+		return errInvalidRoleType
+	}
+	if r.MaxSizeKB < radosgw.QuotaUnlimited || r.MaxObjects < radosgw.QuotaUnlimited {
+		return errNegativeQuota
+	}
+	if r.MaxTTL > 0 && r.TTL > r.MaxTTL {
+		return errTTLExceedsMax
+	}
+	return ""
+}
@@ -0,0 +1,379 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1beta1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/internal/clients/credentials"
+	"github.com/daanvinken/provider-radosgw/internal/clients/radosgw"
+	"github.com/daanvinken/provider-radosgw/internal/clients/vault"
+)
+
+const (
+	errNotCephUser       = "object is not a CephUser"
+	errListCephUsers     = "cannot list CephUsers"
+	errGetProviderConfig = "cannot get ProviderConfig"
+	errImmutable         = "field is immutable"
+	errUnsupportedKV     = "unsupported KV version"
+	errNegativeQuota     = "must be -1 (unlimited) or a non-negative number"
+	errInvalidUID        = "must consist of alphanumeric characters, '-', '_', '.' or '@'"
+	errInvalidTenant     = "must consist of alphanumeric characters or '_'"
+	errDuplicateUser     = "user is already managed by CephUser "
+	errMissingStore      = "at least one credentials store is required"
+	errMissingAuthConfig = "required by the configured auth method"
+	errRequiresKVv2      = "only supported by KV version 2"
+	errInvalidFilePath   = "must be a relative path within the credentials directory"
+	errMissingUserUID    = "uid is required"
+	errPartialKiB        = "must be -1 (unlimited) or a whole number of KiB, e.g. '1500Ki'"
+	errFractionalCount   = "must be -1 (unlimited) or a whole number"
+)
+
+var (
+	// radosgw uses '$' to separate tenants from uids and ':' to separate
+	// subusers from users, so neither may be part of a uid.
+	uidRegexp    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.@-]*$`)
+	tenantRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+	supportedKVVersions  = []string{"1", "2"}
+	supportedAuthMethods = []string{
+		string(v1alpha1.VaultAuthKubernetes),
+		string(v1alpha1.VaultAuthAppRole),
+		string(v1alpha1.VaultAuthJWT),
+		string(v1alpha1.VaultAuthTokenFile),
+	}
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-ceph-radosgw-crossplane-io-v1alpha1-cephuser,mutating=false,failurePolicy=fail,groups=ceph.radosgw.crossplane.io,resources=cephusers,versions=v1alpha1,name=cephusers.ceph.radosgw.crossplane.io,sideEffects=None,admissionReviewVersions=v1,matchPolicy=Equivalent
+
+// A cephUserValidator rejects CephUsers the controller cannot reconcile.
+type cephUserValidator struct {
+	kube client.Reader
+}
+
+func (v *cephUserValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	cr, ok := obj.(*v1alpha1.CephUser)
+	if !ok {
+		return nil, errors.New(errNotCephUser)
+	}
+	return nil, v.validate(ctx, cr, nil)
+}
+
+func (v *cephUserValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*v1alpha1.CephUser)
+	if !ok {
+		return nil, errors.New(errNotCephUser)
+	}
+	cr, ok := newObj.(*v1alpha1.CephUser)
+	if !ok {
+		return nil, errors.New(errNotCephUser)
+	}
+	return nil, v.validate(ctx, cr, old)
+}
+
+func (v *cephUserValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *cephUserValidator) validate(ctx context.Context, cr, old *v1alpha1.CephUser) error {
+	// Never stand in the way of a deletion, e.g. of the controller removing
+	// its finalizers from a CephUser created before this webhook existed.
+	if meta.WasDeleted(cr) {
+		return nil
+	}
+
+	errs := ValidateCephUserParameters(cr.Spec.ForProvider)
+	if old != nil {
+		errs = append(errs, ValidateCephUserUpdate(cr.Spec.ForProvider, old.Spec.ForProvider)...)
+	}
+	if len(errs) == 0 {
+		dup, err := v.duplicateOf(ctx, cr)
+		if err != nil {
+			return err
+		}
+		if dup != "" {
+			errs = append(errs, field.Duplicate(field.NewPath("spec", "forProvider", "uid"), errDuplicateUser+dup))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return kerrors.NewInvalid(v1alpha1.CephUserGroupVersionKind.GroupKind(), cr.GetName(), errs)
+}
+
+// duplicateOf returns the name of another CephUser that manages the same
+// radosgw user on the same ProviderConfig, if any. CephUsers without a tenant
+// are compared with the tenant their ProviderConfig defaults them to.
+func (v *cephUserValidator) duplicateOf(ctx context.Context, cr *v1alpha1.CephUser) (string, error) {
+	l := &v1alpha1.CephUserList{}
+	if err := v.kube.List(ctx, l); err != nil {
+		return "", errors.Wrap(err, errListCephUsers)
+	}
+	pcs := map[string]*apisv1alpha1.ProviderConfig{}
+	id, err := v.userID(ctx, cr, pcs)
+	if err != nil {
+		return "", err
+	}
+	for i := range l.Items {
+		other := &l.Items[i]
+		if other.GetName() == cr.GetName() || other.Spec.ForProvider.UID == nil || providerConfigName(other) != providerConfigName(cr) {
+			continue
+		}
+		otherID, err := v.userID(ctx, other, pcs)
+		if err != nil {
+			return "", err
+		}
+		if otherID == id {
+			return other.GetName(), nil
+		}
+	}
+	return "", nil
+}
+
+// userID returns the radosgw user the supplied CephUser manages, defaulting
+// its tenant from its ProviderConfig like the controller does. ProviderConfigs
+// are read once per validation, into the supplied map.
+func (v *cephUserValidator) userID(ctx context.Context, cr *v1alpha1.CephUser, pcs map[string]*apisv1alpha1.ProviderConfig) (string, error) {
+	p := cr.Spec.ForProvider
+	if p.Tenant != nil {
+		return radosgw.UserID(p), nil
+	}
+	name := providerConfigName(cr)
+	pc, ok := pcs[name]
+	if !ok {
+		pc = &apisv1alpha1.ProviderConfig{}
+		if err := v.kube.Get(ctx, types.NamespacedName{Name: name}, pc); client.IgnoreNotFound(err) != nil {
+			return "", errors.Wrap(err, errGetProviderConfig)
+		}
+		pcs[name] = pc
+	}
+	p.Tenant = radosgw.DefaultTenant(pc, cr)
+	return radosgw.UserID(p), nil
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-ceph-radosgw-crossplane-io-v1beta1-cephuser,mutating=false,failurePolicy=fail,groups=ceph.radosgw.crossplane.io,resources=cephusers,versions=v1beta1,name=v1beta1.cephusers.ceph.radosgw.crossplane.io,sideEffects=None,admissionReviewVersions=v1,matchPolicy=Exact
+
+// A quotaValidator rejects v1beta1 CephUsers whose quotas would not survive
+// conversion to the hub version unchanged, which stores sizes in KiB and
+// counts as integers. It only sees v1beta1 CephUsers as they were sent, before
+// conversion rounds their quotas.
+type quotaValidator struct{}
+
+func (v *quotaValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	cr, ok := obj.(*v1beta1.CephUser)
+	if !ok {
+		return nil, errors.New(errNotCephUser)
+	}
+	return nil, v.validate(cr)
+}
+
+func (v *quotaValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	cr, ok := newObj.(*v1beta1.CephUser)
+	if !ok {
+		return nil, errors.New(errNotCephUser)
+	}
+	return nil, v.validate(cr)
+}
+
+func (v *quotaValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *quotaValidator) validate(cr *v1beta1.CephUser) error {
+	if meta.WasDeleted(cr) || cr.Spec.ForProvider.Quota == nil {
+		return nil
+	}
+	errs := ValidateUserQuota(*cr.Spec.ForProvider.Quota)
+	if len(errs) == 0 {
+		return nil
+	}
+	return kerrors.NewInvalid(v1beta1.CephUserGroupVersionKind.GroupKind(), cr.GetName(), errs)
+}
+
+// ValidateUserQuota returns the problems with the supplied v1beta1 quota.
+// Negative quotas are left to ValidateCephUserParameters, which sees them
+// unchanged after conversion.
+func ValidateUserQuota(q v1beta1.UserQuota) field.ErrorList {
+	path := field.NewPath("spec", "forProvider", "quota")
+	errs := field.ErrorList{}
+
+	if q.MaxSize != nil && q.MaxSize.Sign() > 0 && (!isInteger(q.MaxSize) || q.MaxSize.Value()%1024 != 0) {
+		errs = append(errs, field.Invalid(path.Child("maxSize"), q.MaxSize.String(), errPartialKiB))
+	}
+	if q.MaxObjects != nil && q.MaxObjects.Sign() > 0 && !isInteger(q.MaxObjects) {
+		errs = append(errs, field.Invalid(path.Child("maxObjects"), q.MaxObjects.String(), errFractionalCount))
+	}
+	return errs
+}
+
+// isInteger returns whether the supplied quantity is a whole number, which
+// Value does not round.
+func isInteger(q *resource.Quantity) bool {
+	return resource.NewQuantity(q.Value(), q.Format).Cmp(*q) == 0
+}
+
+// ValidateCephUserParameters returns the problems with the supplied parameters.
+func ValidateCephUserParameters(p v1alpha1.CephUserParameters) field.ErrorList {
+	path := field.NewPath("spec", "forProvider")
+	errs := field.ErrorList{}
+
+	switch {
+	case p.UID == nil || *p.UID == "":
+		errs = append(errs, field.Required(path.Child("uid"), errMissingUserUID))
+	case !uidRegexp.MatchString(*p.UID):
+		errs = append(errs, field.Invalid(path.Child("uid"), *p.UID, errInvalidUID))
+	}
+
+	if p.Tenant != nil && *p.Tenant != "" && !tenantRegexp.MatchString(*p.Tenant) {
+		errs = append(errs, field.Invalid(path.Child("tenant"), *p.Tenant, errInvalidTenant))
+	}
+
+	if p.UserQuotaMaxBuckets != nil && *p.UserQuotaMaxBuckets < radosgw.QuotaUnlimited {
+		errs = append(errs, field.Invalid(path.Child("userQuotaMaxBuckets"), *p.UserQuotaMaxBuckets, errNegativeQuota))
+	}
+	if p.UserQuotaMaxSizeKB != nil && *p.UserQuotaMaxSizeKB < radosgw.QuotaUnlimited {
+		errs = append(errs, field.Invalid(path.Child("userQuotaMaxSizeKB"), *p.UserQuotaMaxSizeKB, errNegativeQuota))
+	}
+	if p.UserQuotaMaxObjects != nil && *p.UserQuotaMaxObjects < radosgw.QuotaUnlimited {
+		errs = append(errs, field.Invalid(path.Child("userQuotaMaxObjects"), *p.UserQuotaMaxObjects, errNegativeQuota))
+	}
+
+	if p.VaultCredentialsStore == nil && p.SecretCredentialsStore == nil && p.FileCredentialsStore == nil {
+		errs = append(errs, field.Required(path.Child("vaultCredentialsStore"), errMissingStore))
+	}
+	if p.VaultCredentialsStore != nil && !contains(supportedKVVersions, p.VaultCredentialsStore.KVVersion) {
+		errs = append(errs, field.NotSupported(path.Child("vaultCredentialsStore", "kvVersion"), p.VaultCredentialsStore.KVVersion, supportedKVVersions))
+	}
+	for key, tmpl := range p.CredentialsTemplate {
+		if _, err := credentials.ParseTemplate(key, tmpl); err != nil {
+			errs = append(errs, field.Invalid(path.Child("credentialsTemplate").Key(key), tmpl, err.Error()))
+		}
+	}
+	if vc := p.VaultCredentialsStore; vc != nil && vc.KVVersion == "1" {
+		if vc.CheckAndSet {
+			errs = append(errs, field.Invalid(path.Child("vaultCredentialsStore", "checkAndSet"), vc.CheckAndSet, errRequiresKVv2))
+		}
+		if vc.KVDeletionPolicy == v1alpha1.KVDeletionPolicyDestroy {
+			errs = append(errs, field.Invalid(path.Child("vaultCredentialsStore", "kvDeletionPolicy"), vc.KVDeletionPolicy, errRequiresKVv2))
+		}
+	}
+	if vc := p.VaultCredentialsStore; vc != nil && vc.SecretPathTemplate != "" {
+		if _, err := vault.ParseSecretPathTemplate(vc.SecretPathTemplate); err != nil {
+			errs = append(errs, field.Invalid(path.Child("vaultCredentialsStore", "secretPathTemplate"), vc.SecretPathTemplate, err.Error()))
+		}
+	}
+	if p.VaultCredentialsStore != nil && p.VaultCredentialsStore.Auth != nil {
+		errs = append(errs, validateVaultAuth(*p.VaultCredentialsStore.Auth, path.Child("vaultCredentialsStore", "auth"))...)
+	}
+	if vc := p.VaultCredentialsStore; vc != nil && kubernetesAuth(vc.Auth) && vc.ServiceAccountName == "" {
+		errs = append(errs, field.Required(path.Child("vaultCredentialsStore", "serviceAccountName"), errMissingAuthConfig))
+	}
+	if sc := p.SecretCredentialsStore; sc != nil {
+		if sc.Namespace == "" {
+			errs = append(errs, field.Required(path.Child("secretCredentialsStore", "namespace"), ""))
+		}
+		if sc.Name == "" {
+			errs = append(errs, field.Required(path.Child("secretCredentialsStore", "name"), ""))
+		}
+	}
+	if fc := p.FileCredentialsStore; fc != nil {
+		if fc.Path == "" || filepath.IsAbs(fc.Path) || !filepath.IsLocal(fc.Path) {
+			errs = append(errs, field.Invalid(path.Child("fileCredentialsStore", "path"), fc.Path, errInvalidFilePath))
+		}
+	}
+
+	return errs
+}
+
+// ValidateCephUserUpdate returns the problems with changing the supplied old
+// parameters to the supplied new ones. The tenant may be set once, which is
+// how it is defaulted from the ProviderConfig.
+func ValidateCephUserUpdate(p, old v1alpha1.CephUserParameters) field.ErrorList {
+	path := field.NewPath("spec", "forProvider")
+	errs := field.ErrorList{}
+
+	if old.UID != nil && (p.UID == nil || *p.UID != *old.UID) {
+		errs = append(errs, field.Forbidden(path.Child("uid"), errImmutable))
+	}
+	if old.Tenant != nil && (p.Tenant == nil || *p.Tenant != *old.Tenant) {
+		errs = append(errs, field.Forbidden(path.Child("tenant"), errImmutable))
+	}
+
+	return errs
+}
+
+func providerConfigName(cr *v1alpha1.CephUser) string {
+	if ref := cr.GetProviderConfigReference(); ref != nil {
+		return ref.Name
+	}
+	return ""
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// kubernetesAuth returns whether the supplied auth logs in to Vault with
+// Kubernetes auth, which is the default.
+func kubernetesAuth(a *v1alpha1.VaultAuth) bool {
+	return a == nil || a.Method == v1alpha1.VaultAuthKubernetes || a.Method == ""
+}
+
+func validateVaultAuth(a v1alpha1.VaultAuth, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	switch a.Method {
+	case v1alpha1.VaultAuthKubernetes:
+	case v1alpha1.VaultAuthAppRole:
+		if a.AppRole == nil {
+			errs = append(errs, field.Required(path.Child("appRole"), errMissingAuthConfig))
+		}
+	case v1alpha1.VaultAuthJWT:
+		if a.JWT == nil {
+			errs = append(errs, field.Required(path.Child("jwt"), errMissingAuthConfig))
+		} else if a.JWT.Role == "" {
+			errs = append(errs, field.Required(path.Child("jwt", "role"), ""))
+		}
+	case v1alpha1.VaultAuthTokenFile:
+		if a.TokenFile == nil || a.TokenFile.Path == "" {
+			errs = append(errs, field.Required(path.Child("tokenFile", "path"), errMissingAuthConfig))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("method"), a.Method, supportedAuthMethods))
+	}
+	return errs
+}
@@ -0,0 +1,417 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1beta1"
+	apisv1alpha1 "github.com/daanvinken/provider-radosgw/apis/v1alpha1"
+)
+
+func cephUser(name, pc, uid string, tenant *string, kv string) *v1alpha1.CephUser {
+	cr := &v1alpha1.CephUser{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1alpha1.CephUserSpec{
+			ForProvider: v1alpha1.CephUserParameters{
+				UID:                   &uid,
+				Tenant:                tenant,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{KVVersion: kv, ServiceAccountName: "sa"},
+			},
+		},
+	}
+	cr.SetProviderConfigReference(&xpv1.Reference{Name: pc})
+	return cr
+}
+
+func TestValidateCephUserParameters(t *testing.T) {
+	uid := "user"
+	badUID := "team$user"
+	tenant := "team"
+	badTenant := "team-a"
+	tooLow := -2
+	tooLowObjects := int64(-2)
+	unlimited := -1
+
+	path := field.NewPath("spec", "forProvider")
+
+	cases := map[string]struct {
+		reason string
+		params v1alpha1.CephUserParameters
+		want   field.ErrorList
+	}{
+		"Valid": {
+			reason: "A complete CephUser should be accepted.",
+			params: v1alpha1.CephUserParameters{
+				UID:                   &uid,
+				Tenant:                &tenant,
+				UserQuotaMaxSizeKB:    &unlimited,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{KVVersion: "2", ServiceAccountName: "sa"},
+			},
+			want: field.ErrorList{},
+		},
+		"Missing": {
+			reason: "The uid and credentials store are required.",
+			params: v1alpha1.CephUserParameters{},
+			want: field.ErrorList{
+				field.Required(path.Child("uid"), errMissingUserUID),
+				field.Required(path.Child("vaultCredentialsStore"), errMissingStore),
+			},
+		},
+		"InvalidNames": {
+			reason: "Uids and tenants with characters radosgw treats specially should be rejected.",
+			params: v1alpha1.CephUserParameters{
+				UID:                   &badUID,
+				Tenant:                &badTenant,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{KVVersion: "1", ServiceAccountName: "sa"},
+			},
+			want: field.ErrorList{
+				field.Invalid(path.Child("uid"), badUID, errInvalidUID),
+				field.Invalid(path.Child("tenant"), badTenant, errInvalidTenant),
+			},
+		},
+		"NegativeQuotas": {
+			reason: "Quotas below -1 should be rejected.",
+			params: v1alpha1.CephUserParameters{
+				UID:                   &uid,
+				UserQuotaMaxBuckets:   &tooLow,
+				UserQuotaMaxSizeKB:    &tooLow,
+				UserQuotaMaxObjects:   &tooLowObjects,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{KVVersion: "2", ServiceAccountName: "sa"},
+			},
+			want: field.ErrorList{
+				field.Invalid(path.Child("userQuotaMaxBuckets"), tooLow, errNegativeQuota),
+				field.Invalid(path.Child("userQuotaMaxSizeKB"), tooLow, errNegativeQuota),
+				field.Invalid(path.Child("userQuotaMaxObjects"), tooLowObjects, errNegativeQuota),
+			},
+		},
+		"SecretStore": {
+			reason: "A Secret store alone should be accepted.",
+			params: v1alpha1.CephUserParameters{
+				UID:                    &uid,
+				SecretCredentialsStore: &v1alpha1.SecretStoreConfig{Namespace: "ns", Name: "creds"},
+			},
+			want: field.ErrorList{},
+		},
+		"FileStoreOutsideDir": {
+			reason: "File stores must not escape the credentials directory.",
+			params: v1alpha1.CephUserParameters{
+				UID:                  &uid,
+				FileCredentialsStore: &v1alpha1.FileStoreConfig{Path: "../etc/passwd"},
+			},
+			want: field.ErrorList{
+				field.Invalid(path.Child("fileCredentialsStore", "path"), "../etc/passwd", errInvalidFilePath),
+			},
+		},
+		"UnsupportedKVVersion": {
+			reason: "KV versions other than 1 and 2 should be rejected.",
+			params: v1alpha1.CephUserParameters{
+				UID:                   &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{KVVersion: "3", ServiceAccountName: "sa"},
+			},
+			want: field.ErrorList{
+				field.NotSupported(path.Child("vaultCredentialsStore", "kvVersion"), "3", supportedKVVersions),
+			},
+		},
+		"InvalidSecretPathTemplate": {
+			reason: "Secret path templates that do not parse should be rejected.",
+			params: v1alpha1.CephUserParameters{
+				UID:                   &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{KVVersion: "2", ServiceAccountName: "sa", SecretPathTemplate: "{{ .UID"},
+			},
+			want: field.ErrorList{
+				field.Invalid(path.Child("vaultCredentialsStore", "secretPathTemplate"), "{{ .UID",
+					`cannot parse secret path template: template: secretPath:1: unclosed action`),
+			},
+		},
+		"InvalidCredentialsTemplate": {
+			reason: "Credentials templates that do not parse should be rejected.",
+			params: v1alpha1.CephUserParameters{
+				UID:                    &uid,
+				SecretCredentialsStore: &v1alpha1.SecretStoreConfig{Namespace: "default", Name: "creds"},
+				CredentialsTemplate:    map[string]string{"AWS_ACCESS_KEY_ID": "{{ .AccessKey"},
+			},
+			want: field.ErrorList{
+				field.Invalid(path.Child("credentialsTemplate").Key("AWS_ACCESS_KEY_ID"), "{{ .AccessKey",
+					`cannot parse credentials template "AWS_ACCESS_KEY_ID": template: AWS_ACCESS_KEY_ID:1: unclosed action`),
+			},
+		},
+		"KVv2Options": {
+			reason: "Check-and-set and destroying secrets should require KV version 2.",
+			params: v1alpha1.CephUserParameters{
+				UID: &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{
+					KVVersion:          "1",
+					ServiceAccountName: "sa",
+					CheckAndSet:        true,
+					KVDeletionPolicy:   v1alpha1.KVDeletionPolicyDestroy,
+				},
+			},
+			want: field.ErrorList{
+				field.Invalid(path.Child("vaultCredentialsStore", "checkAndSet"), true, errRequiresKVv2),
+				field.Invalid(path.Child("vaultCredentialsStore", "kvDeletionPolicy"), v1alpha1.KVDeletionPolicyDestroy, errRequiresKVv2),
+			},
+		},
+		"MissingServiceAccount": {
+			reason: "Kubernetes auth, the default, should require the service account to log in as.",
+			params: v1alpha1.CephUserParameters{
+				UID:                   &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{KVVersion: "2"},
+			},
+			want: field.ErrorList{
+				field.Required(path.Child("vaultCredentialsStore", "serviceAccountName"), errMissingAuthConfig),
+			},
+		},
+		"MissingAuthConfig": {
+			reason: "Auth methods should require their configuration, but not the service account of Kubernetes auth.",
+			params: v1alpha1.CephUserParameters{
+				UID: &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{
+					KVVersion: "2",
+					Auth:      &v1alpha1.VaultAuth{Method: v1alpha1.VaultAuthAppRole},
+				},
+			},
+			want: field.ErrorList{
+				field.Required(path.Child("vaultCredentialsStore", "auth", "appRole"), errMissingAuthConfig),
+			},
+		},
+		"UnsupportedAuthMethod": {
+			reason: "Unknown auth methods should be rejected.",
+			params: v1alpha1.CephUserParameters{
+				UID: &uid,
+				VaultCredentialsStore: &v1alpha1.VaultConfig{
+					KVVersion: "2",
+					Auth:      &v1alpha1.VaultAuth{Method: "LDAP"},
+				},
+			},
+			want: field.ErrorList{
+				field.NotSupported(path.Child("vaultCredentialsStore", "auth", "method"), v1alpha1.VaultAuthMethod("LDAP"), supportedAuthMethods),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ValidateCephUserParameters(tc.params)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nValidateCephUserParameters(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidateCephUserUpdate(t *testing.T) {
+	uid := "user"
+	otherUID := "other"
+	tenant := "team"
+	otherTenant := "other"
+
+	path := field.NewPath("spec", "forProvider")
+
+	cases := map[string]struct {
+		reason string
+		params v1alpha1.CephUserParameters
+		old    v1alpha1.CephUserParameters
+		want   field.ErrorList
+	}{
+		"Unchanged": {
+			reason: "Updates that keep the uid and tenant should be accepted.",
+			params: v1alpha1.CephUserParameters{UID: &uid, Tenant: &tenant},
+			old:    v1alpha1.CephUserParameters{UID: &uid, Tenant: &tenant},
+			want:   field.ErrorList{},
+		},
+		"TenantDefaulted": {
+			reason: "Setting a tenant that was unset should be accepted.",
+			params: v1alpha1.CephUserParameters{UID: &uid, Tenant: &tenant},
+			old:    v1alpha1.CephUserParameters{UID: &uid},
+			want:   field.ErrorList{},
+		},
+		"Changed": {
+			reason: "Changing the uid or tenant should be rejected.",
+			params: v1alpha1.CephUserParameters{UID: &otherUID, Tenant: &otherTenant},
+			old:    v1alpha1.CephUserParameters{UID: &uid, Tenant: &tenant},
+			want: field.ErrorList{
+				field.Forbidden(path.Child("uid"), errImmutable),
+				field.Forbidden(path.Child("tenant"), errImmutable),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ValidateCephUserUpdate(tc.params, tc.old)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nValidateCephUserUpdate(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidateCreate(t *testing.T) {
+	errBoom := errors.New("boom")
+	tenant := "team"
+	empty := ""
+
+	list := func(items ...v1alpha1.CephUser) test.MockListFn {
+		return func(_ context.Context, obj client.ObjectList, _ ...client.ListOption) error {
+			obj.(*v1alpha1.CephUserList).Items = items
+			return nil
+		}
+	}
+	// get serves ProviderConfigs that default CephUsers to the supplied
+	// tenant, if any.
+	get := func(defaultTenant *string) test.MockGetFn {
+		return func(_ context.Context, _ client.ObjectKey, obj client.Object) error {
+			obj.(*apisv1alpha1.ProviderConfig).Spec.DefaultTenant = defaultTenant
+			return nil
+		}
+	}
+
+	type want struct {
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		kube   client.Reader
+		cr     *v1alpha1.CephUser
+		want   want
+	}{
+		"Unique": {
+			reason: "A CephUser managing a user nobody else manages should be accepted.",
+			kube:   &test.MockClient{MockList: list(*cephUser("b", "pc", "other", nil, "2")), MockGet: get(nil)},
+			cr:     cephUser("a", "pc", "user", nil, "2"),
+			want:   want{},
+		},
+		"OtherProviderConfig": {
+			reason: "The same uid on another ProviderConfig is another user.",
+			kube:   &test.MockClient{MockList: list(*cephUser("b", "other-pc", "user", nil, "2")), MockGet: get(nil)},
+			cr:     cephUser("a", "pc", "user", nil, "2"),
+			want:   want{},
+		},
+		"OtherTenant": {
+			reason: "The same uid in another tenant is another user.",
+			kube:   &test.MockClient{MockList: list(*cephUser("b", "pc", "user", &tenant, "2")), MockGet: get(nil)},
+			cr:     cephUser("a", "pc", "user", nil, "2"),
+			want:   want{},
+		},
+		"NoTenant": {
+			reason: "An empty tenant is no tenant, even when the ProviderConfig defaults one.",
+			kube:   &test.MockClient{MockList: list(*cephUser("b", "pc", "user", &tenant, "2")), MockGet: get(&tenant)},
+			cr:     cephUser("a", "pc", "user", &empty, "2"),
+			want:   want{},
+		},
+		"Duplicate": {
+			reason: "A CephUser managing a user another CephUser manages should be rejected.",
+			kube:   &test.MockClient{MockList: list(*cephUser("b", "pc", "user", nil, "2")), MockGet: get(nil)},
+			cr:     cephUser("a", "pc", "user", nil, "2"),
+			want: want{
+				err: kerrors.NewInvalid(v1alpha1.CephUserGroupVersionKind.GroupKind(), "a", field.ErrorList{
+					field.Duplicate(field.NewPath("spec", "forProvider", "uid"), errDuplicateUser+"b"),
+				}),
+			},
+		},
+		"DuplicateDefaultTenant": {
+			reason: "A CephUser without a tenant manages the user in the tenant its ProviderConfig defaults it to.",
+			kube:   &test.MockClient{MockList: list(*cephUser("b", "pc", "user", &tenant, "2")), MockGet: get(&tenant)},
+			cr:     cephUser("a", "pc", "user", nil, "2"),
+			want: want{
+				err: kerrors.NewInvalid(v1alpha1.CephUserGroupVersionKind.GroupKind(), "a", field.ErrorList{
+					field.Duplicate(field.NewPath("spec", "forProvider", "uid"), errDuplicateUser+"b"),
+				}),
+			},
+		},
+		"ListError": {
+			reason: "Errors listing CephUsers should be returned.",
+			kube:   &test.MockClient{MockList: test.NewMockListFn(errBoom)},
+			cr:     cephUser("a", "pc", "user", nil, "2"),
+			want:   want{err: errors.Wrap(errBoom, errListCephUsers)},
+		},
+		"GetProviderConfigError": {
+			reason: "Errors getting the ProviderConfig to default the tenant from should be returned.",
+			kube:   &test.MockClient{MockList: list(*cephUser("b", "pc", "user", nil, "2")), MockGet: test.NewMockGetFn(errBoom)},
+			cr:     cephUser("a", "pc", "user", nil, "2"),
+			want:   want{err: errors.Wrap(errBoom, errGetProviderConfig)},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			v := &cephUserValidator{kube: tc.kube}
+			_, err := v.ValidateCreate(context.Background(), tc.cr)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nValidateCreate(...): -want error, +got error:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidateUserQuota(t *testing.T) {
+	path := field.NewPath("spec", "forProvider", "quota")
+
+	cases := map[string]struct {
+		reason string
+		quota  v1beta1.UserQuota
+		want   field.ErrorList
+	}{
+		"Exact": {
+			reason: "Sizes in whole KiB and whole counts should be accepted.",
+			quota:  v1beta1.UserQuota{MaxSize: quantity("200Gi"), MaxObjects: quantity("1M")},
+			want:   field.ErrorList{},
+		},
+		"Unlimited": {
+			reason: "-1 should be accepted as unlimited, though it is no whole number of KiB.",
+			quota:  v1beta1.UserQuota{MaxSize: quantity("-1"), MaxObjects: quantity("-1")},
+			want:   field.ErrorList{},
+		},
+		"Inexact": {
+			reason: "Sizes that are no whole number of KiB and fractional counts should be rejected, since they would be rounded by conversion.",
+			quota:  v1beta1.UserQuota{MaxSize: quantity("1500"), MaxObjects: quantity("1500m")},
+			want: field.ErrorList{
+				field.Invalid(path.Child("maxSize"), "1500", errPartialKiB),
+				field.Invalid(path.Child("maxObjects"), "1500m", errFractionalCount),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ValidateUserQuota(tc.quota)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nValidateUserQuota(...): -want, +got:\n%s\n", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func quantity(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
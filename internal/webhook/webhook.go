@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook serves the admission and conversion webhooks of the radosgw
+// provider.
+package webhook
+
+import (
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1alpha1"
+	"github.com/daanvinken/provider-radosgw/apis/ceph/v1beta1"
+)
+
+// Setup registers the webhooks of all radosgw resources with the supplied
+// manager.
+func Setup(mgr ctrl.Manager) error {
+	// Registering the hub version serves the conversion webhook for all of
+	// its versions. The validating webhook matches equivalent versions, so it
+	// only ever sees the hub version.
+	if err := ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.CephUser{}).
+		WithValidator(&cephUserValidator{kube: mgr.GetClient()}).
+		Complete(); err != nil {
+		return err
+	}
+	// Quotas of v1beta1 CephUsers are validated before they are converted to
+	// the hub version, which could not represent some of them exactly.
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1beta1.CephUser{}).
+		WithValidator(&quotaValidator{}).
+		Complete()
+}